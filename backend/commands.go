@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"school-attendance/handlers"
+	"time"
+)
+
+// runCommand handles maintenance subcommands run against the database
+// instead of starting the server, e.g.
+//
+//	./presensi-backend rotate-keys -alg RS256 -grace 1h
+//	./presensi-backend sync-directory -dry-run
+//	./presensi-backend mark-absences -date 2024-08-19 -dry-run
+func runCommand(args []string) {
+	switch args[0] {
+	case "rotate-keys":
+		fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+		alg := fs.String("alg", handlers.DefaultSigningAlgorithm(), "signing algorithm: HS256, RS256 or EdDSA")
+		grace := fs.Duration("grace", handlers.DefaultSigningKeyGrace, "how long retired keys keep verifying tokens")
+		fs.Parse(args[1:])
+
+		key, err := handlers.RotateSigningKey(*alg, *grace)
+		if err != nil {
+			log.Fatal("Failed to rotate signing key:", err)
+		}
+		fmt.Printf("New %s signing key %s is used from %s\n",
+			key.Algorithm, key.KID, key.ActiveFrom.Format("2006-01-02 15:04:05"))
+	case "sync-directory":
+		fs := flag.NewFlagSet("sync-directory", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "only report what would change")
+		fs.Parse(args[1:])
+
+		report, err := handlers.RunDirectorySync("cli", *dryRun)
+		if err != nil {
+			log.Fatal("Failed to sync directory:", err)
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	case "mark-absences":
+		fs := flag.NewFlagSet("mark-absences", flag.ExitOnError)
+		date := fs.String("date", time.Now().Format("2006-01-02"), "school day to check, YYYY-MM-DD")
+		dryRun := fs.Bool("dry-run", false, "only list the students that would be marked")
+		fs.Parse(args[1:])
+
+		day, err := time.ParseInLocation("2006-01-02", *date, time.Local)
+		if err != nil {
+			log.Fatal("Invalid date:", err)
+		}
+		report, err := handlers.RunAutoAbsence(day, "cli", *dryRun)
+		if err != nil {
+			log.Fatal("Failed to mark absences:", err)
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	default:
+		log.Fatalf("Unknown command %q (available: rotate-keys, sync-directory, mark-absences)", args[0])
+	}
+}
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"crypto/rand"
 	"fmt"
 	"log"
-	"school-attendance/handlers"
+	"math/big"
+	"os"
 	"school-attendance/models"
 	"time"
 
@@ -17,62 +19,289 @@ var DB *gorm.DB
 
 func InitDatabase() {
 	var err error
-	DB, err = gorm.Open(sqlite.Open("school_attendance.db"), &gorm.Config{
+	// Transactions take the write lock up front and wait for each other,
+	// so concurrent check-ins queue instead of failing with "database is
+	// locked"
+	DB, err = gorm.Open(sqlite.Open("school_attendance.db?_busy_timeout=5000&_txlock=immediate"), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// Report unique index violations as gorm.ErrDuplicatedKey
+		TranslateError: true,
 	})
 	
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	if err := migrate(); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+	
+	fmt.Println("Database connected and migrated successfully")
+}
+
+// migrate brings the schema of DB up to date, upgrading data from older
+// releases, and seeds the defaults.
+func migrate() error {
+	// Defaults that change behaviour are only seeded on a new database
+	freshDatabase := !DB.Migrator().HasTable(&models.Admin{})
+
+	// Deployments from before teaching assignments existed need their roles
+	// upgraded once the schema is in place
+	scopingIntroduced := !DB.Migrator().HasTable(&models.TeachingAssignment{})
+	hadRoles := DB.Migrator().HasTable(&models.Role{})
+	leaveIntroduced := !DB.Migrator().HasTable(&models.LeaveRequest{})
+	locksIntroduced := !DB.Migrator().HasTable(&models.AttendanceLock{})
+
+	// The unique indexes on check-ins cannot be created while duplicates
+	// from concurrent requests remain
+	dedupeCheckIns()
+
 	// Auto migrate the schema
-	err = DB.AutoMigrate(
+	err := DB.AutoMigrate(
 		&models.Student{},
 		&models.Admin{},
 		&models.Attendance{},
-		&handlers.QRSession{},
+		&models.QRSession{},
 		&models.QRAttendance{},
 		&models.Parent{},
 		&models.StudentParent{},
 		&models.Notification{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.Session{},
+		&models.Role{},
+		&models.RolePermission{},
+		&models.ParentInvitation{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.MFAChallenge{},
+		&models.LoginThrottle{},
+		&models.FailedLogin{},
+		&models.AuditLog{},
+		&models.AttendanceVersion{},
+		&models.APIKey{},
+		&models.SigningKey{},
+		&models.OIDCLoginState{},
+		&models.DirectorySyncRun{},
+		&models.TeachingAssignment{},
+		&models.BellSchedule{},
+		&models.LessonPeriod{},
+		&models.AutoAbsenceRun{},
+		&models.SchoolYear{},
+		&models.Semester{},
+		&models.CalendarEvent{},
+		&models.LeaveRequest{},
+		&models.AttendanceLock{},
+		&models.AttendanceCorrection{},
+		&models.IdempotencyKey{},
 	)
 	
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return err
+	}
+
+	// Seed roles before the default admin that depends on them
+	seedRoles()
+	if scopingIntroduced && hadRoles {
+		grantAllClasses()
+	}
+	if leaveIntroduced && hadRoles {
+		grantPermission(models.PermLeaveApprove, models.RolePrincipal, models.RoleHomeroomTeacher)
+	}
+	if locksIntroduced && hadRoles {
+		grantPermission(models.PermAttendanceLock, models.RolePrincipal)
+		grantPermission(models.PermAttendanceApprove, models.RolePrincipal, models.RoleHomeroomTeacher)
 	}
 
 	// Create default admin user
 	createDefaultAdmin()
-	
-	fmt.Println("Database connected and migrated successfully")
+
+	if freshDatabase {
+		seedBellSchedule()
+	}
+	return nil
 }
 
+// createDefaultAdmin bootstraps the first admin account. The password is
+// read from DEFAULT_ADMIN_PASSWORD or generated randomly and printed once;
+// either way it has to be changed on first login.
 func createDefaultAdmin() {
 	var admin models.Admin
 	result := DB.Where("username = ?", "admin").First(&admin)
 	
 	if result.Error == gorm.ErrRecordNotFound {
+		password := os.Getenv("DEFAULT_ADMIN_PASSWORD")
+		generated := password == ""
+		if generated {
+			var err error
+			password, err = generatePassword()
+			if err != nil {
+				log.Printf("Error generating admin password: %v", err)
+				return
+			}
+		}
+
+		email := os.Getenv("DEFAULT_ADMIN_EMAIL")
+		if email == "" {
+			email = "admin@school.com"
+		}
+
 		// Hash password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
 			log.Printf("Error hashing password: %v", err)
 			return
 		}
 
 		defaultAdmin := models.Admin{
-			Username: "admin",
-			Email:    "admin@school.com",
-			Password: string(hashedPassword),
-			Name:     "System Administrator",
-			Role:     "admin",
-			IsActive: true,
+			Username:           "admin",
+			Email:              email,
+			Password:           string(hashedPassword),
+			Name:               "System Administrator",
+			Role:               models.RoleSuperAdmin,
+			IsActive:           true,
+			MustChangePassword: true,
 		}
 
 		if err := DB.Create(&defaultAdmin).Error; err != nil {
 			log.Printf("Error creating default admin: %v", err)
+		} else if generated {
+			fmt.Printf("Default admin created - Email: %s, Password: %s (must be changed on first login)\n", email, password)
 		} else {
-			fmt.Println("Default admin created - Username: admin, Password: admin123")
+			fmt.Printf("Default admin created - Email: %s, password from DEFAULT_ADMIN_PASSWORD\n", email)
+		}
+		return
+	}
+
+	// Older deployments seeded the well-known admin123 password; force a
+	// rotation if it is still in use.
+	if result.Error == nil && !admin.MustChangePassword &&
+		bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(legacyDefaultPassword)) == nil {
+		DB.Model(&admin).Update("must_change_password", true)
+		log.Println("Default admin still uses the legacy password; a password change is now required")
+	}
+}
+
+const legacyDefaultPassword = "admin123"
+
+func generatePassword() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"
+
+	password := make([]byte, 16)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = alphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+func seedRoles() {
+	for _, def := range models.DefaultRoles {
+		var role models.Role
+		result := DB.Where("name = ?", def.Name).First(&role)
+		if result.Error != gorm.ErrRecordNotFound {
+			continue
 		}
+
+		role = models.Role{
+			Name:        def.Name,
+			DisplayName: def.DisplayName,
+			IsSystem:    true,
+		}
+		for _, perm := range def.Permissions {
+			role.Permissions = append(role.Permissions, models.RolePermission{Permission: perm})
+		}
+
+		if err := DB.Create(&role).Error; err != nil {
+			log.Printf("Error creating role %s: %v", def.Name, err)
+		}
+	}
+}
+
+// grantAllClasses keeps existing roles unrestricted when class scoping is
+// introduced. Only the teacher roles start out limited to their assignments.
+func grantAllClasses() {
+	var roles []models.Role
+	if err := DB.Preload("Permissions").Find(&roles).Error; err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return
+	}
+
+	for _, role := range roles {
+		if role.Name == models.RoleHomeroomTeacher || role.Name == models.RoleSubjectTeacher {
+			continue
+		}
+		if models.HasPermission(role.PermissionNames(), models.PermClassesAll) {
+			continue
+		}
+		if err := DB.Create(&models.RolePermission{RoleID: role.ID, Permission: models.PermClassesAll}).Error; err != nil {
+			log.Printf("Error granting %s to role %s: %v", models.PermClassesAll, role.Name, err)
+		}
+	}
+}
+
+// grantPermission adds a permission introduced by an upgrade to the seeded
+// roles that get it on new deployments.
+func grantPermission(perm string, roleNames ...string) {
+	var roles []models.Role
+	if err := DB.Preload("Permissions").Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return
+	}
+
+	for _, role := range roles {
+		if models.HasPermission(role.PermissionNames(), perm) {
+			continue
+		}
+		if err := DB.Create(&models.RolePermission{RoleID: role.ID, Permission: perm}).Error; err != nil {
+			log.Printf("Error granting %s to role %s: %v", perm, role.Name, err)
+		}
+	}
+}
+
+// dedupeCheckIns clears duplicate rows that double-submitted check-ins and
+// QR scans could create before the unique indexes existed. The first row of
+// each slot is kept, which is also the one later edits were applied to;
+// duplicate attendance rows are soft deleted so their history survives.
+func dedupeCheckIns() {
+	if DB.Migrator().HasTable(&models.Attendance{}) && !DB.Migrator().HasIndex(&models.Attendance{}, "idx_attendance_slot") {
+		// Releases before lesson periods only had the daily record, which
+		// becomes period 0 once the column is added
+		slot := "student_id, date, period"
+		if !DB.Migrator().HasColumn(&models.Attendance{}, "Period") {
+			slot = "student_id, date"
+		}
+		err := DB.Exec(`UPDATE attendances SET deleted_at = ? WHERE deleted_at IS NULL AND id NOT IN
+			(SELECT MIN(id) FROM attendances WHERE deleted_at IS NULL GROUP BY `+slot+`)`, time.Now()).Error
+		if err != nil {
+			log.Printf("Error removing duplicate attendance records: %v", err)
+		}
+	}
+
+	if DB.Migrator().HasTable("qr_attendances") && !DB.Migrator().HasIndex("qr_attendances", "idx_qr_attendance_scan") {
+		err := DB.Exec(`DELETE FROM qr_attendances WHERE id NOT IN
+			(SELECT MIN(id) FROM qr_attendances GROUP BY session_code, student_id)`).Error
+		if err != nil {
+			log.Printf("Error removing duplicate QR scans: %v", err)
+		}
+	}
+}
+
+// seedBellSchedule creates the default school start time on a new database
+// so check-ins can be marked late. Existing deployments keep marking every
+// check-in present until a schedule is configured.
+func seedBellSchedule() {
+	var count int64
+	DB.Model(&models.BellSchedule{}).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	if err := DB.Create(&models.BellSchedule{StartTime: "07:00", GraceMinutes: 15}).Error; err != nil {
+		log.Printf("Error creating default bell schedule: %v", err)
 	}
 }
 
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"school-attendance/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// baselineAttendance and baselineQRAttendance are the tables as the first
+// release created them, before lesson periods and the unique indexes.
+type baselineAttendance struct {
+	ID           uint      `gorm:"primaryKey"`
+	StudentID    uint      `gorm:"not null"`
+	Date         time.Time `gorm:"not null"`
+	CheckInTime  *time.Time
+	CheckOutTime *time.Time
+	Status       string `gorm:"not null;default:absent"`
+	Notes        string
+	Subject      string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineAttendance) TableName() string { return "attendances" }
+
+type baselineQRAttendance struct {
+	ID          uint `gorm:"primaryKey"`
+	SessionCode string
+	StudentID   string
+	ScanTime    time.Time
+	Location    string
+	CreatedAt   time.Time
+}
+
+func (baselineQRAttendance) TableName() string { return "qr_attendances" }
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	DB = db
+}
+
+func TestMigrateUpgradesBaselineWithDuplicates(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("DEFAULT_ADMIN_PASSWORD", "Password1")
+
+	if err := DB.AutoMigrate(&baselineAttendance{}, &baselineQRAttendance{}); err != nil {
+		t.Fatal(err)
+	}
+	today := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	for _, status := range []string{models.StatusPresent, models.StatusLate, models.StatusPresent} {
+		if err := DB.Create(&baselineAttendance{StudentID: 1, Date: today, Status: status}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	DB.Create(&baselineAttendance{StudentID: 2, Date: today, Status: models.StatusPresent})
+	for i := 0; i < 2; i++ {
+		DB.Create(&baselineQRAttendance{SessionCode: "QR-1", StudentID: "S1", ScanTime: today})
+	}
+
+	if err := migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var rows []models.Attendance
+	DB.Order("id").Find(&rows)
+	if len(rows) != 2 || rows[0].ID != 1 || rows[1].StudentID != 2 {
+		t.Errorf("attendance after upgrade = %+v, want the first row per student", rows)
+	}
+	var deleted int64
+	DB.Unscoped().Model(&models.Attendance{}).Where("deleted_at IS NOT NULL").Count(&deleted)
+	if deleted != 2 {
+		t.Errorf("%d duplicates soft deleted, want 2", deleted)
+	}
+	var scans int64
+	DB.Model(&models.QRAttendance{}).Count(&scans)
+	if scans != 1 {
+		t.Errorf("%d QR scans after upgrade, want 1", scans)
+	}
+
+	if !DB.Migrator().HasIndex(&models.Attendance{}, "idx_attendance_slot") {
+		t.Fatal("slot index missing after upgrade")
+	}
+	err := DB.Create(&models.Attendance{StudentID: 1, Date: today, Status: models.StatusPresent}).Error
+	if err != gorm.ErrDuplicatedKey {
+		t.Errorf("second record for an upgraded slot: %v, want ErrDuplicatedKey", err)
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("DEFAULT_ADMIN_PASSWORD", "Password1")
+
+	if err := migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// A second start is a no-op
+	if err := migrate(); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+
+	var admins int64
+	DB.Model(&models.Admin{}).Count(&admins)
+	if admins != 1 {
+		t.Errorf("%d admins, want the default one", admins)
+	}
+}
@@ -0,0 +1,256 @@
+// Package directory reads the student and staff roster from an LDAP or
+// Active Directory server and verifies passwords with an LDAP bind.
+package directory
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// adAccountDisabled is the ACCOUNTDISABLE flag of Active Directory's
+// userAccountControl attribute.
+const adAccountDisabled = 0x2
+
+// Config describes how to reach the directory and map its entries.
+type Config struct {
+	URL                string
+	BindDN             string
+	BindPassword       string
+	StartTLS           bool
+	InsecureSkipVerify bool
+
+	StudentBaseDNs []string
+	StudentFilter  string
+	AdminBaseDNs   []string
+	AdminFilter    string
+	AdminRole      string // role given to admins created by the sync
+
+	Attributes Attributes
+
+	AuthEnabled  bool          // verify passwords of synced accounts with a bind
+	SyncInterval time.Duration // 0 disables the scheduled sync
+}
+
+// Attributes maps directory attributes onto account fields.
+type Attributes struct {
+	Email     string
+	Name      string
+	Username  string
+	StudentID string
+	Class     string
+	Grade     string
+	Phone     string
+}
+
+// Entry is one person read from the directory.
+type Entry struct {
+	DN          string
+	Email       string
+	Name        string
+	Username    string
+	StudentID   string
+	Class       string
+	Grade       string
+	PhoneNumber string
+	Disabled    bool
+}
+
+// ErrInvalidCredentials is returned by Authenticate when the directory
+// rejected the password, as opposed to being unreachable.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+var current *Config
+
+// Init reads the configuration from the environment. The directory is
+// disabled unless LDAP_URL is set:
+//
+//	LDAP_URL                  ldap://host:389 or ldaps://host:636
+//	LDAP_BIND_DN, LDAP_BIND_PASSWORD  service account used for searches
+//	LDAP_START_TLS            upgrade ldap:// connections with StartTLS
+//	LDAP_INSECURE_SKIP_VERIFY skip certificate verification (testing only)
+//	LDAP_STUDENT_BASE_DNS     OUs holding students, separated by ";"
+//	LDAP_STUDENT_FILTER       default (objectClass=person)
+//	LDAP_ADMIN_BASE_DNS       OUs holding staff, separated by ";"
+//	LDAP_ADMIN_FILTER         default (objectClass=person)
+//	LDAP_ADMIN_ROLE           role for new staff accounts (default staff_operator)
+//	LDAP_ATTR_EMAIL, LDAP_ATTR_NAME, LDAP_ATTR_USERNAME, LDAP_ATTR_STUDENT_ID,
+//	LDAP_ATTR_CLASS, LDAP_ATTR_GRADE, LDAP_ATTR_PHONE  attribute names
+//	LDAP_AUTH                 true to check passwords with an LDAP bind
+//	LDAP_SYNC_INTERVAL        e.g. 1h; empty disables the scheduled sync
+func Init() {
+	current = nil
+
+	url := os.Getenv("LDAP_URL")
+	if url == "" {
+		return
+	}
+
+	env := func(key, fallback string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	cfg := &Config{
+		URL:                url,
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+		StudentBaseDNs:     splitDNs(os.Getenv("LDAP_STUDENT_BASE_DNS")),
+		StudentFilter:      env("LDAP_STUDENT_FILTER", "(objectClass=person)"),
+		AdminBaseDNs:       splitDNs(os.Getenv("LDAP_ADMIN_BASE_DNS")),
+		AdminFilter:        env("LDAP_ADMIN_FILTER", "(objectClass=person)"),
+		AdminRole:          env("LDAP_ADMIN_ROLE", "staff_operator"),
+		Attributes: Attributes{
+			Email:     env("LDAP_ATTR_EMAIL", "mail"),
+			Name:      env("LDAP_ATTR_NAME", "displayName"),
+			Username:  env("LDAP_ATTR_USERNAME", "sAMAccountName"),
+			StudentID: env("LDAP_ATTR_STUDENT_ID", "employeeID"),
+			Class:     env("LDAP_ATTR_CLASS", "department"),
+			Grade:     env("LDAP_ATTR_GRADE", "title"),
+			Phone:     env("LDAP_ATTR_PHONE", "telephoneNumber"),
+		},
+		AuthEnabled: os.Getenv("LDAP_AUTH") == "true",
+	}
+
+	if interval := os.Getenv("LDAP_SYNC_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Printf("Directory: invalid LDAP_SYNC_INTERVAL %q, scheduled sync disabled", interval)
+		} else {
+			cfg.SyncInterval = d
+		}
+	}
+
+	current = cfg
+	log.Printf("Directory: using %s", url)
+}
+
+// Current returns the configuration, or nil when no directory is set up.
+func Current() *Config {
+	return current
+}
+
+func (cfg *Config) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(30 * time.Second)
+
+	if cfg.StartTLS && strings.HasPrefix(cfg.URL, "ldap://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// SearchStudents returns every entry under the student OUs.
+func (cfg *Config) SearchStudents() ([]Entry, error) {
+	return cfg.search(cfg.StudentBaseDNs, cfg.StudentFilter)
+}
+
+// SearchAdmins returns every entry under the staff OUs.
+func (cfg *Config) SearchAdmins() ([]Entry, error) {
+	return cfg.search(cfg.AdminBaseDNs, cfg.AdminFilter)
+}
+
+func (cfg *Config) search(baseDNs []string, filter string) ([]Entry, error) {
+	if len(baseDNs) == 0 {
+		return nil, nil
+	}
+
+	conn, err := cfg.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	a := cfg.Attributes
+	attributes := []string{a.Email, a.Name, a.Username, a.StudentID, a.Class, a.Grade, a.Phone, "userAccountControl"}
+
+	var entries []Entry
+	for _, base := range baseDNs {
+		req := ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, filter, attributes, nil)
+		result, err := conn.SearchWithPaging(req, 500)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range result.Entries {
+			entries = append(entries, cfg.toEntry(e))
+		}
+	}
+	return entries, nil
+}
+
+func (cfg *Config) toEntry(e *ldap.Entry) Entry {
+	a := cfg.Attributes
+	entry := Entry{
+		DN:          e.DN,
+		Email:       strings.ToLower(strings.TrimSpace(e.GetAttributeValue(a.Email))),
+		Name:        strings.TrimSpace(e.GetAttributeValue(a.Name)),
+		Username:    strings.TrimSpace(e.GetAttributeValue(a.Username)),
+		StudentID:   strings.TrimSpace(e.GetAttributeValue(a.StudentID)),
+		Class:       strings.TrimSpace(e.GetAttributeValue(a.Class)),
+		Grade:       strings.TrimSpace(e.GetAttributeValue(a.Grade)),
+		PhoneNumber: strings.TrimSpace(e.GetAttributeValue(a.Phone)),
+	}
+
+	if uac, err := strconv.Atoi(e.GetAttributeValue("userAccountControl")); err == nil {
+		entry.Disabled = uac&adAccountDisabled != 0
+	}
+	return entry
+}
+
+// Authenticate verifies password by binding as dn.
+func (cfg *Config) Authenticate(dn, password string) error {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if dn == "" || password == "" {
+		return ErrInvalidCredentials
+	}
+
+	conn, err := cfg.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+func splitDNs(s string) []string {
+	var dns []string
+	for _, dn := range strings.Split(s, ";") {
+		if dn = strings.TrimSpace(dn); dn != "" {
+			dns = append(dns, dn)
+		}
+	}
+	return dns
+}
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/mailer"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// AdminInvitationTTL is how long a new admin has to choose a password.
+const AdminInvitationTTL = 72 * time.Hour
+
+var errLastSuperAdmin = errors.New("The last active super admin cannot be deactivated, deleted or demoted")
+
+type CreateAdminRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+	// Password is optional; without one an invitation email is sent
+	Password string `json:"password"`
+}
+
+type UpdateAdminRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	IsActive *bool  `json:"is_active"`
+}
+
+type ResetAdminPasswordRequest struct {
+	// Password is optional; without one a reset link is emailed
+	Password string `json:"password"`
+}
+
+func findAdmin(c *gin.Context) (*models.Admin, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid admin ID"})
+		return nil, false
+	}
+
+	var admin models.Admin
+	if err := database.DB.First(&admin, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	return &admin, true
+}
+
+// checkRoleGrantable answers with an error unless the role exists and the
+// caller holds every permission it grants, so nobody can hand out (or take
+// away) more access than they have themselves.
+func checkRoleGrantable(c *gin.Context, roleName string) bool {
+	var role models.Role
+	if err := database.DB.Preload("Permissions").Where("name = ?", roleName).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + roleName})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	granted, _ := c.Get("permissions")
+	held, _ := granted.([]string)
+	for _, perm := range role.PermissionNames() {
+		if !models.HasPermission(held, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot manage admins with the " + roleName + " role"})
+			return false
+		}
+	}
+	return true
+}
+
+// isLastSuperAdmin reports whether admin is the only active super admin
+// left, in which case it must not be deactivated, deleted or demoted.
+func isLastSuperAdmin(tx *gorm.DB, admin *models.Admin) (bool, error) {
+	if admin.Role != models.RoleSuperAdmin || !admin.IsActive {
+		return false, nil
+	}
+
+	var others int64
+	err := tx.Model(&models.Admin{}).
+		Where("role = ? AND is_active = ? AND id != ?", models.RoleSuperAdmin, true, admin.ID).
+		Count(&others).Error
+	return others == 0, err
+}
+
+// sendAdminInvitation emails a link to set the password of a new account.
+func sendAdminInvitation(admin models.Admin, token string) {
+	body := fmt.Sprintf("Halo %s,\n\n"+
+		"Akun admin Sistem Presensi telah dibuat untuk Anda dengan username %s.\n\n"+
+		"Buka tautan berikut dalam %d jam untuk membuat password:\n%s\n",
+		admin.Name, admin.Username, int(AdminInvitationTTL.Hours()), resetPasswordURL(token))
+
+	go func() {
+		if err := mailer.Send(admin.Email, "Undangan Admin - Sistem Presensi", body); err != nil {
+			log.Printf("Error sending admin invitation email: %v", err)
+		}
+	}()
+}
+
+func GetAllAdmins(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	search := c.Query("search")
+
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.Admin{})
+
+	if search != "" {
+		query = query.Where("name LIKE ? OR email LIKE ? OR username LIKE ?",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if active := c.Query("is_active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var admins []models.Admin
+	var total int64
+
+	query.Count(&total)
+
+	if err := query.Offset(offset).Limit(limit).Order("name").Find(&admins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"admins": admins,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+func GetAdmin(c *gin.Context) {
+	admin, ok := findAdmin(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, admin)
+}
+
+// CreateAdmin adds an admin account. With a password the admin has to change
+// it on first login; without one they are emailed an invitation link.
+func CreateAdmin(c *gin.Context) {
+	var req CreateAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Password != "" && !checkPasswordLength(c, req.Password) {
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.Username = strings.TrimSpace(req.Username)
+
+	if !checkRoleGrantable(c, req.Role) {
+		return
+	}
+
+	// Deleted admins keep their username and email
+	var existing models.Admin
+	if err := database.DB.Unscoped().Where("username = ? OR email = ?", req.Username, req.Email).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+		return
+	}
+
+	invite := req.Password == ""
+
+	var password string
+	var err error
+	if invite {
+		password, err = unusablePassword()
+	} else {
+		var hash []byte
+		hash, err = bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		password = string(hash)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	admin := models.Admin{
+		Username:           req.Username,
+		Email:              req.Email,
+		Password:           password,
+		Name:               req.Name,
+		Role:               req.Role,
+		IsActive:           true,
+		MustChangePassword: !invite,
+	}
+
+	var token string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+		if !invite {
+			return nil
+		}
+
+		var err error
+		token, err = createPasswordToken(tx, admin.ID, "admin", c.ClientIP(), AdminInvitationTTL)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create admin"})
+		return
+	}
+
+	if invite {
+		sendAdminInvitation(admin, token)
+	}
+
+	recordAudit(c, AuditCreate, "admin", admin.ID, nil, admin)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"admin":           admin,
+		"invitation_sent": invite,
+	})
+}
+
+func UpdateAdmin(c *gin.Context) {
+	admin, ok := findAdmin(c)
+	if !ok {
+		return
+	}
+
+	before := *admin
+
+	var req UpdateAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkRoleGrantable(c, admin.Role) {
+		return
+	}
+
+	self := admin.ID == c.GetUint("user_id") && c.GetString("user_type") == "admin"
+
+	if req.Role != "" && req.Role != admin.Role {
+		if self {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+			return
+		}
+		if !checkRoleGrantable(c, req.Role) {
+			return
+		}
+	}
+	if req.IsActive != nil && !*req.IsActive && self {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+		return
+	}
+
+	// Check if username or email is being changed and if it already exists
+	if req.Username != "" && req.Username != admin.Username {
+		var existing models.Admin
+		if err := database.DB.Unscoped().Where("username = ? AND id != ?", req.Username, admin.ID).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+			return
+		}
+		admin.Username = req.Username
+	}
+	if req.Email != "" && req.Email != admin.Email {
+		var existing models.Admin
+		if err := database.DB.Unscoped().Where("email = ? AND id != ?", req.Email, admin.ID).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+		admin.Email = req.Email
+	}
+
+	// Update fields
+	if req.Name != "" {
+		admin.Name = req.Name
+	}
+	if req.Role != "" {
+		admin.Role = req.Role
+	}
+	if req.IsActive != nil {
+		admin.IsActive = *req.IsActive
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		last, err := isLastSuperAdmin(tx, &before)
+		if err != nil {
+			return err
+		}
+		if last && (admin.Role != models.RoleSuperAdmin || !admin.IsActive) {
+			return errLastSuperAdmin
+		}
+
+		if err := tx.Save(admin).Error; err != nil {
+			return err
+		}
+		if before.IsActive && !admin.IsActive {
+			return revokeAllUserTokens(tx, admin.ID, "admin", "admin_revoke")
+		}
+		return nil
+	})
+	if err == errLastSuperAdmin {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "admin", admin.ID, before, admin)
+
+	c.JSON(http.StatusOK, admin)
+}
+
+// DeactivateAdmin disables the account and signs the admin out everywhere.
+func DeactivateAdmin(c *gin.Context) {
+	removeAdmin(c, false)
+}
+
+// DeleteAdmin soft-deletes the account and signs the admin out everywhere.
+func DeleteAdmin(c *gin.Context) {
+	removeAdmin(c, true)
+}
+
+func removeAdmin(c *gin.Context, permanent bool) {
+	admin, ok := findAdmin(c)
+	if !ok {
+		return
+	}
+
+	before := *admin
+
+	if admin.ID == c.GetUint("user_id") && c.GetString("user_type") == "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own account"})
+		return
+	}
+	if !checkRoleGrantable(c, admin.Role) {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		last, err := isLastSuperAdmin(tx, admin)
+		if err != nil {
+			return err
+		}
+		if last {
+			return errLastSuperAdmin
+		}
+
+		if permanent {
+			err = tx.Delete(admin).Error
+		} else {
+			err = tx.Model(admin).Update("is_active", false).Error
+		}
+		if err != nil {
+			return err
+		}
+		return revokeAllUserTokens(tx, admin.ID, "admin", "admin_revoke")
+	})
+	if err == errLastSuperAdmin {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove admin"})
+		return
+	}
+
+	if permanent {
+		recordAudit(c, AuditDelete, "admin", admin.ID, before, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Admin deleted successfully"})
+		return
+	}
+
+	recordAudit(c, AuditDeactivate, "admin", admin.ID, before, admin)
+	c.JSON(http.StatusOK, gin.H{"message": "Admin deactivated successfully"})
+}
+
+// ResetAdminPassword either sets a temporary password that must be changed
+// on the next login, or emails the admin a reset link.
+func ResetAdminPassword(c *gin.Context) {
+	admin, ok := findAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req ResetAdminPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Password != "" && !checkPasswordLength(c, req.Password) {
+		return
+	}
+
+	if !checkRoleGrantable(c, admin.Role) {
+		return
+	}
+	if passwordManagedByDirectory(admin.DirectoryDN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the school directory"})
+		return
+	}
+
+	if req.Password == "" {
+		var token string
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			token, err = createPasswordToken(tx, admin.ID, "admin", c.ClientIP(), PasswordResetTTL)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		body := fmt.Sprintf("Administrator telah meminta reset password untuk akun Anda.\n\n"+
+			"Buka tautan berikut dalam %d menit:\n%s\n",
+			int(PasswordResetTTL.Minutes()), resetPasswordURL(token))
+
+		go func(to string) {
+			if err := mailer.Send(to, "Reset Password - Sistem Presensi", body); err != nil {
+				log.Printf("Error sending password reset email: %v", err)
+			}
+		}(admin.Email)
+
+		recordAudit(c, AuditPasswordReset, "admin", admin.ID, nil, gin.H{"method": "email"})
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset link has been sent"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(admin).Updates(map[string]interface{}{
+			"password":             string(hashedPassword),
+			"must_change_password": true,
+		}).Error; err != nil {
+			return err
+		}
+		return revokeAllUserTokens(tx, admin.ID, "admin", "password_reset")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	recordAudit(c, AuditPasswordReset, "admin", admin.ID, nil, gin.H{"method": "temporary_password"})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset; it must be changed on the next login"})
+}
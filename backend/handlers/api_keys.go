@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix marks school attendance keys so they are easy to spot in
+// configuration files and secret scanners.
+const apiKeyPrefix = "sak_"
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ResolveAPIKey is installed into middleware.AuthMiddleware. It returns the
+// key's id and scopes and records when and from where it was last used.
+func ResolveAPIKey(key, clientIP string) (uint, []string, error) {
+	var apiKey models.APIKey
+	if err := database.DB.Where("key_hash = ?", hashToken(key)).First(&apiKey).Error; err != nil {
+		return 0, nil, err
+	}
+
+	now := time.Now()
+	if !apiKey.IsUsable(now) {
+		return 0, nil, errors.New("api key revoked or expired")
+	}
+
+	database.DB.Model(&apiKey).UpdateColumns(map[string]interface{}{
+		"last_used_at": now,
+		"last_used_ip": clientIP,
+	})
+
+	// Keys created before a scope was taken off the allow-list lose it
+	scopes := []string{}
+	for _, scope := range apiKey.ScopeList() {
+		if models.IsAPIKeyScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return apiKey.ID, scopes, nil
+}
+
+// validateAPIKeyScopes rejects unknown permissions, wildcards, anything
+// outside models.APIKeyScopes and anything the creating admin does not hold.
+func validateAPIKeyScopes(c *gin.Context, scopes []string) error {
+	granted, _ := c.Get("permissions")
+	held, _ := granted.([]string)
+
+	for _, scope := range scopes {
+		if !models.IsValidPermission(scope) {
+			return errors.New("Unknown permission: " + scope)
+		}
+		if scope == models.PermAll || strings.HasSuffix(scope, ":*") {
+			return errors.New("Wildcard scopes are not allowed: " + scope)
+		}
+		if !models.IsAPIKeyScope(scope) {
+			return errors.New("API keys cannot be granted " + scope)
+		}
+		if !models.HasPermission(held, scope) {
+			return errors.New("You do not hold permission: " + scope)
+		}
+	}
+	return nil
+}
+
+func GetAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	query := database.DB.Order("created_at DESC")
+	if c.Query("include_revoked") != "true" {
+		query = query.Where("revoked_at IS NULL")
+	}
+	if err := query.Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey returns the plaintext key exactly once; only its hash is
+// stored.
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAPIKeyScopes(c, req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := models.APIKey{
+		Name:      req.Name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		KeyHash:   hashToken(key),
+		Scopes:    strings.Join(req.Scopes, ","),
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: c.GetUint("user_id"),
+	}
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "api_key", apiKey.ID, nil, apiKey)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Store this key now, it will not be shown again",
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := database.DB.First(&apiKey, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if apiKey.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "API key already revoked"})
+		return
+	}
+
+	before := apiKey
+	now := time.Now()
+	apiKey.RevokedAt = &now
+	if err := database.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	recordAudit(c, AuditRevoke, "api_key", apiKey.ID, before, apiKey)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
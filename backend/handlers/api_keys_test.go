@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	testModels = append(testModels, &models.APIKey{})
+}
+
+// withPermissions stands in for RequirePermission's resolver and grants the
+// authenticated admin perms.
+func withPermissions(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("permissions", perms)
+		c.Next()
+	}
+}
+
+func TestValidateAPIKeyScopes(t *testing.T) {
+	held := []string{models.PermAll}
+	tests := []struct {
+		name    string
+		held    []string
+		scopes  []string
+		wantErr string
+	}{
+		{"held scopes", held, []string{models.PermQRGenerate, models.PermAttendanceCheckinOnBehalf}, ""},
+		{"unknown permission", held, []string{"attendance:teleport"}, "Unknown permission"},
+		{"global wildcard", held, []string{models.PermAll}, "Wildcard"},
+		{"resource wildcard", held, []string{"attendance:*"}, "Wildcard"},
+		{"manage api keys", held, []string{models.PermAPIKeysManage}, "cannot be granted"},
+		{"approve corrections", held, []string{models.PermAttendanceApprove}, "cannot be granted"},
+		{"manage admins", held, []string{models.PermAdminsManage}, "cannot be granted"},
+		{"manage roles", held, []string{models.PermRolesManage}, "cannot be granted"},
+		{"manage users", held, []string{models.PermUsersManage}, "cannot be granted"},
+		{"edit attendance", held, []string{models.PermAttendanceUpdate}, "cannot be granted"},
+		{"not held", []string{models.PermQRGenerate}, []string{models.PermReportsExport}, "do not hold"},
+		{"held through resource wildcard", []string{"reports:*"}, []string{models.PermReportsExport}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(nil)
+			c.Set("permissions", tt.held)
+			err := validateAPIKeyScopes(c, tt.scopes)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopesEnforced(t *testing.T) {
+	setupTestDB(t)
+	middleware.SetAPIKeyResolver(ResolveAPIKey)
+	t.Cleanup(func() {
+		middleware.SetAPIKeyResolver(func(string, string) (uint, []string, error) {
+			return 0, nil, errors.New("api keys are not enabled")
+		})
+	})
+	admin := createTestAdmin(t, "admin", "admin@school.id", "secret123")
+
+	manage := gin.New()
+	manage.Use(asUser(admin.ID, "admin"), withPermissions(models.PermAll))
+	manage.POST("/api-keys", CreateAPIKey)
+	manage.DELETE("/api-keys/:id", RevokeAPIKey)
+
+	w := doJSON(t, manage, http.MethodPost, "/api-keys", gin.H{
+		"name":   "kiosk",
+		"scopes": []string{models.PermQRGenerate},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Key    string        `json:"key"`
+		APIKey models.APIKey `json:"api_key"`
+	}
+	decodeJSON(t, w, &created)
+	if !strings.HasPrefix(created.Key, apiKeyPrefix) {
+		t.Fatalf("key %q lacks the %s prefix", created.Key, apiKeyPrefix)
+	}
+
+	var stored models.APIKey
+	database.DB.First(&stored, created.APIKey.ID)
+	if stored.KeyHash == created.Key || stored.KeyHash != hashToken(created.Key) {
+		t.Error("key is not stored as its hash")
+	}
+
+	api := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/qr", middleware.AuthMiddleware("admin"), middleware.RequirePermission(models.PermQRGenerate), ok)
+	api.GET("/reports", middleware.AuthMiddleware("admin"), middleware.RequirePermission(models.PermReportsView), ok)
+	api.GET("/student", middleware.AuthMiddleware("student"), ok)
+
+	if w := doJSON(t, api, http.MethodGet, "/qr", nil, "X-API-Key", created.Key); w.Code != http.StatusOK {
+		t.Errorf("held scope: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, api, http.MethodGet, "/reports", nil, "X-API-Key", created.Key); w.Code != http.StatusForbidden {
+		t.Errorf("missing scope: %d, want 403", w.Code)
+	}
+	if w := doJSON(t, api, http.MethodGet, "/student", nil, "X-API-Key", created.Key); w.Code != http.StatusForbidden {
+		t.Errorf("student route: %d, want 403", w.Code)
+	}
+	if w := doJSON(t, api, http.MethodGet, "/qr", nil, "X-API-Key", apiKeyPrefix+"unknown"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: %d, want 401", w.Code)
+	}
+
+	// A scope taken off the allow-list after the key was created is ignored
+	database.DB.Model(&models.APIKey{}).Where("id = ?", created.APIKey.ID).
+		Update("scopes", models.PermQRGenerate+","+models.PermUsersManage)
+	api.GET("/users", middleware.AuthMiddleware("admin"), middleware.RequirePermission(models.PermUsersManage), ok)
+	if w := doJSON(t, api, http.MethodGet, "/users", nil, "X-API-Key", created.Key); w.Code != http.StatusForbidden {
+		t.Errorf("disallowed stored scope: %d, want 403", w.Code)
+	}
+
+	database.DB.First(&stored, created.APIKey.ID)
+	if stored.LastUsedAt == nil {
+		t.Error("last_used_at not recorded")
+	}
+
+	if w := doJSON(t, manage, http.MethodDelete, "/api-keys/"+strconv.FormatUint(uint64(stored.ID), 10), nil); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, api, http.MethodGet, "/qr", nil, "X-API-Key", created.Key); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: %d, want 401", w.Code)
+	}
+}
+
+func TestCreateAPIKeyRejectsUnheldScope(t *testing.T) {
+	setupTestDB(t)
+	admin := createTestAdmin(t, "guru", "guru@school.id", "secret123")
+
+	r := gin.New()
+	r.Use(asUser(admin.ID, "admin"), withPermissions(models.PermQRGenerate, models.PermAPIKeysManage))
+	r.POST("/api-keys", CreateAPIKey)
+
+	w := doJSON(t, r, http.MethodPost, "/api-keys", gin.H{
+		"name":   "export",
+		"scopes": []string{models.PermReportsExport},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var count int64
+	database.DB.Model(&models.APIKey{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d keys created", count)
+	}
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"school-attendance/database"
 	"school-attendance/models"
@@ -17,10 +19,13 @@ type AttendanceRequest struct {
 	Status    string `json:"status"`
 	Notes     string `json:"notes"`
 	Subject   string `json:"subject"`
+	Period    int    `json:"period"` // lesson period number, 0 for the daily record
+	Reason    string `json:"reason"` // why an existing record was changed, kept in its history
 }
 
 type CheckInRequest struct {
 	Subject string `json:"subject"`
+	Period  int    `json:"period"` // defaults to the lesson in progress when a subject is given
 }
 
 func CheckIn(c *gin.Context) {
@@ -37,49 +42,158 @@ func CheckIn(c *gin.Context) {
 		return
 	}
 
-	today := time.Now().Format("2006-01-02")
-	todayTime, _ := time.Parse("2006-01-02", today)
+	var student models.Student
+	if err := database.DB.First(&student, studentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	if rejectLockedCheckIn(c, student.ID, time.Now()) {
+		return
+	}
 
-	// Check if already checked in today
-	var existingAttendance models.Attendance
-	err := database.DB.Where("student_id = ? AND date = ?", studentID, todayTime).First(&existingAttendance).Error
-	
-	if err == nil {
-		// Update existing record
-		now := time.Now()
-		existingAttendance.CheckInTime = &now
-		existingAttendance.Status = models.StatusPresent
-		existingAttendance.Subject = req.Subject
-		
-		if err := database.DB.Save(&existingAttendance).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update attendance"})
-			return
+	period, err := checkInPeriod(req.Period, req.Subject, time.Now())
+	if err != nil {
+		periodError(c, err)
+		return
+	}
+
+	attendance, created, err := recordCheckIn(attendanceDB(c, "Check-in"), student.ID, newCheckIn(student, req.Subject, period, time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attendance"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	c.JSON(status, gin.H{
+		"message": "Check-in successful",
+		"attendance": attendance,
+	})
+}
+
+// checkIn is an arrival to record, with its status worked out before
+// recordCheckIn opens a transaction.
+type checkIn struct {
+	Subject     string
+	Period      int // lesson period number, 0 for the daily record
+	At          time.Time
+	Status      string
+	LateMinutes int
+}
+
+// newCheckIn marks an arrival at at present, or late according to the bell
+// schedule or, when period is set, the lesson's start.
+func newCheckIn(student models.Student, subject string, period *models.LessonPeriod, at time.Time) checkIn {
+	in := checkIn{Subject: subject, At: at}
+	in.Status, in.LateMinutes = arrivalStatus(student.Grade, at)
+	if period != nil {
+		in.Period = period.Number
+		in.Status, in.LateMinutes = lessonArrivalStatus(period, at)
+	}
+	return in
+}
+
+// recordCheckIn records in for the student's lesson period or day; created
+// reports whether a new row was inserted. A repeated or concurrent check-in
+// returns the slot's existing record unchanged, only filling in its check-in
+// time when it has none. db may be a transaction: recordCheckIn reads
+// nothing outside it.
+func recordCheckIn(db *gorm.DB, studentID uint, in checkIn) (*models.Attendance, bool, error) {
+	todayTime, _ := time.Parse("2006-01-02", in.At.Format("2006-01-02"))
+	now := in.At
+
+	var attendance models.Attendance
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if already checked in for this period today
+		err := tx.Where("student_id = ? AND date = ? AND period = ?", studentID, todayTime, in.Period).First(&attendance).Error
+		if err == gorm.ErrRecordNotFound {
+			attendance = models.Attendance{
+				StudentID:   studentID,
+				Date:        todayTime,
+				CheckInTime: &now,
+				Status:      in.Status,
+				LateMinutes: in.LateMinutes,
+				Subject:     in.Subject,
+				Period:      in.Period,
+			}
+			// The savepoint keeps the transaction usable when a concurrent
+			// check-in inserted the slot first and the unique index rejects
+			// this row; that record is returned below instead
+			err = tx.Transaction(func(sp *gorm.DB) error {
+				return sp.Create(&attendance).Error
+			})
+			if err == nil {
+				created = true
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrDuplicatedKey) {
+				return err
+			}
+			attendance = models.Attendance{}
+			err = tx.Where("student_id = ? AND date = ? AND period = ?", studentID, todayTime, in.Period).First(&attendance).Error
+		}
+		if err != nil {
+			return err
 		}
-		
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Check-in successful",
-			"attendance": existingAttendance,
-		})
+
+		if attendance.CheckInTime != nil {
+			return nil
+		}
+		attendance.CheckInTime = &now
+		return tx.Save(&attendance).Error
+	})
+	return &attendance, created, err
+}
+
+// CheckInOnBehalf lets a kiosk or staff member check a student in by
+// student number, e.g. after scanning a student card at the gate.
+func CheckInOnBehalf(c *gin.Context) {
+	var req struct {
+		StudentID string `json:"student_id" binding:"required"`
+		Subject   string `json:"subject"`
+		Period    int    `json:"period"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create new attendance record
-	now := time.Now()
-	attendance := models.Attendance{
-		StudentID:   studentID,
-		Date:        todayTime,
-		CheckInTime: &now,
-		Status:      models.StatusPresent,
-		Subject:     req.Subject,
+	var student models.Student
+	if err := database.DB.Where("student_id = ? AND is_active = ?", req.StudentID, true).First(&student).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	if rejectLockedCheckIn(c, student.ID, time.Now()) {
+		return
 	}
 
-	if err := database.DB.Create(&attendance).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attendance record"})
+	period, err := checkInPeriod(req.Period, req.Subject, time.Now())
+	if err != nil {
+		periodError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Check-in successful",
+	attendance, created, err := recordCheckIn(attendanceDB(c, "Check-in on behalf"), student.ID, newCheckIn(student, req.Subject, period, time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attendance"})
+		return
+	}
+
+	// A repeated check-in returns the existing record without notifying again
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		recordAudit(c, AuditCreate, "attendance", attendance.ID, nil, attendance)
+		SendAttendanceNotification(student.Name, arrivalLabel(attendance.Status), time.Now())
+	}
+
+	c.JSON(status, gin.H{
+		"message":    "Check-in successful",
+		"student":    student,
 		"attendance": attendance,
 	})
 }
@@ -95,8 +209,10 @@ func CheckOut(c *gin.Context) {
 	today := time.Now().Format("2006-01-02")
 	todayTime, _ := time.Parse("2006-01-02", today)
 
+	// Prefer the daily record, otherwise close the last lesson of the day
 	var attendance models.Attendance
-	if err := database.DB.Where("student_id = ? AND date = ?", studentID, todayTime).First(&attendance).Error; err != nil {
+	if err := database.DB.Where("student_id = ? AND date = ?", studentID, todayTime).
+		Order("period = 0 DESC, period DESC").First(&attendance).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "No check-in record found for today"})
 			return
@@ -108,7 +224,7 @@ func CheckOut(c *gin.Context) {
 	now := time.Now()
 	attendance.CheckOutTime = &now
 
-	if err := database.DB.Save(&attendance).Error; err != nil {
+	if err := attendanceDB(c, "Check-out").Save(&attendance).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update attendance"})
 		return
 	}
@@ -153,7 +269,7 @@ func GetMyAttendance(c *gin.Context) {
 
 	query.Model(&models.Attendance{}).Count(&total)
 	
-	if err := query.Offset(offset).Limit(limit).Order("date DESC").Find(&attendances).Error; err != nil {
+	if err := query.Offset(offset).Limit(limit).Order("date DESC, period").Find(&attendances).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance records"})
 		return
 	}
@@ -180,12 +296,27 @@ func CreateAttendance(c *gin.Context) {
 		return
 	}
 
-	// Check if attendance already exists for this student and date
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !allowAttendance(c, scope, req.StudentID, req.Subject) {
+		return
+	}
+
+	if req.Period > 0 {
+		if _, err := checkInPeriod(req.Period, "", date); err != nil {
+			periodError(c, err)
+			return
+		}
+	}
+
+	// Check if attendance already exists for this student, date and period
 	var existingAttendance models.Attendance
-	err = database.DB.Where("student_id = ? AND date = ?", req.StudentID, date).First(&existingAttendance).Error
+	err = database.DB.Where("student_id = ? AND date = ? AND period = ?", req.StudentID, date, req.Period).First(&existingAttendance).Error
 	
 	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Attendance record already exists for this date"})
+		c.JSON(http.StatusConflict, gin.H{"error": "Attendance record already exists for this date and period"})
 		return
 	}
 
@@ -195,13 +326,30 @@ func CreateAttendance(c *gin.Context) {
 		Status:    req.Status,
 		Notes:     req.Notes,
 		Subject:   req.Subject,
+		Period:    req.Period,
 	}
 
-	if err := database.DB.Create(&attendance).Error; err != nil {
+	lock, err := studentLock(database.DB, req.StudentID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if lock != nil {
+		submitCorrection(c, lock, nil, attendance, req.Reason)
+		return
+	}
+
+	if err := attendanceDB(c, req.Reason).Create(&attendance).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Attendance record already exists for this date and period"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attendance record"})
 		return
 	}
 
+	recordAudit(c, AuditCreate, "attendance", attendance.ID, nil, attendance)
+
 	// Load student information
 	database.DB.Preload("Student").First(&attendance, attendance.ID)
 
@@ -232,6 +380,16 @@ func UpdateAttendance(c *gin.Context) {
 		return
 	}
 
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !allowAttendance(c, scope, attendance.StudentID, attendance.Subject) {
+		return
+	}
+
+	before := attendance
+
 	// Update fields
 	if req.Status != "" {
 		attendance.Status = req.Status
@@ -240,14 +398,30 @@ func UpdateAttendance(c *gin.Context) {
 		attendance.Notes = req.Notes
 	}
 	if req.Subject != "" {
+		if !allowAttendance(c, scope, attendance.StudentID, req.Subject) {
+			return
+		}
 		attendance.Subject = req.Subject
 	}
 
-	if err := database.DB.Save(&attendance).Error; err != nil {
+	// Locked records change through an approved correction instead
+	lock, err := studentLock(database.DB, attendance.StudentID, attendance.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if lock != nil {
+		submitCorrection(c, lock, &before, attendance, req.Reason)
+		return
+	}
+
+	if err := attendanceDB(c, req.Reason).Save(&attendance).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update attendance"})
 		return
 	}
 
+	recordAudit(c, AuditUpdate, "attendance", attendance.ID, before, attendance)
+
 	// Load student information
 	database.DB.Preload("Student").First(&attendance, attendance.ID)
 
@@ -261,22 +435,36 @@ func GetAllAttendance(c *gin.Context) {
 	grade := c.Query("grade")
 	date := c.Query("date")
 	status := c.Query("status")
+	period := c.Query("period")
 	
 	offset := (page - 1) * limit
 
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
 	query := database.DB.Preload("Student")
+
+	if class != "" || grade != "" || !scope.All {
+		query = query.Joins("JOIN students ON attendances.student_id = students.id")
+	}
+	query = scope.ScopeAttendance(query, "students.class", "attendances.subject")
 	
 	if class != "" {
-		query = query.Joins("JOIN students ON attendances.student_id = students.id").Where("students.class = ?", class)
+		query = query.Where("students.class = ?", class)
 	}
 	if grade != "" {
-		query = query.Joins("JOIN students ON attendances.student_id = students.id").Where("students.grade = ?", grade)
+		query = query.Where("students.grade = ?", grade)
 	}
 	if date != "" {
-		query = query.Where("date = ?", date)
+		query = query.Where("attendances.date = ?", date)
 	}
 	if status != "" {
-		query = query.Where("status = ?", status)
+		query = query.Where("attendances.status = ?", status)
+	}
+	if period != "" {
+		query = query.Where("attendances.period = ?", period)
 	}
 
 	var attendances []models.Attendance
@@ -284,7 +472,7 @@ func GetAllAttendance(c *gin.Context) {
 
 	query.Model(&models.Attendance{}).Count(&total)
 	
-	if err := query.Offset(offset).Limit(limit).Order("date DESC, id DESC").Find(&attendances).Error; err != nil {
+	if err := query.Offset(offset).Limit(limit).Order("attendances.date DESC, attendances.period, attendances.id DESC").Find(&attendances).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance records"})
 		return
 	}
@@ -297,52 +485,265 @@ func GetAllAttendance(c *gin.Context) {
 	})
 }
 
-func GetAttendanceStats(c *gin.Context) {
-	studentIDParam := c.Query("student_id")
+// rollupAttendance loads the records matched by query and rolls them up
+// into one entry per student and day.
+func rollupAttendance(query *gorm.DB) ([]models.DailyAttendance, error) {
+	var records []models.Attendance
+	if err := query.Order("attendances.student_id, attendances.date, attendances.period").
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	days := []models.DailyAttendance{}
+	var studentIDs []uint
+	for start := 0; start < len(records); {
+		end := start + 1
+		for end < len(records) && records[end].StudentID == records[start].StudentID &&
+			records[end].Date.Equal(records[start].Date) {
+			end++
+		}
+		days = append(days, models.RollupDay(records[start:end]))
+		if len(studentIDs) == 0 || studentIDs[len(studentIDs)-1] != records[start].StudentID {
+			studentIDs = append(studentIDs, records[start].StudentID)
+		}
+		start = end
+	}
+	if len(days) == 0 {
+		return days, nil
+	}
+
+	var students []models.Student
+	if err := database.DB.Unscoped().Select("id", "name").Where("id IN ?", studentIDs).Find(&students).Error; err != nil {
+		return nil, err
+	}
+	names := map[uint]string{}
+	for _, s := range students {
+		names[s.ID] = s.Name
+	}
+	for i := range days {
+		days[i].StudentName = names[days[i].StudentID]
+	}
+	return days, nil
+}
+
+// GetDailyAttendance returns each student's day computed from their lesson
+// periods (?date= or ?start_date=&end_date=, default today).
+func GetDailyAttendance(c *gin.Context) {
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
+	if date := c.Query("date"); date != "" {
+		startDate, endDate = date, date
+	}
+	if startDate == "" || endDate == "" {
+		today := time.Now().Format("2006-01-02")
+		startDate, endDate = today, today
+	}
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+		return
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+		return
+	}
 
-	query := `
-		SELECT 
-			s.id as student_id,
-			s.name as student_name,
-			COUNT(a.id) as total_days,
-			COUNT(CASE WHEN a.status = 'present' THEN 1 END) as present_days,
-			COUNT(CASE WHEN a.status = 'absent' THEN 1 END) as absent_days,
-			COUNT(CASE WHEN a.status = 'late' THEN 1 END) as late_days,
-			ROUND((COUNT(CASE WHEN a.status = 'present' THEN 1 END) * 100.0) / 
-				  NULLIF(COUNT(a.id), 0), 2) as attendance_rate
-		FROM students s
-		LEFT JOIN attendances a ON s.id = a.student_id
-	`
-
-	var args []interface{}
-	var whereConditions []string
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
 
-	if studentIDParam != "" {
-		whereConditions = append(whereConditions, "s.id = ?")
-		args = append(args, studentIDParam)
+	query := database.DB.Model(&models.Attendance{}).
+		Joins("JOIN students ON attendances.student_id = students.id").
+		Where("attendances.date BETWEEN ? AND ?", start, end)
+	query = scope.ScopeAttendance(query, "students.class", "attendances.subject")
+
+	if class := c.Query("class"); class != "" {
+		query = query.Where("students.class = ?", class)
+	}
+	if grade := c.Query("grade"); grade != "" {
+		query = query.Where("students.grade = ?", grade)
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("attendances.student_id = ?", studentID)
 	}
 
-	if startDate != "" && endDate != "" {
-		whereConditions = append(whereConditions, "a.date BETWEEN ? AND ?")
-		args = append(args, startDate, endDate)
+	days, err := rollupAttendance(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance records"})
+		return
 	}
 
-	if len(whereConditions) > 0 {
-		query += " WHERE " + whereConditions[0]
-		for i := 1; i < len(whereConditions); i++ {
-			query += " AND " + whereConditions[i]
+	c.JSON(http.StatusOK, gin.H{
+		"start_date": startDate,
+		"end_date":   endDate,
+		"days":       days,
+	})
+}
+
+// statsRange resolves the period GetAttendanceStats covers: explicit
+// dates, a semester, a school year, or by default the current school year.
+// ranged is false when no period applies. The end never lies after today.
+func statsRange(c *gin.Context) (start, end time.Time, ranged, ok bool) {
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+
+	switch {
+	case startDate != "" && endDate != "":
+		start, end, ok = parseDateRange(c, startDate, endDate)
+		if !ok {
+			return
+		}
+	case c.Query("semester_id") != "":
+		var semester models.Semester
+		if err := database.DB.First(&semester, c.Query("semester_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Semester not found"})
+			return
+		}
+		start, end = semester.StartDate, semester.EndDate
+	case c.Query("school_year_id") != "":
+		var year models.SchoolYear
+		if err := database.DB.First(&year, c.Query("school_year_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "School year not found"})
+			return
 		}
+		start, end = year.StartDate, year.EndDate
+	default:
+		var year models.SchoolYear
+		today := dateOnly(time.Now())
+		if err := database.DB.Where("start_date <= ? AND end_date >= ?", today, today).First(&year).Error; err != nil {
+			return start, end, false, true
+		}
+		start, end = year.StartDate, year.EndDate
+	}
+
+	if today := dateOnly(time.Now()); end.After(today) {
+		end = today
 	}
+	return start, end, true, true
+}
+
+// GetAttendanceStats counts school days per student, each day rolled up
+// from its lesson periods. Within a range every school day since the
+// student was enrolled counts, so days without any record are absences;
+// records on holidays and other non-school days are ignored.
+func GetAttendanceStats(c *gin.Context) {
+	studentIDParam := c.Query("student_id")
 
-	query += " GROUP BY s.id, s.name ORDER BY s.name"
+	start, end, ranged, ok := statsRange(c)
+	if !ok {
+		return
+	}
 
-	var stats []models.AttendanceStats
-	if err := database.DB.Raw(query, args...).Scan(&stats).Error; err != nil {
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	studentQuery := scope.ScopeStudents(database.DB.Model(&models.Student{}), "class")
+	attendanceQuery := database.DB.Model(&models.Attendance{}).
+		Joins("JOIN students ON attendances.student_id = students.id")
+	// Only count the subjects the caller teaches
+	attendanceQuery = scope.ScopeAttendance(attendanceQuery, "students.class", "attendances.subject")
+
+	if studentIDParam != "" {
+		studentQuery = studentQuery.Where("id = ?", studentIDParam)
+		attendanceQuery = attendanceQuery.Where("attendances.student_id = ?", studentIDParam)
+	}
+	if ranged {
+		attendanceQuery = attendanceQuery.Where("attendances.date BETWEEN ? AND ?", start, end)
+	}
+
+	var students []models.Student
+	if err := studentQuery.Order("name").Find(&students).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance statistics"})
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
-}
\ No newline at end of file
+	days, err := rollupAttendance(attendanceQuery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance statistics"})
+		return
+	}
+
+	// Without a range the calendar only needs to cover the recorded days
+	calStart, calEnd := start, end
+	if !ranged {
+		calStart, calEnd = time.Now(), time.Time{}
+		for _, day := range days {
+			if day.Date.Before(calStart) {
+				calStart = day.Date
+			}
+			if day.Date.After(calEnd) {
+				calEnd = day.Date
+			}
+		}
+	}
+	cal, err := loadSchoolCalendar(calStart, calEnd)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load school calendar"})
+		return
+	}
+
+	var schoolDays []time.Time
+	if ranged {
+		schoolDays = cal.SchoolDays(start, end)
+	}
+
+	byStudent := map[uint]*models.AttendanceStats{}
+	firstDay := map[uint]time.Time{}
+	for _, day := range days {
+		if !cal.IsSchoolDay(day.Date) {
+			continue
+		}
+		stats := byStudent[day.StudentID]
+		if stats == nil {
+			stats = &models.AttendanceStats{StudentID: day.StudentID}
+			byStudent[day.StudentID] = stats
+			firstDay[day.StudentID] = day.Date
+		}
+		stats.TotalDays++
+		switch day.Status {
+		case models.StatusPresent:
+			stats.PresentDays++
+		case models.StatusAbsent:
+			stats.AbsentDays++
+		case models.StatusLate:
+			stats.LateDays++
+		case models.StatusExcused:
+			stats.ExcusedDays++
+		}
+	}
+
+	result := []models.AttendanceStats{}
+	for _, student := range students {
+		stats, found := byStudent[student.ID]
+		if !found {
+			stats = &models.AttendanceStats{StudentID: student.ID}
+		}
+		stats.StudentName = student.Name
+
+		if ranged {
+			// Count from enrolment, or from the first record if it is older
+			from := dateOnly(student.CreatedAt)
+			if first, ok := firstDay[student.ID]; ok && first.Before(from) {
+				from = first
+			}
+			stats.TotalDays = 0
+			for _, day := range schoolDays {
+				if !day.Before(from) {
+					stats.TotalDays++
+				}
+			}
+			stats.AbsentDays = stats.TotalDays - stats.PresentDays - stats.LateDays - stats.ExcusedDays
+		}
+
+		if stats.TotalDays > 0 {
+			stats.AttendanceRate = math.Round(float64(stats.PresentDays)*10000/float64(stats.TotalDays)) / 100
+		}
+		result = append(result, *stats)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RevertAttendanceRequest struct {
+	Version int    `json:"version" binding:"required,min=1"`
+	Reason  string `json:"reason" binding:"required"`
+}
+
+// attendanceDB returns a handle whose attendance writes are versioned with
+// the current user as editor. It is safe to reuse for several queries.
+func attendanceDB(c *gin.Context, reason string) *gorm.DB {
+	return models.WithEditor(database.DB, c.GetUint("user_id"), c.GetString("user_type"), reason).
+		Session(&gorm.Session{})
+}
+
+func parseAttendanceID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attendance ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parsePointInTime accepts RFC 3339 timestamps or a plain date, which is
+// taken as the end of that day.
+func parsePointInTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// GetAttendanceHistory lists every version of an attendance record. With
+// ?at=<time> it returns the version that was current at that moment.
+func GetAttendanceHistory(c *gin.Context) {
+	id, ok := parseAttendanceID(c)
+	if !ok {
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.All {
+		// Deleted records keep their history, so look them up unscoped
+		var attendance models.Attendance
+		if err := database.DB.Unscoped().First(&attendance, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attendance record not found"})
+			return
+		}
+		if !allowAttendance(c, scope, attendance.StudentID, attendance.Subject) {
+			return
+		}
+	}
+
+	if at := c.Query("at"); at != "" {
+		pointInTime, err := parsePointInTime(at)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format. Use YYYY-MM-DD or RFC 3339"})
+			return
+		}
+
+		var version models.AttendanceVersion
+		if err := database.DB.Where("attendance_id = ? AND created_at <= ?", id, pointInTime).
+			Order("version DESC").First(&version).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No version of this record existed at that time"})
+			return
+		}
+
+		c.JSON(http.StatusOK, version)
+		return
+	}
+
+	var versions []models.AttendanceVersion
+	if err := database.DB.Where("attendance_id = ?", id).Order("version ASC").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance history"})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attendance record not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attendance_id": id,
+		"versions":      versions,
+	})
+}
+
+// RevertAttendance restores the fields of an older version. The revert is
+// itself recorded as a new version so nothing is lost.
+func RevertAttendance(c *gin.Context) {
+	id, ok := parseAttendanceID(c)
+	if !ok {
+		return
+	}
+
+	var req RevertAttendanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var attendance models.Attendance
+	if err := database.DB.First(&attendance, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attendance record not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !allowAttendance(c, scope, attendance.StudentID, attendance.Subject) {
+		return
+	}
+
+	lock, err := studentLock(database.DB, attendance.StudentID, attendance.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if lock != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attendance is locked; request a correction instead"})
+		return
+	}
+
+	var version models.AttendanceVersion
+	if err := database.DB.Where("attendance_id = ? AND version = ?", id, req.Version).First(&version).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if !allowAttendance(c, scope, attendance.StudentID, version.Subject) {
+		return
+	}
+	if version.Operation == "delete" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot revert to a deleted version"})
+		return
+	}
+
+	before := attendance
+
+	attendance.Status = version.Status
+	attendance.LateMinutes = version.LateMinutes
+	attendance.Notes = version.Notes
+	attendance.Subject = version.Subject
+	attendance.CheckInTime = version.CheckInTime
+	attendance.CheckOutTime = version.CheckOutTime
+
+	if err := models.AsRevert(attendanceDB(c, req.Reason)).Save(&attendance).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert attendance"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "attendance", attendance.ID, before, attendance)
+
+	// Load student information
+	database.DB.Preload("Student").First(&attendance, attendance.ID)
+
+	c.JSON(http.StatusOK, attendance)
+}
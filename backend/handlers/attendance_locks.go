@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errCorrectionPending  = errors.New("a correction for this record is already pending")
+	errCorrectionReviewed = errors.New("correction is no longer pending")
+)
+
+type AttendanceLockRequest struct {
+	Class     string `json:"class" binding:"required"`
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+type CorrectionReviewRequest struct {
+	Note string `json:"note"`
+}
+
+// classLocks returns the locks of the class overlapping from through to.
+func classLocks(db *gorm.DB, class string, from, to time.Time) ([]models.AttendanceLock, error) {
+	var locks []models.AttendanceLock
+	err := db.Where("class = ? AND start_date <= ? AND end_date >= ?", class, to, from).
+		Order("start_date").Find(&locks).Error
+	return locks, err
+}
+
+// lockOn returns the lock covering day, or nil.
+func lockOn(locks []models.AttendanceLock, day time.Time) *models.AttendanceLock {
+	for i := range locks {
+		if locks[i].Covers(day) {
+			return &locks[i]
+		}
+	}
+	return nil
+}
+
+// studentLock returns the lock covering the student's class on day, or nil.
+func studentLock(db *gorm.DB, studentID uint, day time.Time) (*models.AttendanceLock, error) {
+	var locks []models.AttendanceLock
+	err := db.Select("attendance_locks.*").
+		Joins("JOIN students s ON s.class = attendance_locks.class").
+		Where("s.id = ? AND attendance_locks.start_date <= ? AND attendance_locks.end_date >= ?", studentID, day, day).
+		Limit(1).Find(&locks).Error
+	if err != nil || len(locks) == 0 {
+		return nil, err
+	}
+	return &locks[0], nil
+}
+
+// requestCorrection files a request to change a locked record to proposed,
+// or to add proposed when attendance is nil. Only one correction per
+// student, date and period may be pending at a time.
+func requestCorrection(tx *gorm.DB, lock *models.AttendanceLock, attendance *models.Attendance, proposed models.Attendance, reason string, userID uint, userType string) (*models.AttendanceCorrection, error) {
+	var count int64
+	if err := tx.Model(&models.AttendanceCorrection{}).
+		Where("status = ? AND student_id = ? AND date = ? AND period = ?",
+			models.CorrectionPending, proposed.StudentID, proposed.Date, proposed.Period).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errCorrectionPending
+	}
+
+	if proposed.Status == "" {
+		proposed.Status = models.StatusAbsent
+	}
+	correction := models.AttendanceCorrection{
+		LockID:          lock.ID,
+		StudentID:       proposed.StudentID,
+		Date:            proposed.Date,
+		Period:          proposed.Period,
+		NewStatus:       proposed.Status,
+		NewNotes:        proposed.Notes,
+		NewSubject:      proposed.Subject,
+		Reason:          reason,
+		Status:          models.CorrectionPending,
+		RequestedBy:     userID,
+		RequestedByType: userType,
+	}
+	if attendance != nil {
+		id := attendance.ID
+		correction.AttendanceID = &id
+		correction.OldStatus = attendance.Status
+		correction.OldNotes = attendance.Notes
+		correction.OldSubject = attendance.Subject
+	}
+
+	if err := tx.Create(&correction).Error; err != nil {
+		return nil, err
+	}
+	return &correction, nil
+}
+
+// notifyCorrectionRequested alerts the class's homeroom teachers, who
+// approve corrections by default.
+func notifyCorrectionRequested(class string, correction *models.AttendanceCorrection) {
+	var student models.Student
+	database.DB.Unscoped().Select("id", "name").First(&student, correction.StudentID)
+
+	notifyHomeroomTeachers(class, "attendance_correction", "Koreksi Presensi", fmt.Sprintf("Koreksi presensi %s tanggal %s menunggu persetujuan: %s",
+		student.Name, correction.Date.Format("02/01/2006"), correction.Reason))
+}
+
+// submitCorrection answers a write to locked attendance with 202 and the
+// correction request filed in its place.
+func submitCorrection(c *gin.Context, lock *models.AttendanceLock, attendance *models.Attendance, proposed models.Attendance, reason string) {
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attendance is locked; a reason is required to request a correction"})
+		return
+	}
+
+	correction, err := requestCorrection(database.DB, lock, attendance, proposed, reason, c.GetUint("user_id"), c.GetString("user_type"))
+	if err == errCorrectionPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "A correction for this record is already pending"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request correction"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "attendance_correction", correction.ID, nil, correction)
+	notifyCorrectionRequested(lock.Class, correction)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Attendance is locked; a correction request was submitted for approval",
+		"correction": correction,
+	})
+}
+
+// rejectLockedCheckIn answers 409 when the student's attendance for day is
+// locked. Check-ins cannot change a locked day; staff file a correction
+// through the attendance endpoints instead.
+func rejectLockedCheckIn(c *gin.Context, studentID uint, day time.Time) bool {
+	lock, err := studentLock(database.DB, studentID, dateOnly(day))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if lock != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attendance for today is locked; request a correction instead"})
+		return true
+	}
+	return false
+}
+
+func GetAttendanceLocks(c *gin.Context) {
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	query := scope.ScopeStudents(database.DB.Model(&models.AttendanceLock{}), "class")
+	if class := c.Query("class"); class != "" {
+		query = query.Where("class = ?", class)
+	}
+
+	var locks []models.AttendanceLock
+	if err := query.Order("start_date DESC, class").Find(&locks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance locks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, locks)
+}
+
+// CreateAttendanceLock locks a class for a range of past dates. Today
+// cannot be locked so check-ins keep working.
+func CreateAttendanceLock(c *gin.Context) {
+	var req AttendanceLockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok {
+		return
+	}
+	if !end.Before(dateOnly(time.Now())) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only dates before today can be locked"})
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.IsHomeroom(req.Class) {
+		denyClass(c)
+		return
+	}
+
+	existing, err := classLocks(database.DB, req.Class, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(existing) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The dates overlap an existing lock of this class", "lock": existing[0]})
+		return
+	}
+
+	lock := models.AttendanceLock{
+		Class:     req.Class,
+		StartDate: start,
+		EndDate:   end,
+		Reason:    req.Reason,
+		LockedBy:  c.GetUint("user_id"),
+	}
+	if err := database.DB.Create(&lock).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock attendance"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "attendance_lock", lock.ID, nil, lock)
+
+	c.JSON(http.StatusCreated, lock)
+}
+
+// DeleteAttendanceLock unlocks the range. Pending corrections stay open.
+func DeleteAttendanceLock(c *gin.Context) {
+	var lock models.AttendanceLock
+	if !findRecord(c, &lock, "Attendance lock") {
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.IsHomeroom(lock.Class) {
+		denyClass(c)
+		return
+	}
+
+	if err := database.DB.Delete(&lock).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock attendance"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "attendance_lock", lock.ID, lock, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attendance unlocked successfully"})
+}
+
+// GetAttendanceCorrections lists corrections for the caller's classes
+// (?status=&class=&student_id=).
+func GetAttendanceCorrections(c *gin.Context) {
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.AttendanceCorrection{}).
+		Joins("JOIN students ON students.id = attendance_corrections.student_id")
+	query = scope.ScopeStudents(query, "students.class")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("attendance_corrections.status = ?", status)
+	}
+	if class := c.Query("class"); class != "" {
+		query = query.Where("students.class = ?", class)
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("attendance_corrections.student_id = ?", studentID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var corrections []models.AttendanceCorrection
+	if err := query.Select("attendance_corrections.*").
+		Order("attendance_corrections.created_at DESC").
+		Offset(offset).Limit(limit).
+		Find(&corrections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch corrections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"corrections": corrections,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+	})
+}
+
+// findCorrection loads the correction and answers with 403 unless the
+// caller may see attendance for its subject in the student's class.
+func findCorrection(c *gin.Context) (*models.AttendanceCorrection, bool) {
+	var correction models.AttendanceCorrection
+	if !findRecord(c, &correction, "Correction") {
+		return nil, false
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return nil, false
+	}
+	if !allowAttendance(c, scope, correction.StudentID, correction.NewSubject) {
+		return nil, false
+	}
+	return &correction, true
+}
+
+func GetAttendanceCorrection(c *gin.Context) {
+	correction, ok := findCorrection(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, correction)
+}
+
+// ApproveAttendanceCorrection applies a pending correction. The requester
+// cannot approve their own correction.
+func ApproveAttendanceCorrection(c *gin.Context) {
+	reviewCorrection(c, models.CorrectionApproved)
+}
+
+// RejectAttendanceCorrection requires a note for the requester.
+func RejectAttendanceCorrection(c *gin.Context) {
+	reviewCorrection(c, models.CorrectionRejected)
+}
+
+func reviewCorrection(c *gin.Context, status string) {
+	correction, ok := findCorrection(c)
+	if !ok {
+		return
+	}
+
+	var req CorrectionReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status == models.CorrectionRejected && req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A note is required when rejecting a correction"})
+		return
+	}
+	if correction.Status != models.CorrectionPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Correction has already been " + correction.Status})
+		return
+	}
+
+	// Approvals need a person; an API key minted by the requester would
+	// otherwise count as the second user
+	reviewerID := c.GetUint("user_id")
+	reviewerType := c.GetString("user_type")
+	if reviewerType != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Corrections must be reviewed by an admin account"})
+		return
+	}
+	if correction.RequestedBy == reviewerID && correction.RequestedByType == reviewerType {
+		c.JSON(http.StatusForbidden, gin.H{"error": "A correction must be reviewed by someone other than the requester"})
+		return
+	}
+
+	before := *correction
+	now := time.Now()
+	correction.Status = status
+	correction.ReviewedBy = &reviewerID
+	correction.ReviewedAt = &now
+	correction.ReviewNote = req.Note
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if status == models.CorrectionApproved {
+			reason := fmt.Sprintf("Correction #%d: %s", correction.ID, correction.Reason)
+			db := models.WithEditor(tx, reviewerID, reviewerType, reason).Session(&gorm.Session{})
+			attendance, err := applyCorrection(db, correction)
+			if err != nil {
+				return err
+			}
+			correction.AttendanceID = &attendance.ID
+		}
+
+		result := tx.Model(correction).
+			Where("status = ?", models.CorrectionPending).
+			Select("status", "reviewed_by", "reviewed_at", "review_note", "attendance_id").
+			Updates(correction)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCorrectionReviewed
+		}
+		return nil
+	})
+	if err == errCorrectionReviewed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Correction has already been reviewed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review correction"})
+		return
+	}
+
+	action := AuditApprove
+	outcome := "disetujui"
+	if status == models.CorrectionRejected {
+		action = AuditReject
+		outcome = "ditolak"
+	}
+	recordAudit(c, action, "attendance_correction", correction.ID, before, correction)
+
+	message := fmt.Sprintf("Koreksi presensi #%d tanggal %s %s", correction.ID, correction.Date.Format("02/01/2006"), outcome)
+	if req.Note != "" {
+		message += ": " + req.Note
+	}
+	notifyUser(correction.RequestedBy, correction.RequestedByType, "attendance_correction", "Koreksi Presensi", message, "medium")
+
+	c.JSON(http.StatusOK, correction)
+}
+
+// applyCorrection writes the corrected values to the student's record for
+// the date and period, creating it if it does not exist (any more).
+func applyCorrection(db *gorm.DB, correction *models.AttendanceCorrection) (*models.Attendance, error) {
+	var attendance models.Attendance
+	err := db.Where("student_id = ? AND date = ? AND period = ?", correction.StudentID, correction.Date, correction.Period).
+		First(&attendance).Error
+	if err == gorm.ErrRecordNotFound {
+		attendance = models.Attendance{
+			StudentID: correction.StudentID,
+			Date:      correction.Date,
+			Period:    correction.Period,
+			Status:    correction.NewStatus,
+			Notes:     correction.NewNotes,
+			Subject:   correction.NewSubject,
+		}
+		return &attendance, db.Create(&attendance).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attendance.Status = correction.NewStatus
+	if attendance.Status != models.StatusLate {
+		attendance.LateMinutes = 0
+	}
+	attendance.Notes = correction.NewNotes
+	attendance.Subject = correction.NewSubject
+	return &attendance, db.Save(&attendance).Error
+}
+
+// CancelAttendanceCorrection withdraws the caller's own pending correction.
+func CancelAttendanceCorrection(c *gin.Context) {
+	correction, ok := findCorrection(c)
+	if !ok {
+		return
+	}
+	if correction.RequestedBy != c.GetUint("user_id") || correction.RequestedByType != c.GetString("user_type") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the requester can cancel a correction"})
+		return
+	}
+	if correction.Status != models.CorrectionPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending corrections can be cancelled"})
+		return
+	}
+
+	before := *correction
+	result := database.DB.Model(correction).Where("status = ?", models.CorrectionPending).Update("status", models.CorrectionCancelled)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel correction"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending corrections can be cancelled"})
+		return
+	}
+
+	recordAudit(c, AuditCancel, "attendance_correction", correction.ID, before, correction)
+
+	c.JSON(http.StatusOK, correction)
+}
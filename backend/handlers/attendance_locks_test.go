@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	testModels = append(testModels,
+		&models.AttendanceVersion{},
+		&models.Notification{},
+		&models.TeachingAssignment{},
+		&models.AttendanceLock{},
+		&models.AttendanceCorrection{},
+	)
+}
+
+// lockedAttendance creates a present record for yesterday in a class whose
+// yesterday is locked.
+func lockedAttendance(t *testing.T) models.Attendance {
+	t.Helper()
+	student := createTestStudent(t, "S001", "s001@school.id", "secret123")
+	yesterday := dateOnly(time.Now()).AddDate(0, 0, -1)
+
+	attendance := models.Attendance{StudentID: student.ID, Date: yesterday, Status: models.StatusPresent}
+	if err := database.DB.Create(&attendance).Error; err != nil {
+		t.Fatal(err)
+	}
+	lock := models.AttendanceLock{Class: student.Class, StartDate: yesterday, EndDate: yesterday}
+	if err := database.DB.Create(&lock).Error; err != nil {
+		t.Fatal(err)
+	}
+	return attendance
+}
+
+// lockRouter serves attendance updates and correction reviews as the given
+// admin, who may see every class.
+func lockRouter(adminID uint) *gin.Engine {
+	return lockRouterAs(adminID, "admin")
+}
+
+func lockRouterAs(userID uint, userType string) *gin.Engine {
+	r := gin.New()
+	r.Use(asUser(userID, userType), withPermissions(models.PermAll))
+	r.PUT("/attendance/:id", UpdateAttendance)
+	r.POST("/corrections/:id/approve", ApproveAttendanceCorrection)
+	r.POST("/corrections/:id/reject", RejectAttendanceCorrection)
+	return r
+}
+
+func TestUpdateLockedAttendanceFilesCorrection(t *testing.T) {
+	setupTestDB(t)
+	attendance := lockedAttendance(t)
+	requester := createTestAdmin(t, "wali", "wali@school.id", "secret123")
+	reviewer := createTestAdmin(t, "kepsek", "kepsek@school.id", "secret123")
+
+	path := "/attendance/" + strconv.FormatUint(uint64(attendance.ID), 10)
+	r := lockRouter(requester.ID)
+
+	if w := doJSON(t, r, http.MethodPut, path, gin.H{"status": models.StatusExcused}); w.Code != http.StatusBadRequest {
+		t.Fatalf("without reason: %d, want 400", w.Code)
+	}
+
+	w := doJSON(t, r, http.MethodPut, path, gin.H{"status": models.StatusExcused, "reason": "Surat dokter menyusul"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	var filed struct {
+		Correction models.AttendanceCorrection `json:"correction"`
+	}
+	decodeJSON(t, w, &filed)
+	correction := filed.Correction
+	if correction.Status != models.CorrectionPending || correction.OldStatus != models.StatusPresent || correction.NewStatus != models.StatusExcused {
+		t.Errorf("correction = %+v", correction)
+	}
+
+	var stored models.Attendance
+	database.DB.First(&stored, attendance.ID)
+	if stored.Status != models.StatusPresent {
+		t.Errorf("locked record changed to %s before approval", stored.Status)
+	}
+
+	if w := doJSON(t, r, http.MethodPut, path, gin.H{"status": models.StatusAbsent, "reason": "lagi"}); w.Code != http.StatusConflict {
+		t.Errorf("second correction: %d, want 409", w.Code)
+	}
+
+	approve := "/corrections/" + strconv.FormatUint(uint64(correction.ID), 10) + "/approve"
+	if w := doJSON(t, r, http.MethodPost, approve, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("self approval: %d, want 403", w.Code)
+	}
+	// An API key minted by the requester is not a second person
+	if w := doJSON(t, lockRouterAs(1, "api_key"), http.MethodPost, approve, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("api key approval: %d, want 403", w.Code)
+	}
+	database.DB.First(&stored, attendance.ID)
+	if stored.Status != models.StatusPresent {
+		t.Fatalf("self approval applied the correction")
+	}
+
+	if w := doJSON(t, lockRouter(reviewer.ID), http.MethodPost, approve, nil); w.Code != http.StatusOK {
+		t.Fatalf("approval: %d %s", w.Code, w.Body.String())
+	}
+	database.DB.First(&stored, attendance.ID)
+	if stored.Status != models.StatusExcused {
+		t.Errorf("status = %s after approval, want %s", stored.Status, models.StatusExcused)
+	}
+
+	database.DB.First(&correction, correction.ID)
+	if correction.Status != models.CorrectionApproved || correction.ReviewedBy == nil || *correction.ReviewedBy != reviewer.ID {
+		t.Errorf("correction = %+v", correction)
+	}
+	if w := doJSON(t, lockRouter(reviewer.ID), http.MethodPost, approve, nil); w.Code != http.StatusConflict {
+		t.Errorf("second approval: %d, want 409", w.Code)
+	}
+}
+
+func TestRejectCorrectionRequiresNote(t *testing.T) {
+	setupTestDB(t)
+	attendance := lockedAttendance(t)
+	requester := createTestAdmin(t, "wali", "wali@school.id", "secret123")
+	reviewer := createTestAdmin(t, "kepsek", "kepsek@school.id", "secret123")
+
+	w := doJSON(t, lockRouter(requester.ID), http.MethodPut, "/attendance/"+strconv.FormatUint(uint64(attendance.ID), 10),
+		gin.H{"status": models.StatusAbsent, "reason": "Salah input"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	var filed struct {
+		Correction models.AttendanceCorrection `json:"correction"`
+	}
+	decodeJSON(t, w, &filed)
+
+	reject := "/corrections/" + strconv.FormatUint(uint64(filed.Correction.ID), 10) + "/reject"
+	r := lockRouter(reviewer.ID)
+	if w := doJSON(t, r, http.MethodPost, reject, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("without note: %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, reject, gin.H{"note": "Siswa hadir"}); w.Code != http.StatusOK {
+		t.Fatalf("reject: %d %s", w.Code, w.Body.String())
+	}
+
+	var stored models.Attendance
+	database.DB.First(&stored, attendance.ID)
+	if stored.Status != models.StatusPresent {
+		t.Errorf("rejected correction applied: %s", stored.Status)
+	}
+}
+
+func TestUpdateUnlockedAttendance(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S001", "s001@school.id", "secret123")
+	admin := createTestAdmin(t, "wali", "wali@school.id", "secret123")
+	attendance := models.Attendance{StudentID: student.ID, Date: dateOnly(time.Now()), Status: models.StatusPresent}
+	database.DB.Create(&attendance)
+
+	w := doJSON(t, lockRouter(admin.ID), http.MethodPut, "/attendance/"+strconv.FormatUint(uint64(attendance.ID), 10),
+		gin.H{"status": models.StatusLate})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+
+	var count int64
+	database.DB.Model(&models.AttendanceCorrection{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d corrections filed for an unlocked day", count)
+	}
+}
+
+func TestCheckInOnLockedDayRejected(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S001", "s001@school.id", "secret123")
+	today := dateOnly(time.Now())
+	if err := database.DB.Create(&models.AttendanceLock{Class: student.Class, StartDate: today, EndDate: today}).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := models.QRSession{SessionCode: "QR-1", Subject: "Matematika", ExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	database.DB.Create(&session)
+
+	r := gin.New()
+	r.POST("/checkin", asUser(student.ID, "student"), CheckIn)
+	r.POST("/qr/scan", asUser(student.ID, "student"), ScanQRCode)
+	r.POST("/checkin-on-behalf", asUser(1, "admin"), CheckInOnBehalf)
+
+	for path, body := range map[string]gin.H{
+		"/checkin":           {},
+		"/qr/scan":           {"qr_data": qrPayload(t, session)},
+		"/checkin-on-behalf": {"student_id": student.StudentID},
+	} {
+		if w := doJSON(t, r, http.MethodPost, path, body); w.Code != http.StatusConflict {
+			t.Errorf("%s: %d %s, want 409", path, w.Code, w.Body.String())
+		}
+	}
+	if n := countAttendance(t); n != 0 {
+		t.Errorf("%d attendance rows on a locked day, want 0", n)
+	}
+}
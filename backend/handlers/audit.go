@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditCreate     = "create"
+	AuditUpdate     = "update"
+	AuditDelete     = "delete"
+	AuditDeactivate = "deactivate"
+	AuditLink       = "link"
+	AuditUnlink     = "unlink"
+	AuditRevoke     = "revoke"
+	AuditSync       = "sync"
+	AuditApprove    = "approve"
+	AuditReject     = "reject"
+	AuditCancel     = "cancel"
+
+	AuditPasswordReset = "password_reset"
+)
+
+// auditIgnoredFields are bookkeeping columns left out of the diff.
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+	"created_at": true,
+}
+
+type fieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// toAuditMap flattens a value into its JSON representation so snapshots
+// never contain fields hidden from the API such as password hashes.
+func toAuditMap(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+
+	// Drop preloaded relations; they are audited on their own
+	for key, value := range m {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			delete(m, key)
+		}
+	}
+	return m
+}
+
+func diffAuditMaps(before, after map[string]interface{}) map[string]fieldChange {
+	changes := make(map[string]fieldChange)
+	for key, to := range after {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		from, ok := before[key]
+		if !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = fieldChange{From: from, To: to}
+		}
+	}
+	for key, from := range before {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if _, ok := after[key]; !ok {
+			changes[key] = fieldChange{From: from, To: nil}
+		}
+	}
+	return changes
+}
+
+func encodeAuditMap(m map[string]interface{}) string {
+	if m == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(m)
+	return string(raw)
+}
+
+// recordAudit stores who changed what. before is nil for creates and after
+// is nil for deletes. Failures are logged and never fail the request.
+func recordAudit(c *gin.Context, action, entityType string, entityID interface{}, before, after interface{}) {
+	recordAuditTx(database.DB, c, action, entityType, entityID, before, after)
+}
+
+// recordAuditTx is recordAudit inside an existing transaction.
+func recordAuditTx(tx *gorm.DB, c *gin.Context, action, entityType string, entityID interface{}, before, after interface{}) {
+	beforeMap := toAuditMap(before)
+	afterMap := toAuditMap(after)
+	changes, _ := json.Marshal(diffAuditMaps(beforeMap, afterMap))
+
+	entry := models.AuditLog{
+		ActorID:    c.GetUint("user_id"),
+		ActorType:  c.GetString("user_type"),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     encodeAuditMap(beforeMap),
+		After:      encodeAuditMap(afterMap),
+		Changes:    string(changes),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+func auditQuery(c *gin.Context) *gorm.DB {
+	query := database.DB.Model(&models.AuditLog{})
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if actorType := c.Query("actor_type"); actorType != "" {
+		query = query.Where("actor_type = ?", actorType)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("created_at < DATE(?, '+1 day')", endDate)
+	}
+
+	return query
+}
+
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := auditQuery(c)
+
+	var logs []models.AuditLog
+	var total int64
+
+	query.Count(&total)
+
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC, id DESC").Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":  logs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// ExportAuditLogs streams the filtered audit trail as CSV for inspections.
+func ExportAuditLogs(c *gin.Context) {
+	var logs []models.AuditLog
+	if err := auditQuery(c).Order("created_at ASC, id ASC").Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit_log_%s.csv", time.Now().Format("20060102")))
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"Waktu", "ID Pelaku", "Tipe Pelaku", "Aksi", "Entitas", "ID Entitas", "Perubahan", "IP", "User Agent"})
+	for _, entry := range logs {
+		writer.Write([]string{
+			entry.CreatedAt.Format("2006-01-02 15:04:05"),
+			strconv.FormatUint(uint64(entry.ActorID), 10),
+			entry.ActorType,
+			entry.Action,
+			entry.EntityType,
+			entry.EntityID,
+			entry.Changes,
+			entry.IPAddress,
+			entry.UserAgent,
+		})
+	}
+	writer.Flush()
+}
@@ -1,9 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"school-attendance/database"
-	"school-attendance/middleware"
 	"school-attendance/models"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +20,7 @@ type StudentRegisterRequest struct {
 	StudentID   string `json:"student_id" binding:"required"`
 	Name        string `json:"name" binding:"required"`
 	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=6"`
+	Password    string `json:"password" binding:"required"`
 	Class       string `json:"class" binding:"required"`
 	Grade       string `json:"grade" binding:"required"`
 	PhoneNumber string `json:"phone_number"`
@@ -28,8 +28,10 @@ type StudentRegisterRequest struct {
 }
 
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  interface{} `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    int64       `json:"expires_in"` // access token lifetime in seconds
+	User         interface{} `json:"user"`
 }
 
 func StudentLogin(c *gin.Context) {
@@ -39,9 +41,14 @@ func StudentLogin(c *gin.Context) {
 		return
 	}
 
+	if !checkLoginThrottle(c, "student", req.Email) {
+		return
+	}
+
 	var student models.Student
 	if err := database.DB.Where("email = ? AND is_active = ?", req.Email, true).First(&student).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			recordLoginFailure(c, "student", req.Email, nil)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -49,21 +56,21 @@ func StudentLogin(c *gin.Context) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(student.Password), []byte(req.Password)); err != nil {
+	if !checkPassword(student.Password, student.DirectoryDN, req.Password) {
+		recordLoginFailure(c, "student", req.Email, &student.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := middleware.GenerateToken(student.ID, "student")
+	recordLoginSuccess("student", req.Email)
+
+	response, err := issueTokens(c, student.ID, "student", student)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  student,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 func AdminLogin(c *gin.Context) {
@@ -73,9 +80,14 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
+	if !checkLoginThrottle(c, "admin", req.Email) {
+		return
+	}
+
 	var admin models.Admin
 	if err := database.DB.Where("email = ? AND is_active = ?", req.Email, true).First(&admin).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			recordLoginFailure(c, "admin", req.Email, nil)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -83,21 +95,46 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(req.Password)); err != nil {
+	if !checkPassword(admin.Password, admin.DirectoryDN, req.Password) {
+		recordLoginFailure(c, "admin", req.Email, &admin.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := middleware.GenerateToken(admin.ID, "admin")
+	// With 2FA the throttle is only cleared once the second factor checks
+	// out, so the password alone cannot reset the guess budget
+	if !admin.TOTPEnabled {
+		recordLoginSuccess("admin", req.Email)
+	}
+
+	completeAdminLogin(c, admin)
+}
+
+// completeAdminLogin finishes a login whose first factor was accepted.
+// Admins with 2FA get a challenge instead of tokens.
+func completeAdminLogin(c *gin.Context, admin models.Admin) {
+	if admin.TOTPEnabled {
+		mfaToken, err := startMFAChallenge(admin.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int64(MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	response, err := issueTokens(c, admin.ID, "admin", admin)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  admin,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 func StudentRegister(c *gin.Context) {
@@ -106,6 +143,9 @@ func StudentRegister(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkPasswordLength(c, req.Password) {
+		return
+	}
 
 	// Check if student ID or email already exists
 	var existingStudent models.Student
@@ -138,16 +178,13 @@ func StudentRegister(c *gin.Context) {
 		return
 	}
 
-	token, err := middleware.GenerateToken(student.ID, "student")
+	response, err := issueTokens(c, student.ID, "student", student)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  student,
-	})
+	c.JSON(http.StatusCreated, response)
 }
 
 func GetProfile(c *gin.Context) {
@@ -173,7 +210,117 @@ func GetProfile(c *gin.Context) {
 			return
 		}
 		c.JSON(http.StatusOK, admin)
+	} else if userType == "parent" {
+		var parent models.Parent
+		if err := database.DB.First(&parent, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent not found"})
+			return
+		}
+		c.JSON(http.StatusOK, parent)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user type"})
 	}
-}
\ No newline at end of file
+}
+
+// MinPasswordLength applies to every password a user chooses or an admin
+// sets for them.
+const MinPasswordLength = 8
+
+// checkPasswordLength answers with 400 when the password is too short.
+func checkPasswordLength(c *gin.Context, password string) bool {
+	if len(password) < MinPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", MinPasswordLength)})
+		return false
+	}
+	return true
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword rotates the authenticated user's password, signs out all
+// other sessions and returns a fresh token pair.
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkPasswordLength(c, req.NewPassword) {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	userType := c.GetString("user_type")
+
+	model := accountModel(userType)
+	if model == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user type"})
+		return
+	}
+
+	if err := database.DB.First(model, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var currentHash, directoryDN string
+	switch account := model.(type) {
+	case *models.Student:
+		currentHash, directoryDN = account.Password, account.DirectoryDN
+	case *models.Admin:
+		currentHash, directoryDN = account.Password, account.DirectoryDN
+	case *models.Parent:
+		currentHash = account.Password
+	}
+
+	if passwordManagedByDirectory(directoryDN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the school directory"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(currentHash), []byte(req.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current password"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	updates := map[string]interface{}{"password": string(hashedPassword)}
+	if userType == "admin" {
+		updates["must_change_password"] = false
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := revokeAccessToken(tx, c.GetString("token_id"), userID, userType, "password_change"); err != nil {
+			return err
+		}
+		return revokeAllUserTokens(tx, userID, userType, "password_change")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	database.DB.First(model, userID)
+	response, err := issueTokens(c, userID, userType, model)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
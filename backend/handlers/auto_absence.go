@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"school-attendance/database"
+	"school-attendance/models"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AutoAbsenceCheckInterval is how often the scheduler looks at the clock.
+const AutoAbsenceCheckInterval = time.Minute
+
+var (
+	autoAbsenceMu sync.Mutex
+
+	errAutoAbsenceRunning = errors.New("auto absence is already running")
+	errFutureDate         = errors.New("cannot mark absences for a future date")
+)
+
+// AbsentStudent is one student the job marked, or would mark, absent.
+type AbsentStudent struct {
+	ID        uint   `json:"id"`
+	StudentID string `json:"student_id"`
+	Name      string `json:"name"`
+	Class     string `json:"class"`
+}
+
+// AutoAbsenceReport is returned by the endpoint and the CLI.
+type AutoAbsenceReport struct {
+	RunID         uint            `json:"run_id"`
+	Date          string          `json:"date"`
+	DryRun        bool            `json:"dry_run"`
+	SkippedReason string          `json:"skipped_reason,omitempty"`
+	Marked        []AbsentStudent `json:"marked"`
+}
+
+// autoAbsenceCutoff reads AUTO_ABSENCE_CUTOFF (HH:MM). Empty disables the
+// scheduled job; manual runs still work.
+func autoAbsenceCutoff() (string, bool) {
+	cutoff := os.Getenv("AUTO_ABSENCE_CUTOFF")
+	if cutoff == "" {
+		return "", false
+	}
+	if _, err := time.Parse("15:04", cutoff); err != nil {
+		log.Printf("Invalid AUTO_ABSENCE_CUTOFF %q, auto absence disabled", cutoff)
+		return "", false
+	}
+	return cutoff, true
+}
+
+// RunAutoAbsence marks every active student without an attendance record
+// on day as absent and alerts their parents. Students with any record,
+// including excused ones, are left alone. With dryRun nothing is written
+// except the run record.
+func RunAutoAbsence(day time.Time, trigger string, dryRun bool) (*AutoAbsenceReport, error) {
+	date, _ := time.Parse("2006-01-02", day.Format("2006-01-02"))
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	if date.After(today) {
+		return nil, errFutureDate
+	}
+
+	if !autoAbsenceMu.TryLock() {
+		return nil, errAutoAbsenceRunning
+	}
+	defer autoAbsenceMu.Unlock()
+
+	run := models.AutoAbsenceRun{Date: date, Trigger: trigger, DryRun: dryRun, StartedAt: time.Now()}
+	report := &AutoAbsenceReport{Date: date.Format("2006-01-02"), DryRun: dryRun, Marked: []AbsentStudent{}}
+
+	cal, err := loadSchoolCalendar(date, date)
+	if err != nil {
+		return nil, err
+	}
+	reason := cal.NonSchoolDayReason(date)
+
+	var students []models.Student
+	if reason == "" {
+		err = database.DB.Where("is_active = ?", true).
+			Where("NOT EXISTS (SELECT 1 FROM attendances a WHERE a.student_id = students.id AND a.date = ? AND a.deleted_at IS NULL)", date).
+			Where("NOT EXISTS (SELECT 1 FROM attendance_locks l WHERE l.class = students.class AND l.start_date <= ? AND l.end_date >= ?)", date, date).
+			Order("class, name").
+			Find(&students).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !dryRun && len(students) > 0 {
+		note := "Tidak check-in hingga batas waktu"
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			db := models.WithEditor(tx, 0, "system", "Auto absence")
+			for _, s := range students {
+				attendance := models.Attendance{
+					StudentID: s.ID,
+					Date:      date,
+					Status:    models.StatusAbsent,
+					Notes:     note,
+				}
+				if err := db.Create(&attendance).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range students {
+		report.Marked = append(report.Marked, AbsentStudent{ID: s.ID, StudentID: s.StudentID, Name: s.Name, Class: s.Class})
+	}
+	report.SkippedReason = reason
+
+	finished := time.Now()
+	run.Marked = len(students)
+	run.SkippedReason = reason
+	run.FinishedAt = &finished
+	if err := database.DB.Create(&run).Error; err != nil {
+		log.Printf("Error saving auto absence run: %v", err)
+	}
+	report.RunID = run.ID
+
+	if !dryRun {
+		for _, s := range students {
+			SendParentNotification(int(s.ID), s.Name,
+				fmt.Sprintf("tidak hadir pada %s (tidak ada check-in)", date.Format("02/01/2006")))
+		}
+	}
+
+	return report, nil
+}
+
+// ScheduleAutoAbsence runs the job once a day after the configured cutoff.
+// A run that was missed while the server was down is made up on start if
+// the cutoff has passed the same day.
+func ScheduleAutoAbsence() {
+	cutoff, ok := autoAbsenceCutoff()
+	if !ok {
+		return
+	}
+
+	check := func() {
+		now := time.Now()
+		if now.Format("15:04") < cutoff {
+			return
+		}
+
+		today, _ := time.Parse("2006-01-02", now.Format("2006-01-02"))
+		var count int64
+		database.DB.Model(&models.AutoAbsenceRun{}).Where("date = ? AND dry_run = ?", today, false).Count(&count)
+		if count > 0 {
+			return
+		}
+
+		report, err := RunAutoAbsence(now, "schedule", false)
+		if err != nil {
+			log.Printf("Error running auto absence: %v", err)
+			return
+		}
+		if report.SkippedReason != "" {
+			log.Printf("Auto absence %s skipped: %s", report.Date, report.SkippedReason)
+			return
+		}
+		log.Printf("Auto absence %s: %d students marked absent", report.Date, len(report.Marked))
+	}
+
+	go func() {
+		check()
+		ticker := time.NewTicker(AutoAbsenceCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			check()
+		}
+	}()
+}
+
+// MarkAbsences runs the job on demand (?date=YYYY-MM-DD, default today).
+// Pass dry_run=true to only list the students.
+func MarkAbsences(c *gin.Context) {
+	day := time.Now()
+	if date := c.Query("date"); date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		day = parsed
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := RunAutoAbsence(day, "manual", dryRun)
+	if err != nil {
+		switch err {
+		case errFutureDate:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot mark absences for a future date"})
+		case errAutoAbsenceRunning:
+			c.JSON(http.StatusConflict, gin.H{"error": "Auto absence is already running"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark absences"})
+		}
+		return
+	}
+
+	if !dryRun && len(report.Marked) > 0 {
+		recordAudit(c, AuditCreate, "auto_absence", report.RunID, nil, gin.H{
+			"date":   report.Date,
+			"marked": len(report.Marked),
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func GetAutoAbsenceRuns(c *gin.Context) {
+	var runs []models.AutoAbsenceRun
+	if err := database.DB.Order("started_at DESC").Limit(50).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch auto absence runs"})
+		return
+	}
+
+	cutoff, scheduled := autoAbsenceCutoff()
+	c.JSON(http.StatusOK, gin.H{
+		"scheduled": scheduled,
+		"cutoff":    cutoff,
+		"runs":      runs,
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	testModels = append(testModels, &models.AutoAbsenceRun{}, &models.SchoolYear{}, &models.CalendarEvent{})
+}
+
+func TestAutoAbsenceSkipsQRCheckIns(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("SCHOOL_DAYS", "0,1,2,3,4,5,6")
+	scanned := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	checkedIn := createTestStudent(t, "S2", "s2@school.id", "Password1")
+	missing := createTestStudent(t, "S3", "s3@school.id", "Password1")
+
+	session := models.QRSession{SessionCode: "QR-1", Subject: "Matematika", ExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	database.DB.Create(&session)
+	r := gin.New()
+	r.POST("/qr/scan", asUser(scanned.ID, "student"), ScanQRCode)
+	if w := doJSON(t, r, http.MethodPost, "/qr/scan", gin.H{"qr_data": qrPayload(t, session)}); w.Code != http.StatusOK {
+		t.Fatalf("scan: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, checkInRouter(checkedIn.ID), http.MethodPost, "/checkin", gin.H{}); w.Code != http.StatusCreated {
+		t.Fatalf("check-in: %d %s", w.Code, w.Body.String())
+	}
+
+	report, err := RunAutoAbsence(time.Now(), "manual", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Marked) != 1 || report.Marked[0].ID != missing.ID {
+		t.Fatalf("marked = %+v, want only %s", report.Marked, missing.StudentID)
+	}
+
+	var attendance models.Attendance
+	if err := database.DB.Where("student_id = ?", scanned.ID).First(&attendance).Error; err != nil {
+		t.Fatalf("no attendance for the QR scan: %v", err)
+	}
+	if attendance.Status == models.StatusAbsent {
+		t.Error("QR-scanned student marked absent")
+	}
+}
@@ -0,0 +1,667 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"school-attendance/database"
+	"school-attendance/ical"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MaxSchoolDaysRange limits how many days GetSchoolDays lists at once.
+const MaxSchoolDaysRange = 366
+
+type SchoolYearRequest struct {
+	Name      string `json:"name" binding:"required"`
+	StartDate string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+type SemesterRequest struct {
+	Name      string `json:"name" binding:"required"`
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+type CalendarEventRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Type        string `json:"type"`                          // holiday (default), exam, school_day, event
+	StartDate   string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate     string `json:"end_date"`                      // defaults to start_date
+	Description string `json:"description"`
+}
+
+// CalendarImportResult reports what happened to one event of an imported
+// file.
+type CalendarImportResult struct {
+	UID       string `json:"uid,omitempty"`
+	Name      string `json:"name"`
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+	Status    string `json:"status"` // created, updated, skipped, error
+	Error     string `json:"error,omitempty"`
+}
+
+// schoolCalendar answers which days are school days: weekdays from
+// SCHOOL_DAYS inside a school year, minus holidays and exams, plus extra
+// school days.
+type schoolCalendar struct {
+	weekdays map[time.Weekday]bool
+	years    []models.SchoolYear
+	events   []models.CalendarEvent
+}
+
+// schoolWeekdays reads SCHOOL_DAYS, weekday numbers separated by commas
+// (0 = Sunday). The default is Monday to Friday.
+func schoolWeekdays() map[time.Weekday]bool {
+	days := map[time.Weekday]bool{}
+	for _, part := range strings.Split(os.Getenv("SCHOOL_DAYS"), ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || n > 6 {
+			continue
+		}
+		days[time.Weekday(n)] = true
+	}
+	if len(days) == 0 {
+		for d := time.Monday; d <= time.Friday; d++ {
+			days[d] = true
+		}
+	}
+	return days
+}
+
+// dateOnly drops the time of day, giving the midnight UTC value attendance
+// dates are stored as.
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// loadSchoolCalendar loads the school years and the events overlapping
+// from through to.
+func loadSchoolCalendar(from, to time.Time) (*schoolCalendar, error) {
+	cal := &schoolCalendar{weekdays: schoolWeekdays()}
+	if err := database.DB.Order("start_date").Find(&cal.years).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("start_date <= ? AND end_date >= ?", to, from).
+		Order("start_date").Find(&cal.events).Error; err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// NonSchoolDayReason explains why day is not a school day, or returns ""
+// when it is one. Closing events win over extra school days.
+func (cal *schoolCalendar) NonSchoolDayReason(day time.Time) string {
+	if len(cal.years) > 0 {
+		inYear := false
+		for _, y := range cal.years {
+			if !day.Before(y.StartDate) && !day.After(y.EndDate) {
+				inYear = true
+				break
+			}
+		}
+		if !inYear {
+			return "outside the school year"
+		}
+	}
+
+	opened := false
+	for i := range cal.events {
+		e := &cal.events[i]
+		if !e.Covers(day) {
+			continue
+		}
+		if e.Closes() {
+			return e.Type + ": " + e.Name
+		}
+		if e.Type == models.EventSchoolDay {
+			opened = true
+		}
+	}
+	if !opened && !cal.weekdays[day.Weekday()] {
+		return "not a school day (" + day.Weekday().String() + ")"
+	}
+	return ""
+}
+
+// IsSchoolDay reports whether attendance is expected on day.
+func (cal *schoolCalendar) IsSchoolDay(day time.Time) bool {
+	return cal.NonSchoolDayReason(day) == ""
+}
+
+// SchoolDays lists the school days from through to, both inclusive.
+func (cal *schoolCalendar) SchoolDays(from, to time.Time) []time.Time {
+	days := []time.Time{}
+	for day := dateOnly(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		if cal.IsSchoolDay(day) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// CurrentSchoolYear returns the school year containing day, if any.
+func (cal *schoolCalendar) CurrentSchoolYear(day time.Time) *models.SchoolYear {
+	for i := range cal.years {
+		if !day.Before(cal.years[i].StartDate) && !day.After(cal.years[i].EndDate) {
+			return &cal.years[i]
+		}
+	}
+	return nil
+}
+
+// parseDateRange answers with 400 and returns false unless both dates are
+// valid and in order.
+func parseDateRange(c *gin.Context, startDate, endDate string) (time.Time, time.Time, bool) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+		return time.Time{}, time.Time{}, false
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End date must not be before start date"})
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// findRecord loads the record named by the :id parameter, answering with
+// 400, 404 or 500 and returning false when it cannot.
+func findRecord(c *gin.Context, record interface{}, label string) bool {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + strings.ToLower(label) + " ID"})
+		return false
+	}
+
+	if err := database.DB.First(record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": label + " not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	return true
+}
+
+func GetSchoolYears(c *gin.Context) {
+	var years []models.SchoolYear
+	if err := database.DB.Preload("Semesters", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_date")
+	}).Order("start_date DESC").Find(&years).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch school years"})
+		return
+	}
+
+	c.JSON(http.StatusOK, years)
+}
+
+// validateSchoolYear answers with 409 and returns false when the year
+// reuses a name or overlaps another year.
+func validateSchoolYear(c *gin.Context, name string, start, end time.Time, excludeID uint) bool {
+	var count int64
+	database.DB.Model(&models.SchoolYear{}).Where("name = ? AND id != ?", name, excludeID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A school year with this name already exists"})
+		return false
+	}
+
+	database.DB.Model(&models.SchoolYear{}).
+		Where("start_date <= ? AND end_date >= ? AND id != ?", end, start, excludeID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "School year overlaps another school year"})
+		return false
+	}
+	return true
+}
+
+func CreateSchoolYear(c *gin.Context) {
+	var req SchoolYearRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok || !validateSchoolYear(c, req.Name, start, end, 0) {
+		return
+	}
+
+	year := models.SchoolYear{Name: req.Name, StartDate: start, EndDate: end}
+	if err := database.DB.Create(&year).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create school year"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "school_year", year.ID, nil, year)
+
+	c.JSON(http.StatusCreated, year)
+}
+
+func UpdateSchoolYear(c *gin.Context) {
+	var year models.SchoolYear
+	if !findRecord(c, &year, "School year") {
+		return
+	}
+	before := year
+
+	var req SchoolYearRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok || !validateSchoolYear(c, req.Name, start, end, year.ID) {
+		return
+	}
+
+	var outside int64
+	database.DB.Model(&models.Semester{}).
+		Where("school_year_id = ? AND (start_date < ? OR end_date > ?)", year.ID, start, end).Count(&outside)
+	if outside > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Semesters would fall outside the school year"})
+		return
+	}
+
+	year.Name = req.Name
+	year.StartDate = start
+	year.EndDate = end
+	if err := database.DB.Save(&year).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update school year"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "school_year", year.ID, before, year)
+
+	c.JSON(http.StatusOK, year)
+}
+
+func DeleteSchoolYear(c *gin.Context) {
+	var year models.SchoolYear
+	if !findRecord(c, &year, "School year") {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("school_year_id = ?", year.ID).Delete(&models.Semester{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&year).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete school year"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "school_year", year.ID, year, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "School year deleted successfully"})
+}
+
+// validateSemester answers with 400 or 409 and returns false unless the
+// semester lies inside its school year without overlapping another one.
+func validateSemester(c *gin.Context, year models.SchoolYear, start, end time.Time, excludeID uint) bool {
+	if start.Before(year.StartDate) || end.After(year.EndDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Semester must lie within the school year"})
+		return false
+	}
+
+	var count int64
+	database.DB.Model(&models.Semester{}).
+		Where("school_year_id = ? AND start_date <= ? AND end_date >= ? AND id != ?", year.ID, end, start, excludeID).
+		Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Semester overlaps another semester"})
+		return false
+	}
+	return true
+}
+
+func CreateSemester(c *gin.Context) {
+	var year models.SchoolYear
+	if !findRecord(c, &year, "School year") {
+		return
+	}
+
+	var req SemesterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok || !validateSemester(c, year, start, end, 0) {
+		return
+	}
+
+	semester := models.Semester{SchoolYearID: year.ID, Name: req.Name, StartDate: start, EndDate: end}
+	if err := database.DB.Create(&semester).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create semester"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "semester", semester.ID, nil, semester)
+
+	c.JSON(http.StatusCreated, semester)
+}
+
+func UpdateSemester(c *gin.Context) {
+	var semester models.Semester
+	if !findRecord(c, &semester, "Semester") {
+		return
+	}
+	before := semester
+
+	var req SemesterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok {
+		return
+	}
+
+	var year models.SchoolYear
+	if err := database.DB.First(&year, semester.SchoolYearID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !validateSemester(c, year, start, end, semester.ID) {
+		return
+	}
+
+	semester.Name = req.Name
+	semester.StartDate = start
+	semester.EndDate = end
+	if err := database.DB.Save(&semester).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update semester"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "semester", semester.ID, before, semester)
+
+	c.JSON(http.StatusOK, semester)
+}
+
+func DeleteSemester(c *gin.Context) {
+	var semester models.Semester
+	if !findRecord(c, &semester, "Semester") {
+		return
+	}
+
+	if err := database.DB.Delete(&semester).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete semester"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "semester", semester.ID, semester, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Semester deleted successfully"})
+}
+
+// GetCalendarEvents lists events overlapping ?start_date=&end_date=,
+// optionally of one ?type=.
+func GetCalendarEvents(c *gin.Context) {
+	query := database.DB.Order("start_date")
+
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+	if startDate != "" || endDate != "" {
+		start, end, ok := parseDateRange(c, startDate, endDate)
+		if !ok {
+			return
+		}
+		query = query.Where("start_date <= ? AND end_date >= ?", end, start)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	var events []models.CalendarEvent
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// bindCalendarEvent answers with 400 and returns false when the request is
+// invalid.
+func bindCalendarEvent(c *gin.Context, event *models.CalendarEvent) bool {
+	var req CalendarEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if req.Type == "" {
+		req.Type = models.EventHoliday
+	}
+	if !models.IsValidEventType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event type"})
+		return false
+	}
+	if req.EndDate == "" {
+		req.EndDate = req.StartDate
+	}
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok {
+		return false
+	}
+
+	event.Name = req.Name
+	event.Type = req.Type
+	event.StartDate = start
+	event.EndDate = end
+	event.Description = req.Description
+	return true
+}
+
+func CreateCalendarEvent(c *gin.Context) {
+	event := models.CalendarEvent{Source: "manual"}
+	if !bindCalendarEvent(c, &event) {
+		return
+	}
+
+	if err := database.DB.Create(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar event"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "calendar_event", event.ID, nil, event)
+
+	c.JSON(http.StatusCreated, event)
+}
+
+func UpdateCalendarEvent(c *gin.Context) {
+	var event models.CalendarEvent
+	if !findRecord(c, &event, "Calendar event") {
+		return
+	}
+	before := event
+
+	if !bindCalendarEvent(c, &event) {
+		return
+	}
+
+	if err := database.DB.Save(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update calendar event"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "calendar_event", event.ID, before, event)
+
+	c.JSON(http.StatusOK, event)
+}
+
+func DeleteCalendarEvent(c *gin.Context) {
+	var event models.CalendarEvent
+	if !findRecord(c, &event, "Calendar event") {
+		return
+	}
+
+	if err := database.DB.Delete(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete calendar event"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "calendar_event", event.ID, event, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar event deleted successfully"})
+}
+
+// ImportCalendar reads an uploaded .ics file ("file") and stores its events
+// with the type given in the "type" form field (default holiday). Events
+// whose UID was imported before are updated instead of duplicated.
+func ImportCalendar(c *gin.Context) {
+	eventType := c.DefaultPostForm("type", models.EventHoliday)
+	if !models.IsValidEventType(eventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event type"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "iCalendar file is required"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer f.Close()
+
+	events, problems, err := ical.Parse(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid iCalendar file: " + err.Error()})
+		return
+	}
+
+	results := []CalendarImportResult{}
+	for _, problem := range problems {
+		results = append(results, CalendarImportResult{Status: "error", Error: problem.Error()})
+	}
+
+	created, updated := 0, 0
+	for _, e := range events {
+		result := CalendarImportResult{
+			UID:       e.UID,
+			Name:      e.Summary,
+			StartDate: e.FirstDay().Format("2006-01-02"),
+			EndDate:   e.LastDay().Format("2006-01-02"),
+		}
+		if e.Recurring {
+			result.Status = "skipped"
+			result.Error = "recurring events are not supported"
+			results = append(results, result)
+			continue
+		}
+		if e.Summary == "" {
+			result.Status = "skipped"
+			result.Error = "event has no summary"
+			results = append(results, result)
+			continue
+		}
+
+		result.Status, err = importCalendarEvent(e, eventType)
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+		} else if result.Status == "created" {
+			created++
+		} else {
+			updated++
+		}
+		results = append(results, result)
+	}
+
+	if created+updated > 0 {
+		recordAudit(c, AuditCreate, "calendar_import", file.Filename, nil, gin.H{
+			"type":    eventType,
+			"created": created,
+			"updated": updated,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"created": created,
+		"updated": updated,
+		"total":   len(results),
+	})
+}
+
+func importCalendarEvent(e ical.Event, eventType string) (string, error) {
+	var event models.CalendarEvent
+	status := "created"
+	if e.UID != "" {
+		err := database.DB.Where("uid = ?", e.UID).First(&event).Error
+		if err == nil {
+			status = "updated"
+		} else if err != gorm.ErrRecordNotFound {
+			return "", err
+		}
+	}
+
+	event.Name = e.Summary
+	event.Type = eventType
+	event.StartDate = e.FirstDay()
+	event.EndDate = e.LastDay()
+	event.Description = e.Description
+	event.UID = e.UID
+	event.Source = "ics"
+
+	return status, database.DB.Save(&event).Error
+}
+
+// GetSchoolDays lists the school days between ?start_date= and ?end_date=
+// and why the other days are not.
+func GetSchoolDays(c *gin.Context) {
+	start, end, ok := parseDateRange(c, c.Query("start_date"), c.Query("end_date"))
+	if !ok {
+		return
+	}
+	if end.Sub(start) > MaxSchoolDaysRange*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range is too long"})
+		return
+	}
+
+	cal, err := loadSchoolCalendar(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load school calendar"})
+		return
+	}
+
+	days := []string{}
+	closed := []gin.H{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if reason := cal.NonSchoolDayReason(day); reason != "" {
+			closed = append(closed, gin.H{"date": day.Format("2006-01-02"), "reason": reason})
+			continue
+		}
+		days = append(days, day.Format("2006-01-02"))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start_date":      start.Format("2006-01-02"),
+		"end_date":        end.Format("2006-01-02"),
+		"school_days":     len(days),
+		"days":            days,
+		"non_school_days": closed,
+	})
+}
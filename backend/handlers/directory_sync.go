@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/directory"
+	"school-attendance/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var directorySyncMu sync.Mutex
+
+// SyncChange describes one account the sync created, updated or
+// deactivated.
+type SyncChange struct {
+	ID      uint                   `json:"id,omitempty"` // empty for accounts a dry run would create
+	DN      string                 `json:"dn,omitempty"`
+	Email   string                 `json:"email"`
+	Name    string                 `json:"name"`
+	Changes map[string]fieldChange `json:"changes,omitempty"`
+}
+
+// SyncResult is the diff for one account type.
+type SyncResult struct {
+	Created     []SyncChange `json:"created"`
+	Updated     []SyncChange `json:"updated"`
+	Deactivated []SyncChange `json:"deactivated"`
+	Errors      []string     `json:"errors"`
+}
+
+// SyncReport is returned by the sync endpoint and stored with each run.
+type SyncReport struct {
+	RunID    uint       `json:"run_id"`
+	DryRun   bool       `json:"dry_run"`
+	Students SyncResult `json:"students"`
+	Admins   SyncResult `json:"admins"`
+}
+
+func newSyncResult() SyncResult {
+	return SyncResult{Created: []SyncChange{}, Updated: []SyncChange{}, Deactivated: []SyncChange{}, Errors: []string{}}
+}
+
+// unusablePassword returns a random hash for accounts created by the sync.
+// Their users sign in through the directory, SSO or a password reset. The
+// secret is never known to anyone, so the minimum bcrypt cost is enough.
+func unusablePassword() (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.MinCost)
+	return string(hash), err
+}
+
+// checkPassword verifies a login password. Accounts managed by the LDAP sync
+// are checked against the directory when LDAP_AUTH is enabled.
+func checkPassword(hash, directoryDN, password string) bool {
+	if cfg := directory.Current(); cfg != nil && cfg.AuthEnabled && directoryDN != "" {
+		err := cfg.Authenticate(directoryDN, password)
+		if err != nil && err != directory.ErrInvalidCredentials {
+			log.Printf("Error authenticating %s against the directory: %v", directoryDN, err)
+		}
+		return err == nil
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// passwordManagedByDirectory reports whether the account's password lives
+// in LDAP rather than in our database.
+func passwordManagedByDirectory(directoryDN string) bool {
+	cfg := directory.Current()
+	return cfg != nil && cfg.AuthEnabled && directoryDN != ""
+}
+
+func addChange(changes map[string]fieldChange, field string, from, to interface{}) {
+	if from != to {
+		changes[field] = fieldChange{From: from, To: to}
+	}
+}
+
+// RunDirectorySync reads the configured OUs and creates, updates or
+// deactivates students and admins to match. With dryRun nothing is written
+// except the run record, so the report shows the pending diff.
+func RunDirectorySync(trigger string, dryRun bool) (*SyncReport, error) {
+	cfg := directory.Current()
+	if cfg == nil {
+		return nil, errors.New("directory sync is not configured")
+	}
+	if !directorySyncMu.TryLock() {
+		return nil, errors.New("directory sync is already running")
+	}
+	defer directorySyncMu.Unlock()
+
+	run := models.DirectorySyncRun{Trigger: trigger, DryRun: dryRun, StartedAt: time.Now()}
+	if err := database.DB.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	report := &SyncReport{RunID: run.ID, DryRun: dryRun, Students: newSyncResult(), Admins: newSyncResult()}
+
+	studentEntries, studentErr := cfg.SearchStudents()
+	adminEntries, adminErr := cfg.SearchAdmins()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if studentErr != nil {
+			report.Students.Errors = append(report.Students.Errors, "search failed: "+studentErr.Error())
+		} else if len(cfg.StudentBaseDNs) > 0 {
+			if err := syncStudents(tx, studentEntries, dryRun, &report.Students); err != nil {
+				return err
+			}
+		}
+
+		if adminErr != nil {
+			report.Admins.Errors = append(report.Admins.Errors, "search failed: "+adminErr.Error())
+		} else if len(cfg.AdminBaseDNs) > 0 {
+			if err := syncAdmins(tx, cfg, adminEntries, dryRun, &report.Admins); err != nil {
+				return err
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+
+	raw, _ := json.Marshal(report)
+	now := time.Now()
+	database.DB.Model(&run).Updates(map[string]interface{}{
+		"created":     len(report.Students.Created) + len(report.Admins.Created),
+		"updated":     len(report.Students.Updated) + len(report.Admins.Updated),
+		"deactivated": len(report.Students.Deactivated) + len(report.Admins.Deactivated),
+		"errors":      len(report.Students.Errors) + len(report.Admins.Errors),
+		"report":      string(raw),
+		"finished_at": now,
+	})
+
+	return report, nil
+}
+
+// errDryRun rolls back the sync transaction after a dry run.
+var errDryRun = errors.New("dry run")
+
+func syncStudents(tx *gorm.DB, entries []directory.Entry, dryRun bool, result *SyncResult) error {
+	var students []models.Student
+	if err := tx.Unscoped().Find(&students).Error; err != nil {
+		return err
+	}
+
+	byDN := map[string]*models.Student{}
+	byStudentID := map[string]*models.Student{}
+	byEmail := map[string]*models.Student{}
+	for i := range students {
+		s := &students[i]
+		if s.DirectoryDN != "" {
+			byDN[s.DirectoryDN] = s
+		}
+		byStudentID[s.StudentID] = s
+		byEmail[s.Email] = s
+	}
+
+	seen := map[uint]bool{}
+	for _, e := range entries {
+		if e.Disabled {
+			continue
+		}
+		if e.StudentID == "" || e.Email == "" || e.Name == "" || e.Class == "" || e.Grade == "" {
+			result.Errors = append(result.Errors, e.DN+": missing student id, email, name, class or grade")
+			continue
+		}
+
+		student := byDN[e.DN]
+		if student == nil {
+			student = byStudentID[e.StudentID]
+		}
+		if student == nil {
+			student = byEmail[e.Email]
+		}
+
+		if student == nil {
+			created := models.Student{
+				StudentID:   e.StudentID,
+				Name:        e.Name,
+				Email:       e.Email,
+				Class:       e.Class,
+				Grade:       e.Grade,
+				PhoneNumber: e.PhoneNumber,
+				IsActive:    true,
+				DirectoryDN: e.DN,
+			}
+			if !dryRun {
+				password, err := unusablePassword()
+				if err != nil {
+					return err
+				}
+				created.Password = password
+				if err := tx.Create(&created).Error; err != nil {
+					result.Errors = append(result.Errors, e.DN+": "+err.Error())
+					continue
+				}
+			}
+			result.Created = append(result.Created, SyncChange{ID: created.ID, DN: e.DN, Email: e.Email, Name: e.Name})
+			continue
+		}
+
+		if student.DeletedAt.Valid {
+			result.Errors = append(result.Errors, e.DN+": matches deleted student "+student.StudentID)
+			continue
+		}
+		seen[student.ID] = true
+
+		changes := map[string]fieldChange{}
+		addChange(changes, "student_id", student.StudentID, e.StudentID)
+		addChange(changes, "name", student.Name, e.Name)
+		addChange(changes, "email", student.Email, e.Email)
+		addChange(changes, "class", student.Class, e.Class)
+		addChange(changes, "grade", student.Grade, e.Grade)
+		if e.PhoneNumber != "" {
+			addChange(changes, "phone_number", student.PhoneNumber, e.PhoneNumber)
+		}
+		addChange(changes, "is_active", student.IsActive, true)
+		addChange(changes, "directory_dn", student.DirectoryDN, e.DN)
+		if len(changes) == 0 {
+			continue
+		}
+
+		if !dryRun {
+			updates := map[string]interface{}{}
+			for field, change := range changes {
+				updates[field] = change.To
+			}
+			if err := tx.Model(student).Updates(updates).Error; err != nil {
+				result.Errors = append(result.Errors, e.DN+": "+err.Error())
+				continue
+			}
+		}
+		result.Updated = append(result.Updated, SyncChange{ID: student.ID, DN: e.DN, Email: e.Email, Name: e.Name, Changes: changes})
+	}
+
+	// An empty result is far more likely a broken filter than an empty school
+	if len(seen) == 0 && len(result.Created) == 0 {
+		result.Errors = append(result.Errors, "directory returned no students, skipping deactivation")
+		return nil
+	}
+
+	for i := range students {
+		s := &students[i]
+		if s.DirectoryDN == "" || !s.IsActive || s.DeletedAt.Valid || seen[s.ID] {
+			continue
+		}
+		if !dryRun {
+			if err := tx.Model(s).Update("is_active", false).Error; err != nil {
+				return err
+			}
+			if err := revokeAllUserTokens(tx, s.ID, "student", "directory_sync"); err != nil {
+				return err
+			}
+		}
+		result.Deactivated = append(result.Deactivated, SyncChange{ID: s.ID, DN: s.DirectoryDN, Email: s.Email, Name: s.Name})
+	}
+	return nil
+}
+
+func syncAdmins(tx *gorm.DB, cfg *directory.Config, entries []directory.Entry, dryRun bool, result *SyncResult) error {
+	var admins []models.Admin
+	if err := tx.Unscoped().Find(&admins).Error; err != nil {
+		return err
+	}
+
+	byDN := map[string]*models.Admin{}
+	byEmail := map[string]*models.Admin{}
+	byUsername := map[string]*models.Admin{}
+	for i := range admins {
+		a := &admins[i]
+		if a.DirectoryDN != "" {
+			byDN[a.DirectoryDN] = a
+		}
+		byEmail[a.Email] = a
+		byUsername[a.Username] = a
+	}
+
+	seen := map[uint]bool{}
+	for _, e := range entries {
+		if e.Disabled {
+			continue
+		}
+		if e.Email == "" || e.Name == "" || e.Username == "" {
+			result.Errors = append(result.Errors, e.DN+": missing username, email or name")
+			continue
+		}
+
+		admin := byDN[e.DN]
+		if admin == nil {
+			admin = byEmail[e.Email]
+		}
+		if admin == nil {
+			admin = byUsername[e.Username]
+		}
+
+		if admin == nil {
+			created := models.Admin{
+				Username:    e.Username,
+				Email:       e.Email,
+				Name:        e.Name,
+				Role:        cfg.AdminRole,
+				IsActive:    true,
+				DirectoryDN: e.DN,
+			}
+			if !dryRun {
+				password, err := unusablePassword()
+				if err != nil {
+					return err
+				}
+				created.Password = password
+				if err := tx.Create(&created).Error; err != nil {
+					result.Errors = append(result.Errors, e.DN+": "+err.Error())
+					continue
+				}
+			}
+			result.Created = append(result.Created, SyncChange{ID: created.ID, DN: e.DN, Email: e.Email, Name: e.Name})
+			continue
+		}
+
+		if admin.DeletedAt.Valid {
+			result.Errors = append(result.Errors, e.DN+": matches deleted admin "+admin.Username)
+			continue
+		}
+		seen[admin.ID] = true
+
+		// Roles are managed in the app, not in the directory
+		changes := map[string]fieldChange{}
+		addChange(changes, "username", admin.Username, e.Username)
+		addChange(changes, "name", admin.Name, e.Name)
+		addChange(changes, "email", admin.Email, e.Email)
+		addChange(changes, "is_active", admin.IsActive, true)
+		addChange(changes, "directory_dn", admin.DirectoryDN, e.DN)
+		if len(changes) == 0 {
+			continue
+		}
+
+		if !dryRun {
+			updates := map[string]interface{}{}
+			for field, change := range changes {
+				updates[field] = change.To
+			}
+			if err := tx.Model(admin).Updates(updates).Error; err != nil {
+				result.Errors = append(result.Errors, e.DN+": "+err.Error())
+				continue
+			}
+		}
+		result.Updated = append(result.Updated, SyncChange{ID: admin.ID, DN: e.DN, Email: e.Email, Name: e.Name, Changes: changes})
+	}
+
+	if len(seen) == 0 && len(result.Created) == 0 {
+		result.Errors = append(result.Errors, "directory returned no staff, skipping deactivation")
+		return nil
+	}
+
+	for i := range admins {
+		a := &admins[i]
+		if a.DirectoryDN == "" || !a.IsActive || a.DeletedAt.Valid || seen[a.ID] {
+			continue
+		}
+		// Never lock the school out of its own system
+		if a.Role == models.RoleSuperAdmin {
+			result.Errors = append(result.Errors, a.DirectoryDN+": super admin left the directory but was kept active")
+			continue
+		}
+		if !dryRun {
+			if err := tx.Model(a).Update("is_active", false).Error; err != nil {
+				return err
+			}
+			if err := revokeAllUserTokens(tx, a.ID, "admin", "directory_sync"); err != nil {
+				return err
+			}
+		}
+		result.Deactivated = append(result.Deactivated, SyncChange{ID: a.ID, DN: a.DirectoryDN, Email: a.Email, Name: a.Name})
+	}
+	return nil
+}
+
+// ScheduleDirectorySync runs the sync in the background at the configured
+// interval.
+func ScheduleDirectorySync() {
+	cfg := directory.Current()
+	if cfg == nil || cfg.SyncInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.SyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := RunDirectorySync("schedule", false)
+			if err != nil {
+				log.Printf("Error syncing directory: %v", err)
+				continue
+			}
+			log.Printf("Directory sync: students +%d ~%d -%d, admins +%d ~%d -%d",
+				len(report.Students.Created), len(report.Students.Updated), len(report.Students.Deactivated),
+				len(report.Admins.Created), len(report.Admins.Updated), len(report.Admins.Deactivated))
+		}
+	}()
+}
+
+// SyncDirectory runs the sync on demand. Pass dry_run=true to only see the
+// diff.
+func SyncDirectory(c *gin.Context) {
+	if directory.Current() == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Directory sync is not configured"})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := RunDirectorySync("manual", dryRun)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !dryRun {
+		recordAudit(c, AuditSync, "directory", report.RunID, nil, gin.H{
+			"created":     len(report.Students.Created) + len(report.Admins.Created),
+			"updated":     len(report.Students.Updated) + len(report.Admins.Updated),
+			"deactivated": len(report.Students.Deactivated) + len(report.Admins.Deactivated),
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func GetDirectorySyncRuns(c *gin.Context) {
+	var runs []models.DirectorySyncRun
+	if err := database.DB.Order("started_at DESC").Limit(50).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sync runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"configured": directory.Current() != nil,
+		"runs":       runs,
+	})
+}
+
+func GetDirectorySyncRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	var run models.DirectorySyncRun
+	if err := database.DB.First(&run, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sync run not found"})
+		return
+	}
+
+	var report SyncReport
+	json.Unmarshal([]byte(run.Report), &report)
+
+	c.JSON(http.StatusOK, gin.H{"run": run, "report": report})
+}
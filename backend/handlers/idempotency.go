@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyClaimTimeout is how long a claimed key without a response
+// blocks retries. After that the first request is assumed to have died,
+// e.g. with a server restart, and the key can be claimed again.
+const idempotencyClaimTimeout = 2 * time.Minute
+
+type idempotencyStore struct{}
+
+// IdempotencyStore keeps Idempotency-Key responses in the database.
+var IdempotencyStore middleware.IdempotencyStore = idempotencyStore{}
+
+func (idempotencyStore) Claim(userID uint, userType, key, requestHash string) (*middleware.StoredResponse, error) {
+	now := time.Now()
+	match := models.IdempotencyKey{UserID: userID, UserType: userType, Key: key}
+
+	// Expired and abandoned keys may be used again
+	if err := database.DB.Where(&match).
+		Where("expires_at < ? OR (status_code = 0 AND created_at < ?)", now, now.Add(-idempotencyClaimTimeout)).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, err
+	}
+
+	claim := match
+	claim.RequestHash = requestHash
+	claim.ExpiresAt = now.Add(middleware.IdempotencyKeyTTL)
+	err := database.DB.Create(&claim).Error
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, err
+	}
+
+	var stored models.IdempotencyKey
+	if err := database.DB.Where(&match).First(&stored).Error; err != nil {
+		return nil, err
+	}
+	return &middleware.StoredResponse{
+		RequestHash: stored.RequestHash,
+		StatusCode:  stored.StatusCode,
+		ContentType: stored.ContentType,
+		Body:        stored.Body,
+	}, nil
+}
+
+func (idempotencyStore) Save(userID uint, userType, key string, response middleware.StoredResponse) error {
+	return database.DB.Model(&models.IdempotencyKey{}).
+		Where(&models.IdempotencyKey{UserID: userID, UserType: userType, Key: key}).
+		Updates(map[string]interface{}{
+			"status_code":  response.StatusCode,
+			"content_type": response.ContentType,
+			"body":         response.Body,
+		}).Error
+}
+
+func (idempotencyStore) Release(userID uint, userType, key string) error {
+	return database.DB.Where(&models.IdempotencyKey{UserID: userID, UserType: userType, Key: key}).
+		Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func init() {
+	testModels = append(testModels,
+		&models.IdempotencyKey{},
+		&models.AttendanceVersion{},
+		&models.Notification{},
+		&models.Parent{},
+		&models.StudentParent{},
+		&models.LessonPeriod{},
+		&models.QRSession{},
+		&models.QRAttendance{},
+	)
+}
+
+func useIdempotencyStore(t *testing.T) {
+	t.Helper()
+	middleware.SetIdempotencyStore(IdempotencyStore)
+	t.Cleanup(func() { middleware.SetIdempotencyStore(nil) })
+}
+
+func checkInRouter(studentID uint) *gin.Engine {
+	r := gin.New()
+	r.POST("/checkin", asUser(studentID, "student"), middleware.Idempotent(), CheckIn)
+	return r
+}
+
+func countAttendance(t *testing.T) int64 {
+	t.Helper()
+	var count int64
+	if err := database.DB.Model(&models.Attendance{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestCheckInIdempotencyKey(t *testing.T) {
+	setupTestDB(t)
+	useIdempotencyStore(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := checkInRouter(student.ID)
+
+	first := doJSON(t, r, http.MethodPost, "/checkin", gin.H{}, middleware.IdempotencyKeyHeader, "tap-1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("check-in: %d %s", first.Code, first.Body.String())
+	}
+
+	retry := doJSON(t, r, http.MethodPost, "/checkin", gin.H{}, middleware.IdempotencyKeyHeader, "tap-1")
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want the original response", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Error("retry not marked as replayed")
+	}
+
+	other := doJSON(t, r, http.MethodPost, "/checkin", gin.H{"subject": "Matematika"}, middleware.IdempotencyKeyHeader, "tap-1")
+	if other.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another request: %d, want 422", other.Code)
+	}
+
+	if n := countAttendance(t); n != 1 {
+		t.Errorf("%d attendance rows, want 1", n)
+	}
+}
+
+func TestIdempotencyKeyScopedToUser(t *testing.T) {
+	setupTestDB(t)
+	useIdempotencyStore(t)
+	first := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	second := createTestStudent(t, "S2", "s2@school.id", "Password1")
+
+	for _, student := range []models.Student{first, second} {
+		w := doJSON(t, checkInRouter(student.ID), http.MethodPost, "/checkin", gin.H{}, middleware.IdempotencyKeyHeader, "same-key")
+		if w.Code != http.StatusCreated || w.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+			t.Errorf("student %s: %d replayed=%q", student.StudentID, w.Code, w.Header().Get(middleware.IdempotentReplayedHeader))
+		}
+	}
+	if n := countAttendance(t); n != 2 {
+		t.Errorf("%d attendance rows, want 2", n)
+	}
+}
+
+func TestConcurrentCheckInsCreateOneRow(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := checkInRouter(student.ID)
+
+	const attempts = 8
+	codes := make(chan int, attempts)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			codes <- doJSON(t, r, http.MethodPost, "/checkin", gin.H{}).Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusOK:
+		default:
+			t.Errorf("check-in: %d", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d check-ins created a record, want 1", created)
+	}
+	if n := countAttendance(t); n != 1 {
+		t.Errorf("%d attendance rows, want 1", n)
+	}
+}
+
+func TestRepeatedCheckInKeepsRecord(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	today := dateOnly(time.Now())
+	arrived := time.Now().Add(-time.Hour).Round(time.Second)
+
+	existing := models.Attendance{StudentID: student.ID, Date: today, CheckInTime: &arrived, Status: models.StatusLate, LateMinutes: 12, Subject: "Matematika"}
+	if err := database.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+	w := doJSON(t, checkInRouter(student.ID), http.MethodPost, "/checkin", gin.H{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("repeat check-in: %d %s", w.Code, w.Body.String())
+	}
+
+	var got models.Attendance
+	database.DB.First(&got, existing.ID)
+	if got.Status != models.StatusLate || got.LateMinutes != 12 || got.Subject != "Matematika" {
+		t.Errorf("record changed to %s/%d/%q", got.Status, got.LateMinutes, got.Subject)
+	}
+	if got.CheckInTime == nil || !got.CheckInTime.Equal(arrived) {
+		t.Errorf("check-in time = %v, want %v", got.CheckInTime, arrived)
+	}
+}
+
+func TestCheckInFillsMissingCheckInTime(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+
+	existing := models.Attendance{StudentID: student.ID, Date: dateOnly(time.Now()), Status: models.StatusExcused}
+	if err := database.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := doJSON(t, checkInRouter(student.ID), http.MethodPost, "/checkin", gin.H{}); w.Code != http.StatusOK {
+		t.Fatalf("check-in: %d %s", w.Code, w.Body.String())
+	}
+
+	var got models.Attendance
+	database.DB.First(&got, existing.ID)
+	if got.CheckInTime == nil {
+		t.Error("check-in time not filled in")
+	}
+	if got.Status != models.StatusExcused {
+		t.Errorf("status = %s, want %s", got.Status, models.StatusExcused)
+	}
+}
+
+func TestAttendanceSlotUnique(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	today := dateOnly(time.Now())
+
+	if err := database.DB.Create(&models.Attendance{StudentID: student.ID, Date: today, Status: models.StatusPresent}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := database.DB.Create(&models.Attendance{StudentID: student.ID, Date: today, Status: models.StatusLate}).Error
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("second record for the slot: %v, want ErrDuplicatedKey", err)
+	}
+	if err := database.DB.Create(&models.Attendance{StudentID: student.ID, Date: today, Period: 1, Status: models.StatusPresent}).Error; err != nil {
+		t.Errorf("record for another period: %v", err)
+	}
+}
+
+// qrPayload is the JSON encoded in a session's QR code.
+func qrPayload(t *testing.T, session models.QRSession) string {
+	t.Helper()
+	data, err := json.Marshal(gin.H{"session_code": session.SessionCode, "expires_at": session.ExpiresAt.Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestConcurrentQRScansCreateOneRow(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	session := models.QRSession{SessionCode: "QR-1", Subject: "Matematika", ExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	database.DB.Create(&session)
+
+	r := gin.New()
+	r.POST("/qr/scan", asUser(student.ID, "student"), ScanQRCode)
+	body := gin.H{"qr_data": qrPayload(t, session)}
+
+	const attempts = 8
+	bodies := make(chan string, attempts)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := doJSON(t, r, http.MethodPost, "/qr/scan", body)
+			if w.Code != http.StatusOK {
+				t.Errorf("scan: %d %s", w.Code, w.Body.String())
+			}
+			bodies <- w.Body.String()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(bodies)
+
+	// Every scan gets the answer of the one that was recorded
+	first := <-bodies
+	for b := range bodies {
+		if b != first {
+			t.Errorf("scan answered %s, want %s", b, first)
+		}
+	}
+
+	var scans int64
+	database.DB.Model(&models.QRAttendance{}).Count(&scans)
+	if scans != 1 {
+		t.Errorf("%d QR attendance rows, want 1", scans)
+	}
+	if n := countAttendance(t); n != 1 {
+		t.Errorf("%d attendance rows, want 1", n)
+	}
+}
+
+func TestQRScanUsesSignedInStudent(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	other := createTestStudent(t, "S2", "s2@school.id", "Password1")
+	session := models.QRSession{SessionCode: "QR-1", Subject: "Matematika", ExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	database.DB.Create(&session)
+
+	r := gin.New()
+	r.POST("/qr/scan", asUser(student.ID, "student"), ScanQRCode)
+	w := doJSON(t, r, http.MethodPost, "/qr/scan", gin.H{"qr_data": qrPayload(t, session), "student_id": other.StudentID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("scan: %d %s", w.Code, w.Body.String())
+	}
+
+	var scan models.QRAttendance
+	if err := database.DB.First(&scan).Error; err != nil {
+		t.Fatal(err)
+	}
+	if scan.StudentID != student.StudentID {
+		t.Errorf("scan recorded for %s, want %s", scan.StudentID, student.StudentID)
+	}
+	var others int64
+	database.DB.Model(&models.Attendance{}).Where("student_id = ?", other.ID).Count(&others)
+	if others != 0 {
+		t.Errorf("%d attendance rows for the student named in the body, want 0", others)
+	}
+}
@@ -0,0 +1,658 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LeaveAttachmentMaxSize limits uploaded doctor's notes and letters.
+const LeaveAttachmentMaxSize = 5 << 20
+
+// LeaveMaxDays is the longest range a single request may cover.
+const LeaveMaxDays = 30
+
+var errLeaveReviewed = errors.New("leave request is no longer pending")
+
+// leaveAttachmentTypes maps the accepted content types, sniffed from the
+// file itself, to the extension it is stored with.
+var leaveAttachmentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// leaveTypeLabels is the wording used in notes and notifications.
+var leaveTypeLabels = map[string]string{
+	models.LeaveSick:         "sakit",
+	models.LeaveFamily:       "izin keluarga",
+	models.LeaveDispensation: "dispensasi",
+}
+
+// LeaveRequestForm is sent as multipart/form-data when it carries an
+// attachment, or as JSON otherwise. EndDate defaults to StartDate.
+type LeaveRequestForm struct {
+	Type      string `form:"type" json:"type" binding:"required"`
+	StartDate string `form:"start_date" json:"start_date" binding:"required"`
+	EndDate   string `form:"end_date" json:"end_date"`
+	Reason    string `form:"reason" json:"reason" binding:"required"`
+}
+
+type LeaveReviewRequest struct {
+	Note string `json:"note"`
+}
+
+// leaveAttachmentDir reads LEAVE_ATTACHMENT_DIR, default
+// uploads/leave-requests relative to the working directory.
+func leaveAttachmentDir() string {
+	if dir := os.Getenv("LEAVE_ATTACHMENT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("uploads", "leave-requests")
+}
+
+// leaveDates formats the request's range for notifications.
+func leaveDates(request *models.LeaveRequest) string {
+	if request.StartDate.Equal(request.EndDate) {
+		return request.StartDate.Format("02/01/2006")
+	}
+	return request.StartDate.Format("02/01/2006") + " - " + request.EndDate.Format("02/01/2006")
+}
+
+// saveLeaveAttachment stores the optional "attachment" upload under a random
+// name and records it on the request. It answers with 400 or 500 and returns
+// false when the file is rejected.
+func saveLeaveAttachment(c *gin.Context, request *models.LeaveRequest) bool {
+	file, err := c.FormFile("attachment")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment"})
+		return false
+	}
+	if file.Size > LeaveAttachmentMaxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attachment must not be larger than 5 MB"})
+		return false
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read attachment"})
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := leaveAttachmentTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attachment must be a PDF, JPEG or PNG file"})
+		return false
+	}
+
+	name, err := generateSecureToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return false
+	}
+	dir := leaveAttachmentDir()
+	path := filepath.Join(dir, name[:32]+ext)
+
+	err = os.MkdirAll(dir, 0o750)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = writeLeaveAttachment(path, f)
+	}
+	if err != nil {
+		log.Printf("Error storing leave attachment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return false
+	}
+
+	request.AttachmentName = filepath.Base(file.Filename)
+	request.AttachmentType = contentType
+	request.AttachmentPath = path
+	return true
+}
+
+func writeLeaveAttachment(path string, src io.Reader) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	return out.Close()
+}
+
+// submitLeaveRequest files a request for the student on behalf of the
+// authenticated student or parent.
+func submitLeaveRequest(c *gin.Context, student models.Student) {
+	var req LeaveRequestForm
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidLeaveType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid leave type. Use sick, family or dispensation"})
+		return
+	}
+	if req.EndDate == "" {
+		req.EndDate = req.StartDate
+	}
+	start, end, ok := parseDateRange(c, req.StartDate, req.EndDate)
+	if !ok {
+		return
+	}
+	if end.Sub(start) >= LeaveMaxDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A leave request may cover at most %d days", LeaveMaxDays)})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.LeaveRequest{}).
+		Where("student_id = ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+			student.ID, []string{models.LeavePending, models.LeaveApproved}, end, start).
+		Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another leave request already covers these dates"})
+		return
+	}
+
+	request := models.LeaveRequest{
+		StudentID:       student.ID,
+		Type:            req.Type,
+		StartDate:       start,
+		EndDate:         end,
+		Reason:          req.Reason,
+		Status:          models.LeavePending,
+		SubmittedByID:   c.GetUint("user_id"),
+		SubmittedByType: c.GetString("user_type"),
+	}
+	if !saveLeaveAttachment(c, &request) {
+		return
+	}
+
+	if err := database.DB.Create(&request).Error; err != nil {
+		if request.AttachmentPath != "" {
+			os.Remove(request.AttachmentPath)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create leave request"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "leave_request", request.ID, nil, request)
+
+	summary := fmt.Sprintf("%s (%s) mengajukan %s untuk %s", student.Name, student.Class, leaveTypeLabels[request.Type], leaveDates(&request))
+	notifyHomeroomTeachers(student.Class, "leave_request", "Pengajuan Izin", summary)
+	if request.SubmittedByType == "parent" {
+		notifyUser(student.ID, "student", "leave_request", "Pengajuan Izin",
+			fmt.Sprintf("Orang tua mengajukan %s untukmu pada %s", leaveTypeLabels[request.Type], leaveDates(&request)), "medium")
+	} else {
+		SendParentNotification(int(student.ID), student.Name,
+			fmt.Sprintf("mengajukan %s untuk %s", leaveTypeLabels[request.Type], leaveDates(&request)))
+	}
+
+	request.Student = &student
+	c.JSON(http.StatusCreated, request)
+}
+
+// notifyHomeroomTeachers alerts the active homeroom teachers of a class.
+func notifyHomeroomTeachers(class, kind, title, message string) {
+	var admins []models.Admin
+	if err := database.DB.
+		Joins("JOIN teaching_assignments ta ON ta.admin_id = admins.id").
+		Where("ta.class = ? AND ta.subject = ? AND admins.is_active = ?", class, "", true).
+		Find(&admins).Error; err != nil {
+		log.Printf("Error loading homeroom teachers of %s: %v", class, err)
+		return
+	}
+
+	for _, admin := range admins {
+		notifyUser(admin.ID, "admin", kind, title, message, "medium")
+	}
+}
+
+// excuseLeaveDays marks the school days of an approved request as excused.
+// Days without a record get an excused daily record; absences already
+// recorded become excused, while attended lessons are left as they are.
+// On locked days the changes are filed as corrections by the reviewer
+// instead, to be approved by someone else.
+func excuseLeaveDays(db *gorm.DB, request *models.LeaveRequest, reviewerID uint) (int, error) {
+	cal, err := loadSchoolCalendar(request.StartDate, request.EndDate)
+	if err != nil {
+		return 0, err
+	}
+
+	var student models.Student
+	if err := db.First(&student, request.StudentID).Error; err != nil {
+		return 0, err
+	}
+	locks, err := classLocks(db, student.Class, request.StartDate, request.EndDate)
+	if err != nil {
+		return 0, err
+	}
+
+	note := fmt.Sprintf("Izin %s: %s", leaveTypeLabels[request.Type], request.Reason)
+	reason := fmt.Sprintf("Leave request #%d approved", request.ID)
+	excuse := func(lock *models.AttendanceLock, record *models.Attendance, proposed models.Attendance) error {
+		if lock == nil {
+			if record == nil {
+				return db.Create(&proposed).Error
+			}
+			return db.Save(&proposed).Error
+		}
+		_, err := requestCorrection(db, lock, record, proposed, reason, reviewerID, "admin")
+		if err == errCorrectionPending {
+			return nil
+		}
+		return err
+	}
+
+	days := cal.SchoolDays(request.StartDate, request.EndDate)
+	for _, day := range days {
+		var records []models.Attendance
+		if err := db.Where("student_id = ? AND date = ?", request.StudentID, day).Find(&records).Error; err != nil {
+			return 0, err
+		}
+		lock := lockOn(locks, day)
+
+		if len(records) == 0 {
+			attendance := models.Attendance{
+				StudentID: request.StudentID,
+				Date:      day,
+				Status:    models.StatusExcused,
+				Notes:     note,
+			}
+			if err := excuse(lock, nil, attendance); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		for i := range records {
+			if records[i].Status != models.StatusAbsent {
+				continue
+			}
+			proposed := records[i]
+			proposed.Status = models.StatusExcused
+			proposed.Notes = note
+			if err := excuse(lock, &records[i], proposed); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(days), nil
+}
+
+func findLeaveRequest(c *gin.Context) (*models.LeaveRequest, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid leave request ID"})
+		return nil, false
+	}
+
+	var request models.LeaveRequest
+	if err := database.DB.First(&request, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Leave request not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	requests := []models.LeaveRequest{request}
+	if err := loadLeaveStudents(requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	return &requests[0], true
+}
+
+// loadLeaveStudents fills in Student. Preload cannot be used because the
+// student's own StudentID column makes the relation ambiguous.
+func loadLeaveStudents(requests []models.LeaveRequest) error {
+	ids := make([]uint, 0, len(requests))
+	for _, r := range requests {
+		ids = append(ids, r.StudentID)
+	}
+
+	var students []models.Student
+	if err := database.DB.Unscoped().Where("id IN ?", ids).Find(&students).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.Student, len(students))
+	for i := range students {
+		byID[students[i].ID] = &students[i]
+	}
+	for i := range requests {
+		if student, ok := byID[requests[i].StudentID]; ok {
+			requests[i].Student = student
+		} else {
+			requests[i].Student = &models.Student{ID: requests[i].StudentID}
+		}
+	}
+	return nil
+}
+
+// allowLeaveRequest answers with 404 or 403 unless the caller is the
+// student, one of the student's parents or an admin covering the class.
+func allowLeaveRequest(c *gin.Context, request *models.LeaveRequest) bool {
+	userID := c.GetUint("user_id")
+	switch c.GetString("user_type") {
+	case "student":
+		if request.StudentID == userID {
+			return true
+		}
+	case "parent":
+		if parentOwnsStudent(userID, *request.Student) {
+			return true
+		}
+	case "admin":
+		scope, ok := callerScope(c)
+		if !ok {
+			return false
+		}
+		if !scope.AllowsClass(request.Student.Class) {
+			denyClass(c)
+			return false
+		}
+		return true
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Leave request not found"})
+	return false
+}
+
+func SubmitMyLeaveRequest(c *gin.Context) {
+	var student models.Student
+	if err := database.DB.First(&student, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	submitLeaveRequest(c, student)
+}
+
+func SubmitChildLeaveRequest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	var student models.Student
+	if err := database.DB.First(&student, id).Error; err != nil || !parentOwnsStudent(c.GetUint("user_id"), student) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	submitLeaveRequest(c, student)
+}
+
+func GetMyLeaveRequests(c *gin.Context) {
+	var requests []models.LeaveRequest
+	if err := database.DB.Where("student_id = ?", c.GetUint("user_id")).
+		Order("start_date DESC").
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// GetChildrenLeaveRequests lists the requests of every child linked to the
+// parent.
+func GetChildrenLeaveRequests(c *gin.Context) {
+	var requests []models.LeaveRequest
+	if err := database.DB.
+		Joins("JOIN students s ON s.id = leave_requests.student_id").
+		Joins("JOIN student_parents sp ON sp.student_id = s.student_id").
+		Where("sp.parent_id = ?", c.GetUint("user_id")).
+		Order("leave_requests.start_date DESC").
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
+		return
+	}
+	if err := loadLeaveStudents(requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// CancelLeaveRequest withdraws a pending request. Students and parents can
+// only cancel requests for themselves or their children.
+func CancelLeaveRequest(c *gin.Context) {
+	request, ok := findLeaveRequest(c)
+	if !ok || !allowLeaveRequest(c, request) {
+		return
+	}
+	if request.Status != models.LeavePending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending leave requests can be cancelled"})
+		return
+	}
+
+	before := *request
+	result := database.DB.Model(request).Where("status = ?", models.LeavePending).Update("status", models.LeaveCancelled)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel leave request"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending leave requests can be cancelled"})
+		return
+	}
+
+	recordAudit(c, AuditCancel, "leave_request", request.ID, before, request)
+
+	notifyHomeroomTeachers(request.Student.Class, "leave_request", "Pengajuan Izin", fmt.Sprintf("Pengajuan %s %s untuk %s dibatalkan",
+		leaveTypeLabels[request.Type], request.Student.Name, leaveDates(request)))
+
+	c.JSON(http.StatusOK, request)
+}
+
+// GetLeaveAttachment serves the uploaded file to anyone who can see the
+// request.
+func GetLeaveAttachment(c *gin.Context) {
+	request, ok := findLeaveRequest(c)
+	if !ok || !allowLeaveRequest(c, request) {
+		return
+	}
+	if request.AttachmentPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Leave request has no attachment"})
+		return
+	}
+	if _, err := os.Stat(request.AttachmentPath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment file is missing"})
+		return
+	}
+
+	c.FileAttachment(request.AttachmentPath, request.AttachmentName)
+}
+
+// GetLeaveRequests lists the requests of the caller's classes
+// (?status=&class=&student_id=&start_date=&end_date=).
+func GetLeaveRequests(c *gin.Context) {
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.LeaveRequest{}).
+		Joins("JOIN students ON students.id = leave_requests.student_id")
+	query = scope.ScopeStudents(query, "students.class")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("leave_requests.status = ?", status)
+	}
+	if class := c.Query("class"); class != "" {
+		query = query.Where("students.class = ?", class)
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("leave_requests.student_id = ?", studentID)
+	}
+	if startDate, endDate := c.Query("start_date"), c.Query("end_date"); startDate != "" && endDate != "" {
+		start, end, ok := parseDateRange(c, startDate, endDate)
+		if !ok {
+			return
+		}
+		query = query.Where("leave_requests.start_date <= ? AND leave_requests.end_date >= ?", end, start)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var requests []models.LeaveRequest
+	if err := query.Select("leave_requests.*").
+		Order("leave_requests.created_at DESC").
+		Offset(offset).Limit(limit).
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
+		return
+	}
+	if err := loadLeaveStudents(requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"leave_requests": requests,
+		"total":          total,
+		"page":           page,
+		"limit":          limit,
+	})
+}
+
+func GetLeaveRequest(c *gin.Context) {
+	request, ok := findLeaveRequest(c)
+	if !ok || !allowLeaveRequest(c, request) {
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+func ApproveLeaveRequest(c *gin.Context) {
+	reviewLeaveRequest(c, models.LeaveApproved)
+}
+
+// RejectLeaveRequest requires a note telling the family why.
+func RejectLeaveRequest(c *gin.Context) {
+	reviewLeaveRequest(c, models.LeaveRejected)
+}
+
+// reviewLeaveRequest settles a pending request. Only the class's homeroom
+// teacher, or an admin with classes:all, may review it.
+func reviewLeaveRequest(c *gin.Context, status string) {
+	request, ok := findLeaveRequest(c)
+	if !ok {
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.IsHomeroom(request.Student.Class) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the homeroom teacher of this class can review its leave requests"})
+		return
+	}
+
+	var req LeaveReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status == models.LeaveRejected && req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A note is required when rejecting a leave request"})
+		return
+	}
+	if request.Status != models.LeavePending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Leave request has already been " + request.Status})
+		return
+	}
+
+	before := *request
+	reviewerID := c.GetUint("user_id")
+	now := time.Now()
+	request.Status = status
+	request.ReviewedBy = &reviewerID
+	request.ReviewedAt = &now
+	request.ReviewNote = req.Note
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if status == models.LeaveApproved {
+			db := models.WithEditor(tx, reviewerID, "admin", fmt.Sprintf("Leave request #%d approved", request.ID)).
+				Session(&gorm.Session{})
+			days, err := excuseLeaveDays(db, request, reviewerID)
+			if err != nil {
+				return err
+			}
+			request.ExcusedDays = days
+		}
+
+		result := tx.Model(request).
+			Where("status = ?", models.LeavePending).
+			Select("status", "reviewed_by", "reviewed_at", "review_note", "excused_days").
+			Updates(request)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errLeaveReviewed
+		}
+		return nil
+	})
+	if err == errLeaveReviewed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Leave request has already been reviewed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review leave request"})
+		return
+	}
+
+	action := AuditApprove
+	outcome := "disetujui"
+	if status == models.LeaveRejected {
+		action = AuditReject
+		outcome = "ditolak"
+	}
+	recordAudit(c, action, "leave_request", request.ID, before, request)
+
+	message := fmt.Sprintf("Pengajuan %s untuk %s %s", leaveTypeLabels[request.Type], leaveDates(request), outcome)
+	if req.Note != "" {
+		message += ": " + req.Note
+	}
+	notifyUser(request.StudentID, "student", "leave_request", "Pengajuan Izin", message, "medium")
+	SendParentNotification(int(request.StudentID), request.Student.Name, message)
+
+	c.JSON(http.StatusOK, request)
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errUnknownPeriod      = errors.New("lesson period not found")
+	errNoPeriodInProgress = errors.New("no lesson period is in progress")
+)
+
+type LessonPeriodRequest struct {
+	Number       int    `json:"number" binding:"required,min=1"`
+	Name         string `json:"name"`
+	StartTime    string `json:"start_time" binding:"required"`
+	EndTime      string `json:"end_time" binding:"required"`
+	GraceMinutes int    `json:"grace_minutes" binding:"min=0,max=60"`
+}
+
+// checkInPeriod picks the lesson a check-in belongs to. An explicit number
+// wins; otherwise a check-in for a subject goes to the lesson in progress.
+// It returns nil for the daily check-in, including when the school has no
+// lesson periods configured.
+func checkInPeriod(number int, subject string, at time.Time) (*models.LessonPeriod, error) {
+	if number > 0 {
+		var period models.LessonPeriod
+		if err := database.DB.Where("number = ?", number).First(&period).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, errUnknownPeriod
+			}
+			return nil, err
+		}
+		return &period, nil
+	}
+	if subject == "" {
+		return nil, nil
+	}
+
+	var periods []models.LessonPeriod
+	if err := database.DB.Order("number").Find(&periods).Error; err != nil {
+		return nil, err
+	}
+	if len(periods) == 0 {
+		return nil, nil
+	}
+	for i := range periods {
+		if periods[i].InProgress(at) {
+			return &periods[i], nil
+		}
+	}
+	return nil, errNoPeriodInProgress
+}
+
+// periodError answers a checkInPeriod failure.
+func periodError(c *gin.Context, err error) {
+	switch err {
+	case errUnknownPeriod:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lesson period not found"})
+	case errNoPeriodInProgress:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No lesson period is in progress, specify the period"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve lesson period"})
+	}
+}
+
+// lessonArrivalStatus is arrivalStatus for a lesson, measured from the
+// lesson's start.
+func lessonArrivalStatus(period *models.LessonPeriod, at time.Time) (string, int) {
+	start, err := period.StartOn(at)
+	if err != nil {
+		log.Printf("Invalid lesson period %d start time %q", period.Number, period.StartTime)
+		return models.StatusPresent, 0
+	}
+	return lateness(start, period.GraceMinutes, at)
+}
+
+// validateLessonPeriod answers with 400 or 409 and returns false when the
+// request is malformed or reuses another period's number.
+func validateLessonPeriod(c *gin.Context, req LessonPeriodRequest, excludeID uint) bool {
+	start, err := time.Parse("15:04", req.StartTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format. Use HH:MM"})
+		return false
+	}
+	end, err := time.Parse("15:04", req.EndTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format. Use HH:MM"})
+		return false
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
+		return false
+	}
+
+	var count int64
+	database.DB.Model(&models.LessonPeriod{}).Where("number = ? AND id != ?", req.Number, excludeID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A lesson period with this number already exists"})
+		return false
+	}
+	return true
+}
+
+func findLessonPeriod(c *gin.Context) (*models.LessonPeriod, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lesson period ID"})
+		return nil, false
+	}
+
+	var period models.LessonPeriod
+	if err := database.DB.First(&period, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Lesson period not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	return &period, true
+}
+
+func GetLessonPeriods(c *gin.Context) {
+	var periods []models.LessonPeriod
+	if err := database.DB.Order("number").Find(&periods).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lesson periods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, periods)
+}
+
+func CreateLessonPeriod(c *gin.Context) {
+	var req LessonPeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateLessonPeriod(c, req, 0) {
+		return
+	}
+
+	period := models.LessonPeriod{
+		Number:       req.Number,
+		Name:         req.Name,
+		StartTime:    req.StartTime,
+		EndTime:      req.EndTime,
+		GraceMinutes: req.GraceMinutes,
+	}
+
+	if err := database.DB.Create(&period).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create lesson period"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "lesson_period", period.ID, nil, period)
+
+	c.JSON(http.StatusCreated, period)
+}
+
+func UpdateLessonPeriod(c *gin.Context) {
+	period, ok := findLessonPeriod(c)
+	if !ok {
+		return
+	}
+
+	before := *period
+
+	var req LessonPeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateLessonPeriod(c, req, period.ID) {
+		return
+	}
+
+	period.Number = req.Number
+	period.Name = req.Name
+	period.StartTime = req.StartTime
+	period.EndTime = req.EndTime
+	period.GraceMinutes = req.GraceMinutes
+
+	if err := database.DB.Save(period).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update lesson period"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "lesson_period", period.ID, before, period)
+
+	c.JSON(http.StatusOK, period)
+}
+
+func DeleteLessonPeriod(c *gin.Context) {
+	period, ok := findLessonPeriod(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(period).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete lesson period"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "lesson_period", period.ID, period, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lesson period deleted successfully"})
+}
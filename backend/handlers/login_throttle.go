@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// throttlePolicy describes how failed logins for one key slow down and
+// eventually lock further attempts.
+type throttlePolicy struct {
+	BackoffAfter    int           // failures before exponential backoff starts
+	LockoutAfter    int           // failures before a temporary lockout
+	LockoutDuration time.Duration // how long a lockout lasts
+	MaxBackoff      time.Duration
+	Window          time.Duration // failures older than this are forgotten
+}
+
+var (
+	accountThrottle = throttlePolicy{
+		BackoffAfter:    3,
+		LockoutAfter:    10,
+		LockoutDuration: 30 * time.Minute,
+		MaxBackoff:      5 * time.Minute,
+		Window:          30 * time.Minute,
+	}
+	ipThrottle = throttlePolicy{
+		BackoffAfter:    20,
+		LockoutAfter:    100,
+		LockoutDuration: 30 * time.Minute,
+		MaxBackoff:      5 * time.Minute,
+		Window:          30 * time.Minute,
+	}
+)
+
+type UnlockRequest struct {
+	UserType  string `json:"user_type"`
+	Email     string `json:"email"`
+	IPAddress string `json:"ip_address"`
+}
+
+func accountThrottleKey(userType, email string) string {
+	return "account:" + userType + ":" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// retryAfter returns how long the key must wait before the next attempt.
+func (p throttlePolicy) retryAfter(t *models.LoginThrottle, now time.Time) time.Duration {
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		return t.LockedUntil.Sub(now)
+	}
+	if now.Sub(t.LastFailureAt) > p.Window || t.Failures < p.BackoffAfter {
+		return 0
+	}
+
+	backoff := time.Duration(math.Pow(2, float64(t.Failures-p.BackoffAfter))) * time.Second
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if wait := t.LastFailureAt.Add(backoff).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func loadThrottle(key string) *models.LoginThrottle {
+	var t models.LoginThrottle
+	if err := database.DB.Where("throttle_key = ?", key).First(&t).Error; err != nil {
+		return nil
+	}
+	return &t
+}
+
+// checkLoginThrottle aborts the request with 429 when the account or the
+// client IP must wait before trying again.
+func checkLoginThrottle(c *gin.Context, userType, email string) bool {
+	now := time.Now()
+	var wait time.Duration
+
+	if t := loadThrottle(accountThrottleKey(userType, email)); t != nil {
+		wait = accountThrottle.retryAfter(t, now)
+	}
+	if t := loadThrottle(ipThrottleKey(c.ClientIP())); t != nil {
+		if w := ipThrottle.retryAfter(t, now); w > wait {
+			wait = w
+		}
+	}
+
+	if wait <= 0 {
+		return true
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	logFailedLogin(c, userType, email, nil, "throttled")
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Try again later.",
+		"retry_after": seconds,
+	})
+	return false
+}
+
+func bumpThrottle(tx *gorm.DB, key string, policy throttlePolicy, now time.Time) error {
+	var t models.LoginThrottle
+	err := tx.Where("throttle_key = ?", key).First(&t).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	if t.ID != 0 && now.Sub(t.LastFailureAt) > policy.Window {
+		t.Failures = 0
+	}
+	t.Key = key
+	t.Failures++
+	t.LastFailureAt = now
+	if t.Failures >= policy.LockoutAfter {
+		lockedUntil := now.Add(policy.LockoutDuration)
+		t.LockedUntil = &lockedUntil
+	}
+
+	return tx.Save(&t).Error
+}
+
+func logFailedLogin(c *gin.Context, userType, email string, userID *uint, reason string) {
+	database.DB.Create(&models.FailedLogin{
+		UserType:  userType,
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		UserID:    userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+	})
+}
+
+// recordLoginFailure counts a rejected password against the account and the
+// client IP and keeps an entry for the admin to review.
+func recordLoginFailure(c *gin.Context, userType, email string, userID *uint) {
+	now := time.Now()
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := bumpThrottle(tx, accountThrottleKey(userType, email), accountThrottle, now); err != nil {
+			return err
+		}
+		return bumpThrottle(tx, ipThrottleKey(c.ClientIP()), ipThrottle, now)
+	})
+	logFailedLogin(c, userType, email, userID, "invalid_credentials")
+}
+
+// recordLoginSuccess clears the account counter. The IP counter is left to
+// expire so one valid account cannot reset an attacker's budget.
+func recordLoginSuccess(userType, email string) {
+	database.DB.Where("throttle_key = ?", accountThrottleKey(userType, email)).Delete(&models.LoginThrottle{})
+}
+
+func GetFailedLogins(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.FailedLogin{})
+
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", strings.ToLower(email))
+	}
+	if ip := c.Query("ip_address"); ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+	if userType := c.Query("user_type"); userType != "" {
+		query = query.Where("user_type = ?", userType)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("created_at < DATE(?, '+1 day')", endDate)
+	}
+
+	var attempts []models.FailedLogin
+	var total int64
+
+	query.Count(&total)
+
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts": attempts,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// GetLockouts lists accounts and IPs that are currently locked or in
+// backoff.
+func GetLockouts(c *gin.Context) {
+	var throttles []models.LoginThrottle
+	if err := database.DB.Where("last_failure_at > ?", time.Now().Add(-accountThrottle.Window)).
+		Or("locked_until > ?", time.Now()).
+		Order("last_failure_at DESC").Find(&throttles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	now := time.Now()
+	lockouts := make([]gin.H, 0, len(throttles))
+	for _, t := range throttles {
+		policy := accountThrottle
+		if strings.HasPrefix(t.Key, "ip:") {
+			policy = ipThrottle
+		}
+		lockouts = append(lockouts, gin.H{
+			"key":             t.Key,
+			"failures":        t.Failures,
+			"last_failure_at": t.LastFailureAt,
+			"locked_until":    t.LockedUntil,
+			"retry_after":     int(math.Ceil(policy.retryAfter(&t, now).Seconds())),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+func UnlockLogin(c *gin.Context) {
+	var req UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var keys []string
+	if req.Email != "" {
+		if req.UserType != "student" && req.UserType != "admin" && req.UserType != "parent" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user type"})
+			return
+		}
+		keys = append(keys, accountThrottleKey(req.UserType, req.Email))
+	}
+	if req.IPAddress != "" {
+		keys = append(keys, ipThrottleKey(req.IPAddress))
+	}
+	if len(keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email or IP address is required"})
+		return
+	}
+
+	result := database.DB.Where("throttle_key IN ?", keys).Delete(&models.LoginThrottle{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "login_throttle", strings.Join(keys, ","), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Unlocked %d entries", result.RowsAffected),
+	})
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"school-attendance/totp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	testModels = append(testModels, &models.LoginThrottle{}, &models.FailedLogin{}, &models.MFAChallenge{}, &models.RecoveryCode{})
+}
+
+func TestThrottlePolicyRetryAfter(t *testing.T) {
+	now := time.Now()
+	lockedUntil := now.Add(10 * time.Minute)
+
+	tests := []struct {
+		name     string
+		throttle models.LoginThrottle
+		want     time.Duration
+	}{
+		{"below backoff", models.LoginThrottle{Failures: 2, LastFailureAt: now}, 0},
+		{"first backoff", models.LoginThrottle{Failures: 3, LastFailureAt: now}, time.Second},
+		{"backoff doubles", models.LoginThrottle{Failures: 5, LastFailureAt: now}, 4 * time.Second},
+		{"backoff capped", models.LoginThrottle{Failures: 20, LastFailureAt: now.Add(-time.Minute)}, 4 * time.Minute},
+		{"backoff elapsed", models.LoginThrottle{Failures: 4, LastFailureAt: now.Add(-3 * time.Second)}, 0},
+		{"outside window", models.LoginThrottle{Failures: 9, LastFailureAt: now.Add(-time.Hour)}, 0},
+		{"locked", models.LoginThrottle{Failures: 10, LastFailureAt: now, LockedUntil: &lockedUntil}, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accountThrottle.retryAfter(&tt.throttle, now); got != tt.want {
+				t.Errorf("retryAfter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func adminLoginRouter() *gin.Engine {
+	r := gin.New()
+	r.POST("/login", AdminLogin)
+	r.POST("/verify-2fa", VerifyTwoFactorLogin)
+	return r
+}
+
+func TestAdminLoginBacksOffAfterFailures(t *testing.T) {
+	setupTestDB(t)
+	createTestAdmin(t, "guru", "guru@school.id", "Password1")
+	r := adminLoginRouter()
+
+	for i := 0; i < accountThrottle.BackoffAfter; i++ {
+		w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "guru@school.id", Password: "wrong"})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// Even the right password waits out the backoff
+	w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "guru@school.id", Password: "Password1"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login during backoff: %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+
+	var failures, throttled int64
+	database.DB.Model(&models.FailedLogin{}).Where("reason = ?", "invalid_credentials").Count(&failures)
+	database.DB.Model(&models.FailedLogin{}).Where("reason = ?", "throttled").Count(&throttled)
+	if failures != int64(accountThrottle.BackoffAfter) || throttled != 1 {
+		t.Errorf("failed logins = %d invalid, %d throttled", failures, throttled)
+	}
+}
+
+func TestAdminLoginLocksOut(t *testing.T) {
+	setupTestDB(t)
+	createTestAdmin(t, "guru", "guru@school.id", "Password1")
+	r := adminLoginRouter()
+
+	// One failure short of the lockout, with the last backoff already over
+	database.DB.Create(&models.LoginThrottle{
+		Key:           accountThrottleKey("admin", "guru@school.id"),
+		Failures:      accountThrottle.LockoutAfter - 1,
+		LastFailureAt: time.Now().Add(-accountThrottle.MaxBackoff),
+	})
+
+	if w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "GURU@school.id", Password: "wrong"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("last failure: %d, want 401", w.Code)
+	}
+
+	var throttle models.LoginThrottle
+	database.DB.Where("throttle_key = ?", accountThrottleKey("admin", "guru@school.id")).First(&throttle)
+	if throttle.LockedUntil == nil || time.Until(*throttle.LockedUntil) < accountThrottle.LockoutDuration-time.Minute {
+		t.Fatalf("locked_until = %v, want about %v from now", throttle.LockedUntil, accountThrottle.LockoutDuration)
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "guru@school.id", Password: "Password1"}); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login while locked: %d, want 429", w.Code)
+	}
+}
+
+func TestAdminLoginSuccessClearsAccountThrottle(t *testing.T) {
+	setupTestDB(t)
+	createTestAdmin(t, "guru", "guru@school.id", "Password1")
+	r := adminLoginRouter()
+
+	for i := 0; i < accountThrottle.BackoffAfter-1; i++ {
+		doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "guru@school.id", Password: "wrong"})
+	}
+	if w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "guru@school.id", Password: "Password1"}); w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+
+	var account, ip int64
+	database.DB.Model(&models.LoginThrottle{}).Where("throttle_key LIKE ?", "account:%").Count(&account)
+	database.DB.Model(&models.LoginThrottle{}).Where("throttle_key LIKE ?", "ip:%").Count(&ip)
+	if account != 0 {
+		t.Error("successful login left the account throttle in place")
+	}
+	if ip != 1 {
+		t.Error("successful login cleared the IP throttle")
+	}
+}
+
+func TestTwoFactorLoginThrottled(t *testing.T) {
+	setupTestDB(t)
+	admin := createTestAdmin(t, "guru", "guru@school.id", "Password1")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&admin).Updates(map[string]interface{}{"totp_enabled": true, "totp_secret": secret})
+	database.DB.Create(&models.LoginThrottle{
+		Key:           accountThrottleKey("admin", "guru@school.id"),
+		Failures:      1,
+		LastFailureAt: time.Now().Add(-time.Minute),
+	})
+	r := adminLoginRouter()
+
+	failures := func() int {
+		var throttle models.LoginThrottle
+		database.DB.Where("throttle_key = ?", accountThrottleKey("admin", "guru@school.id")).Limit(1).Find(&throttle)
+		return throttle.Failures
+	}
+	challenge := func() string {
+		w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: "guru@school.id", Password: "Password1"})
+		var resp struct {
+			MFAToken string `json:"mfa_token"`
+		}
+		decodeJSON(t, w, &resp)
+		if w.Code != http.StatusOK || resp.MFAToken == "" {
+			t.Fatalf("login: %d %s", w.Code, w.Body.String())
+		}
+		return resp.MFAToken
+	}
+
+	// The password alone does not reset the guess budget
+	token := challenge()
+	if got := failures(); got != 1 {
+		t.Fatalf("failures after password = %d, want 1", got)
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/verify-2fa", VerifyTwoFactorRequest{MFAToken: token, Code: "000000"})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: %d, want 401", w.Code)
+	}
+	if got := failures(); got != 2 {
+		t.Fatalf("failures after wrong code = %d, want 2", got)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/verify-2fa", VerifyTwoFactorRequest{MFAToken: token, Code: code}); w.Code != http.StatusOK {
+		t.Fatalf("valid code: %d %s", w.Code, w.Body.String())
+	}
+	if got := failures(); got != 0 {
+		t.Errorf("failures after second factor = %d, want the throttle cleared", got)
+	}
+}
+
+func TestUnlockLogin(t *testing.T) {
+	setupTestDB(t)
+	lockedUntil := time.Now().Add(time.Hour)
+	database.DB.Create(&models.LoginThrottle{Key: accountThrottleKey("admin", "guru@school.id"), Failures: 10, LastFailureAt: time.Now(), LockedUntil: &lockedUntil})
+	database.DB.Create(&models.LoginThrottle{Key: ipThrottleKey("10.0.0.1"), Failures: 100, LastFailureAt: time.Now(), LockedUntil: &lockedUntil})
+
+	r := gin.New()
+	r.POST("/unlock", UnlockLogin)
+
+	if w := doJSON(t, r, http.MethodPost, "/unlock", UnlockRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("empty unlock: %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/unlock", UnlockRequest{UserType: "admin", Email: "Guru@School.id"}); w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", w.Code, w.Body.String())
+	}
+
+	var remaining []models.LoginThrottle
+	database.DB.Find(&remaining)
+	if len(remaining) != 1 || remaining[0].Key != ipThrottleKey("10.0.0.1") {
+		t.Errorf("remaining throttles = %+v, want only the IP", remaining)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testModels are the tables created for handler tests. Test files add the
+// tables of the feature they cover in init.
+var testModels = []interface{}{
+	&models.Student{},
+	&models.Admin{},
+	&models.Attendance{},
+	&models.AuditLog{},
+	&models.Session{},
+}
+
+// setupTestDB points database.DB at a fresh in-memory database for the
+// duration of the test.
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection to :memory: is a separate database, so keep one
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(testModels...); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+
+	useTestSigningKey(t)
+	return db
+}
+
+// useTestSigningKey installs an HS256 key to sign access tokens with.
+func useTestSigningKey(t *testing.T) {
+	t.Helper()
+	material, err := middleware.GenerateKeyMaterial(middleware.AlgHS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := middleware.NewSigningKey("test", middleware.AlgHS256, material, time.Now().Add(-time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware.SetSigningKeys([]middleware.SigningKey{key})
+	t.Cleanup(func() { middleware.SetSigningKeys(nil) })
+}
+
+func hashPassword(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func createTestStudent(t *testing.T, studentID, email, password string) models.Student {
+	t.Helper()
+	student := models.Student{
+		StudentID: studentID,
+		Name:      "Siswa " + studentID,
+		Email:     email,
+		Password:  hashPassword(t, password),
+		Class:     "X-1",
+		Grade:     "10",
+		IsActive:  true,
+	}
+	if err := database.DB.Create(&student).Error; err != nil {
+		t.Fatal(err)
+	}
+	return student
+}
+
+func createTestAdmin(t *testing.T, username, email, password string) models.Admin {
+	t.Helper()
+	admin := models.Admin{
+		Username: username,
+		Name:     "Admin " + username,
+		Email:    email,
+		Password: hashPassword(t, password),
+		IsActive: true,
+	}
+	if err := database.DB.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+// asUser stands in for AuthMiddleware and authenticates every request as
+// the given account.
+func asUser(userID uint, userType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("user_type", userType)
+		c.Next()
+	}
+}
+
+// doJSON sends body as JSON and returns the recorded response. headers are
+// name, value pairs.
+func doJSON(t *testing.T, handler http.Handler, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +18,23 @@ import (
 	"strings"
 )
 
+// getAllowedOrigins returns the origins allowed to open a WebSocket, from
+// the comma separated ALLOWED_ORIGINS or the frontend's development URLs.
+func getAllowedOrigins() []string {
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		return []string{"http://localhost:3000", "http://localhost:3001"}
+	}
+
+	var allowed []string
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed = append(allowed, origin)
+		}
+	}
+	return allowed
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		allowedOrigins := getAllowedOrigins()
@@ -28,12 +49,36 @@ var upgrader = websocket.Upgrader{
 }
 
 type NotificationHub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan []byte
-	register   chan *websocket.Conn
+	clients    map[*websocket.Conn]*wsClient
+	broadcast  chan outboundMessage
+	register   chan *wsClient
 	unregister chan *websocket.Conn
 }
 
+// wsClient is a connected socket and the identity it authenticated with.
+// Anonymous sockets only receive notifications without a recipient.
+type wsClient struct {
+	conn     *websocket.Conn
+	userID   uint
+	userType string
+}
+
+type outboundMessage struct {
+	payload  []byte
+	userID   int
+	userType string
+}
+
+func (m outboundMessage) deliverTo(client *wsClient) bool {
+	if m.userType == "" {
+		return true
+	}
+	if client.userType != m.userType {
+		return false
+	}
+	return m.userID == 0 || int(client.userID) == m.userID
+}
+
 type Notification struct {
 	ID        int       `json:"id"`
 	Type      string    `json:"type"`
@@ -47,9 +92,9 @@ type Notification struct {
 }
 
 var hub = NotificationHub{
-	clients:    make(map[*websocket.Conn]bool),
-	broadcast:  make(chan []byte),
-	register:   make(chan *websocket.Conn),
+	clients:    make(map[*websocket.Conn]*wsClient),
+	broadcast:  make(chan outboundMessage),
+	register:   make(chan *wsClient),
 	unregister: make(chan *websocket.Conn),
 }
 
@@ -61,7 +106,7 @@ func (h *NotificationHub) run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
+			h.clients[client.conn] = client
 			log.Println("Client connected to WebSocket")
 
 		case client := <-h.unregister:
@@ -72,12 +117,15 @@ func (h *NotificationHub) run() {
 			}
 
 		case message := <-h.broadcast:
-			for client := range h.clients {
-				err := client.WriteMessage(websocket.TextMessage, message)
+			for conn, client := range h.clients {
+				if !message.deliverTo(client) {
+					continue
+				}
+				err := conn.WriteMessage(websocket.TextMessage, message.payload)
 				if err != nil {
 					log.Printf("Error sending message: %v", err)
-					client.Close()
-					delete(h.clients, client)
+					conn.Close()
+					delete(h.clients, conn)
 				}
 			}
 		}
@@ -85,13 +133,27 @@ func (h *NotificationHub) run() {
 }
 
 func HandleWebSocket(c *gin.Context) {
+	// Browsers cannot set headers on WebSocket requests, so the access
+	// token is passed as a query parameter.
+	client := &wsClient{}
+	if token := c.Query("token"); token != "" {
+		claims, err := middleware.ParseToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		client.userID = claims.UserID
+		client.userType = claims.UserType
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade to WebSocket: %v", err)
 		return
 	}
 
-	hub.register <- conn
+	client.conn = conn
+	hub.register <- client
 
 	defer func() {
 		hub.unregister <- conn
@@ -113,7 +175,11 @@ func BroadcastNotification(notification Notification) {
 		return
 	}
 
-	hub.broadcast <- message
+	hub.broadcast <- outboundMessage{
+		payload:  message,
+		userID:   notification.UserID,
+		userType: notification.UserType,
+	}
 }
 
 func SendAttendanceNotification(studentName string, status string, checkTime time.Time) {
@@ -128,16 +194,103 @@ func SendAttendanceNotification(studentName string, status string, checkTime tim
 	BroadcastNotification(notification)
 }
 
+// SendParentNotification stores a notification for every parent linked to
+// the student and pushes it to their open sockets.
 func SendParentNotification(studentID int, studentName string, message string) {
-	notification := Notification{
-		Type:      "parent_alert",
-		Title:     "Notifikasi Siswa",
-		Message:   "Siswa " + studentName + ": " + message,
-		UserID:    studentID,
-		UserType:  "parent",
-		Priority:  "high",
-		CreatedAt: time.Now(),
+	var parents []models.Parent
+	if err := database.DB.
+		Joins("JOIN student_parents sp ON sp.parent_id = parents.id").
+		Joins("JOIN students s ON s.student_id = sp.student_id").
+		Where("s.id = ? AND parents.is_active = ?", studentID, true).
+		Find(&parents).Error; err != nil {
+		log.Printf("Error loading parents for student %d: %v", studentID, err)
+		return
 	}
 
-	BroadcastNotification(notification)
-}
\ No newline at end of file
+	for _, parent := range parents {
+		notifyUser(parent.ID, "parent", "parent_alert", "Notifikasi Siswa", "Siswa "+studentName+": "+message, "high")
+	}
+}
+
+// notifyUser stores a notification for one user and pushes it to their open
+// sockets.
+func notifyUser(userID uint, userType, kind, title, message, priority string) {
+	record := models.Notification{
+		Type:     kind,
+		Title:    title,
+		Message:  message,
+		UserID:   int(userID),
+		UserType: userType,
+		Priority: priority,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		log.Printf("Error saving %s notification: %v", userType, err)
+		return
+	}
+
+	BroadcastNotification(Notification{
+		ID:        int(record.ID),
+		Type:      record.Type,
+		Title:     record.Title,
+		Message:   record.Message,
+		UserID:    record.UserID,
+		UserType:  record.UserType,
+		Priority:  record.Priority,
+		CreatedAt: record.CreatedAt,
+	})
+}
+
+// GetMyNotifications lists the stored notifications addressed to the
+// authenticated user.
+func GetMyNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	userType := c.GetString("user_type")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.Notification{}).Where("user_id = ? AND user_type = ?", userID, userType)
+	if c.Query("unread") == "true" {
+		query = query.Where("read = ?", false)
+	}
+
+	var notifications []models.Notification
+	var total int64
+
+	query.Count(&total)
+
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND user_type = ?", id, c.GetUint("user_id"), c.GetString("user_type")).
+		Update("read", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
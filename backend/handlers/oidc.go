@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"school-attendance/oidc"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OIDCStateTTL is how long the user has to finish signing in at the
+// provider.
+const OIDCStateTTL = 10 * time.Minute
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+func findOIDCProvider(c *gin.Context) (*oidc.Provider, bool) {
+	provider, ok := oidc.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown SSO provider"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// GetOIDCProviders lists the configured providers for the login page.
+func GetOIDCProviders(c *gin.Context) {
+	list := []gin.H{}
+	for _, p := range oidc.List() {
+		list = append(list, gin.H{
+			"name":         p.Name,
+			"display_name": p.DisplayName,
+			"user_types":   p.UserTypes,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"providers": list})
+}
+
+// StartOIDCLogin returns the provider URL the browser should be sent to.
+// The provider redirects back to the frontend, which posts the code and
+// state to OIDCCallback.
+func StartOIDCLogin(c *gin.Context) {
+	provider, ok := findOIDCProvider(c)
+	if !ok {
+		return
+	}
+
+	userType := c.DefaultQuery("user_type", "student")
+	if !provider.AllowsUserType(userType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This provider cannot be used for " + userType + " accounts"})
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error starting OIDC login with %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "SSO provider is unavailable"})
+		return
+	}
+
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+	if err := database.DB.Create(&models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Provider:     provider.Name,
+		UserType:     userType,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+		"expires_in":        int64(OIDCStateTTL.Seconds()),
+	})
+}
+
+// OIDCCallback exchanges the authorization code, maps the verified email to
+// an existing account and answers like the password login endpoints.
+func OIDCCallback(c *gin.Context) {
+	provider, ok := findOIDCProvider(c)
+	if !ok {
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The state is single use; claim it before talking to the provider
+	var state models.OIDCLoginState
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND provider = ?", hashToken(req.State), provider.Name).
+			First(&state).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&state).Error
+	})
+	if err != nil || time.Now().After(state.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired SSO state"})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("Error completing OIDC login with %s: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SSO login failed"})
+		return
+	}
+
+	email, err := provider.Email(claims)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if !provider.AllowsEmail(email) {
+		logFailedLogin(c, state.UserType, email, nil, "sso_no_account")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed"})
+		return
+	}
+
+	// SSO only signs in to accounts the school already created
+	switch state.UserType {
+	case "student":
+		var student models.Student
+		if err := database.DB.Where("LOWER(email) = ? AND is_active = ?", email, true).First(&student).Error; err != nil {
+			logFailedLogin(c, "student", email, nil, "sso_no_account")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No active account for this email"})
+			return
+		}
+
+		response, err := issueTokens(c, student.ID, "student", student)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	case "admin":
+		var admin models.Admin
+		if err := database.DB.Where("LOWER(email) = ? AND is_active = ?", email, true).First(&admin).Error; err != nil {
+			logFailedLogin(c, "admin", email, nil, "sso_no_account")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No active account for this email"})
+			return
+		}
+
+		completeAdminLogin(c, admin)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user type"})
+	}
+}
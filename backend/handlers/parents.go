@@ -0,0 +1,730 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ParentInvitationTTL is how long an invitation link stays valid.
+const ParentInvitationTTL = 7 * 24 * time.Hour
+
+type ParentRegisterRequest struct {
+	Name            string `json:"name" binding:"required"`
+	Email           string `json:"email" binding:"required,email"`
+	Password        string `json:"password" binding:"required"`
+	PhoneNumber     string `json:"phone_number"`
+	Address         string `json:"address"`
+	Relationship    string `json:"relationship"`
+	InvitationToken string `json:"invitation_token"`
+}
+
+type ParentInvitationRequest struct {
+	Email        string   `json:"email" binding:"required,email"`
+	Name         string   `json:"name"`
+	Relationship string   `json:"relationship"`
+	StudentIDs   []string `json:"student_ids" binding:"required,min=1"`
+}
+
+// linkParentToStudents creates the missing StudentParent rows between the
+// parent and the given student numbers.
+func linkParentToStudents(tx *gorm.DB, parentID uint, studentIDs []string) error {
+	for _, studentID := range studentIDs {
+		var existing models.StudentParent
+		err := tx.Where("parent_id = ? AND student_id = ?", parentID, studentID).First(&existing).Error
+		if err == nil {
+			continue
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if err := tx.Create(&models.StudentParent{StudentID: studentID, ParentID: parentID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentOwnsStudent reports whether the parent is linked to the student.
+func parentOwnsStudent(parentID uint, student models.Student) bool {
+	var count int64
+	database.DB.Model(&models.StudentParent{}).
+		Where("parent_id = ? AND student_id = ?", parentID, student.StudentID).
+		Count(&count)
+	return count > 0
+}
+
+func ParentLogin(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkLoginThrottle(c, "parent", req.Email) {
+		return
+	}
+
+	var parent models.Parent
+	if err := database.DB.Where("email = ? AND is_active = ?", req.Email, true).First(&parent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			recordLoginFailure(c, "parent", req.Email, nil)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Parents created by an admin have no password until they register
+	if parent.Password == "" {
+		recordLoginFailure(c, "parent", req.Email, &parent.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(parent.Password), []byte(req.Password)); err != nil {
+		recordLoginFailure(c, "parent", req.Email, &parent.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	recordLoginSuccess("parent", req.Email)
+
+	response, err := issueTokens(c, parent.ID, "parent", parent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ParentRegister creates a parent account. With an invitation token the
+// account is linked to the invited children; without one the account starts
+// unlinked until an admin links it.
+func ParentRegister(c *gin.Context) {
+	var req ParentRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkPasswordLength(c, req.Password) {
+		return
+	}
+
+	var invitation models.ParentInvitation
+	if req.InvitationToken != "" {
+		if err := database.DB.Where("token_hash = ?", hashToken(req.InvitationToken)).First(&invitation).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation"})
+			return
+		}
+		if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation has expired or was already used"})
+			return
+		}
+		if !strings.EqualFold(invitation.Email, req.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email does not match the invitation"})
+			return
+		}
+	}
+
+	var parent models.Parent
+	err := database.DB.Where("email = ?", req.Email).First(&parent).Error
+	if err == nil && parent.Password != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// An admin-created parent without a password may only be claimed
+	// through an invitation.
+	if parent.ID != 0 && invitation.ID == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	parent.Name = req.Name
+	parent.Email = req.Email
+	parent.Password = string(hashedPassword)
+	parent.IsActive = true
+	if req.PhoneNumber != "" {
+		parent.PhoneNumber = req.PhoneNumber
+	}
+	if req.Address != "" {
+		parent.Address = req.Address
+	}
+	if req.Relationship != "" {
+		parent.Relationship = req.Relationship
+	} else if invitation.Relationship != "" {
+		parent.Relationship = invitation.Relationship
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&parent).Error; err != nil {
+			return err
+		}
+		if invitation.ID == 0 {
+			return nil
+		}
+
+		if err := linkParentToStudents(tx, parent.ID, strings.Split(invitation.StudentIDs, ",")); err != nil {
+			return err
+		}
+		return tx.Model(&invitation).Update("accepted_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create parent"})
+		return
+	}
+
+	response, err := issueTokens(c, parent.ID, "parent", parent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// InviteParent creates an invitation that links the registering parent to
+// the listed students.
+func InviteParent(c *gin.Context) {
+	var req ParentInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.Student{}).Where("student_id IN ?", req.StudentIDs).Count(&count)
+	if int(count) != len(req.StudentIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "One or more students not found"})
+		return
+	}
+
+	token, err := generateSecureToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation"})
+		return
+	}
+
+	invitation := models.ParentInvitation{
+		Email:        req.Email,
+		Name:         req.Name,
+		Relationship: req.Relationship,
+		StudentIDs:   strings.Join(req.StudentIDs, ","),
+		TokenHash:    hashToken(token),
+		InvitedBy:    c.GetUint("user_id"),
+		ExpiresAt:    time.Now().Add(ParentInvitationTTL),
+	}
+
+	if err := database.DB.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "parent_invitation", invitation.ID, nil, invitation)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation":       invitation,
+		"invitation_token": token,
+	})
+}
+
+func GetMyChildren(c *gin.Context) {
+	parentID := c.GetUint("user_id")
+
+	var students []models.Student
+	if err := database.DB.
+		Joins("JOIN student_parents sp ON sp.student_id = students.student_id").
+		Where("sp.parent_id = ?", parentID).
+		Order("students.name").
+		Find(&students).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch children"})
+		return
+	}
+
+	c.JSON(http.StatusOK, students)
+}
+
+func GetChildAttendance(c *gin.Context) {
+	parentID := c.GetUint("user_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	var student models.Student
+	if err := database.DB.First(&student, id).Error; err != nil || !parentOwnsStudent(parentID, student) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	month := c.Query("month") // YYYY-MM format
+
+	offset := (page - 1) * limit
+
+	query := database.DB.Where("student_id = ?", student.ID)
+
+	if month != "" {
+		parsedMonth, err := time.Parse("2006-01", month)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format"})
+			return
+		}
+		startDate := parsedMonth.Format("2006-01-02")
+		lastDay := parsedMonth.AddDate(0, 1, -1).Format("2006-01-02")
+		query = query.Where("date >= ? AND date <= ?", startDate, lastDay)
+	}
+
+	var attendances []models.Attendance
+	var total int64
+
+	query.Model(&models.Attendance{}).Count(&total)
+
+	if err := query.Offset(offset).Limit(limit).Order("date DESC").Find(&attendances).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance records"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"student":     student,
+		"attendances": attendances,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+	})
+}
+
+type ParentRequest struct {
+	Name         string   `json:"name"`
+	Email        string   `json:"email"`
+	PhoneNumber  string   `json:"phone_number"`
+	Address      string   `json:"address"`
+	Relationship string   `json:"relationship"`
+	IsActive     *bool    `json:"is_active"`
+	StudentIDs   []string `json:"student_ids"`
+}
+
+type LinkStudentRequest struct {
+	StudentID string `json:"student_id" binding:"required"`
+}
+
+// ParentImportResult reports the outcome of one CSV row.
+type ParentImportResult struct {
+	Row       int    `json:"row"`
+	Email     string `json:"email"`
+	StudentID string `json:"student_id"`
+	Status    string `json:"status"` // linked, already_linked, error
+	Error     string `json:"error,omitempty"`
+}
+
+func findParent(c *gin.Context) (*models.Parent, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent ID"})
+		return nil, false
+	}
+
+	var parent models.Parent
+	if err := database.DB.First(&parent, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	return &parent, true
+}
+
+func GetAllParents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	search := c.Query("search")
+
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.Parent{})
+
+	if search != "" {
+		query = query.Where("name LIKE ? OR email LIKE ? OR phone_number LIKE ?",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+	if active := c.Query("is_active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var parents []models.Parent
+	var total int64
+
+	query.Count(&total)
+
+	if err := query.Preload("Students.Student").Offset(offset).Limit(limit).Order("name").Find(&parents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch parents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"parents": parents,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+func GetParent(c *gin.Context) {
+	parent, ok := findParent(c)
+	if !ok {
+		return
+	}
+
+	database.DB.Preload("Students.Student").First(parent, parent.ID)
+	c.JSON(http.StatusOK, parent)
+}
+
+func CreateParent(c *gin.Context) {
+	var req ParentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" || req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and email are required"})
+		return
+	}
+
+	var existing models.Parent
+	if err := database.DB.Where("email = ?", req.Email).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	if len(req.StudentIDs) > 0 {
+		var count int64
+		database.DB.Model(&models.Student{}).Where("student_id IN ?", req.StudentIDs).Count(&count)
+		if int(count) != len(req.StudentIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "One or more students not found"})
+			return
+		}
+	}
+
+	parent := models.Parent{
+		Name:         req.Name,
+		Email:        req.Email,
+		PhoneNumber:  req.PhoneNumber,
+		Address:      req.Address,
+		Relationship: req.Relationship,
+		IsActive:     true,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&parent).Error; err != nil {
+			return err
+		}
+		return linkParentToStudents(tx, parent.ID, req.StudentIDs)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create parent"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "parent", parent.ID, nil, parent)
+	for _, studentID := range req.StudentIDs {
+		recordAudit(c, AuditLink, "student_parent", studentID, nil, gin.H{"parent_id": parent.ID, "student_id": studentID})
+	}
+
+	database.DB.Preload("Students.Student").First(&parent, parent.ID)
+	c.JSON(http.StatusCreated, parent)
+}
+
+func UpdateParent(c *gin.Context) {
+	parent, ok := findParent(c)
+	if !ok {
+		return
+	}
+
+	before := *parent
+
+	var req ParentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if email is being changed and if it already exists
+	if req.Email != "" && req.Email != parent.Email {
+		var existing models.Parent
+		if err := database.DB.Where("email = ? AND id != ?", req.Email, parent.ID).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+		parent.Email = req.Email
+	}
+
+	// Update fields
+	if req.Name != "" {
+		parent.Name = req.Name
+	}
+	if req.PhoneNumber != "" {
+		parent.PhoneNumber = req.PhoneNumber
+	}
+	if req.Address != "" {
+		parent.Address = req.Address
+	}
+	if req.Relationship != "" {
+		parent.Relationship = req.Relationship
+	}
+	if req.IsActive != nil {
+		parent.IsActive = *req.IsActive
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(parent).Error; err != nil {
+			return err
+		}
+		if before.IsActive && !parent.IsActive {
+			return revokeAllUserTokens(tx, parent.ID, "parent", "admin_revoke")
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update parent"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "parent", parent.ID, before, parent)
+
+	c.JSON(http.StatusOK, parent)
+}
+
+// DeactivateParent disables the account and signs the parent out everywhere.
+func DeactivateParent(c *gin.Context) {
+	parent, ok := findParent(c)
+	if !ok {
+		return
+	}
+
+	before := *parent
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(parent).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return revokeAllUserTokens(tx, parent.ID, "parent", "admin_revoke")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate parent"})
+		return
+	}
+
+	recordAudit(c, AuditDeactivate, "parent", parent.ID, before, parent)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Parent deactivated successfully"})
+}
+
+func LinkParentStudent(c *gin.Context) {
+	parent, ok := findParent(c)
+	if !ok {
+		return
+	}
+
+	var req LinkStudentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var student models.Student
+	if err := database.DB.Where("student_id = ?", req.StudentID).First(&student).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	if err := linkParentToStudents(database.DB, parent.ID, []string{student.StudentID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link student"})
+		return
+	}
+
+	recordAudit(c, AuditLink, "student_parent", student.StudentID, nil, gin.H{"parent_id": parent.ID, "student_id": student.StudentID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student linked successfully"})
+}
+
+func UnlinkParentStudent(c *gin.Context) {
+	parent, ok := findParent(c)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Where("parent_id = ? AND student_id = ?", parent.ID, c.Param("student_id")).
+		Delete(&models.StudentParent{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink student"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+
+	recordAudit(c, AuditUnlink, "student_parent", c.Param("student_id"), gin.H{"parent_id": parent.ID, "student_id": c.Param("student_id")}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student unlinked successfully"})
+}
+
+// ImportParentLinks bulk-links parents to students from an uploaded CSV with
+// the header student_id,parent_email[,parent_name,phone_number,relationship].
+// Unknown parents are created when a name is given. Every row is processed
+// independently and reported back.
+func ImportParentLinks(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV file"})
+		return
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["student_id"]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing student_id column"})
+		return
+	}
+	if _, ok := columns["parent_email"]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing parent_email column"})
+		return
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var results []ParentImportResult
+	linked := 0
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		result := ParentImportResult{Row: row}
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.StudentID = field(record, "student_id")
+		result.Email = field(record, "parent_email")
+		result.Status, err = importParentLink(result.StudentID, result.Email,
+			field(record, "parent_name"), field(record, "phone_number"), field(record, "relationship"))
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+		} else if result.Status == "linked" {
+			linked++
+			recordAudit(c, AuditLink, "student_parent", result.StudentID, nil, gin.H{"parent_email": result.Email, "student_id": result.StudentID})
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"linked":  linked,
+		"total":   len(results),
+	})
+}
+
+func importParentLink(studentID, email, name, phone, relationship string) (string, error) {
+	if studentID == "" || email == "" {
+		return "", errors.New("student_id and parent_email are required")
+	}
+
+	var student models.Student
+	if err := database.DB.Where("student_id = ?", studentID).First(&student).Error; err != nil {
+		return "", errors.New("student not found")
+	}
+
+	status := "linked"
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var parent models.Parent
+		err := tx.Where("email = ?", email).First(&parent).Error
+		if err == gorm.ErrRecordNotFound {
+			if name == "" {
+				return errors.New("parent not found and parent_name is empty")
+			}
+			parent = models.Parent{
+				Name:         name,
+				Email:        email,
+				PhoneNumber:  phone,
+				Relationship: relationship,
+				IsActive:     true,
+			}
+			if err := tx.Create(&parent).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		var count int64
+		tx.Model(&models.StudentParent{}).Where("parent_id = ? AND student_id = ?", parent.ID, studentID).Count(&count)
+		if count > 0 {
+			status = "already_linked"
+			return nil
+		}
+		return linkParentToStudents(tx, parent.ID, []string{studentID})
+	})
+
+	return status, err
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"school-attendance/database"
+	"school-attendance/mailer"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PasswordResetTTL is how long a reset link stays valid.
+const PasswordResetTTL = time.Hour
+
+// Reset requests are counted like failed logins so the endpoint cannot be
+// used to flood an inbox or probe many addresses from one client.
+var (
+	resetEmailThrottle = throttlePolicy{
+		BackoffAfter:    3,
+		LockoutAfter:    5,
+		LockoutDuration: time.Hour,
+		MaxBackoff:      5 * time.Minute,
+		Window:          time.Hour,
+	}
+	resetIPThrottle = throttlePolicy{
+		BackoffAfter:    10,
+		LockoutAfter:    30,
+		LockoutDuration: time.Hour,
+		MaxBackoff:      5 * time.Minute,
+		Window:          time.Hour,
+	}
+)
+
+type ForgotPasswordRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	UserType string `json:"user_type" binding:"required,oneof=student admin parent"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// accountModel returns an empty model for the given user type so password
+// updates can be written generically.
+func accountModel(userType string) interface{} {
+	switch userType {
+	case "student":
+		return &models.Student{}
+	case "admin":
+		return &models.Admin{}
+	case "parent":
+		return &models.Parent{}
+	}
+	return nil
+}
+
+// findAccountByEmail returns the id of the active account with the email.
+func findAccountByEmail(userType, email string) (uint, bool) {
+	model := accountModel(userType)
+	if model == nil {
+		return 0, false
+	}
+
+	var id uint
+	database.DB.Model(model).Select("id").Where("email = ? AND is_active = ?", email, true).Scan(&id)
+	return id, id != 0
+}
+
+// accountDirectoryDN returns the LDAP DN of the account, empty for accounts
+// with a local password.
+func accountDirectoryDN(userType string, userID uint) string {
+	var dn string
+	if userType == "student" || userType == "admin" {
+		database.DB.Model(accountModel(userType)).Select("directory_dn").Where("id = ?", userID).Scan(&dn)
+	}
+	return dn
+}
+
+func resetThrottleKey(userType, email string) string {
+	return "reset:" + userType + ":" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func resetIPThrottleKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// checkResetThrottle counts the request against the email and the client
+// IP and answers with 429 once either has asked too often. Unknown emails
+// are counted too so the answer does not reveal which ones exist.
+func checkResetThrottle(c *gin.Context, userType, email string) bool {
+	now := time.Now()
+	emailKey := resetThrottleKey(userType, email)
+	ipKey := resetIPThrottleKey(c.ClientIP())
+
+	var wait time.Duration
+	if t := loadThrottle(emailKey); t != nil {
+		wait = resetEmailThrottle.retryAfter(t, now)
+	}
+	if t := loadThrottle(ipKey); t != nil {
+		if w := resetIPThrottle.retryAfter(t, now); w > wait {
+			wait = w
+		}
+	}
+
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many password reset requests. Try again later.",
+			"retry_after": seconds,
+		})
+		return false
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := bumpThrottle(tx, emailKey, resetEmailThrottle, now); err != nil {
+			return err
+		}
+		return bumpThrottle(tx, ipKey, resetIPThrottle, now)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	return true
+}
+
+func resetPasswordURL(token string) string {
+	base := os.Getenv("RESET_PASSWORD_URL")
+	if base == "" {
+		base = "http://localhost:3000/reset-password"
+	}
+	return base + "?token=" + token
+}
+
+// createPasswordToken stores a new single-use token that lets the account
+// set its password, invalidating earlier unused ones.
+func createPasswordToken(tx *gorm.DB, userID uint, userType, requestIP string, ttl time.Duration) (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Only the most recent link stays usable
+	if err := tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND user_type = ? AND used_at IS NULL", userID, userType).
+		Update("used_at", time.Now()).Error; err != nil {
+		return "", err
+	}
+
+	err = tx.Create(&models.PasswordResetToken{
+		UserID:    userID,
+		UserType:  userType,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+		RequestIP: requestIP,
+	}).Error
+	return token, err
+}
+
+// ForgotPassword always answers with the same message so it cannot be used
+// to find out which emails are registered.
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkResetThrottle(c, req.UserType, req.Email) {
+		return
+	}
+
+	response := gin.H{"message": "If the account exists, a password reset link has been sent"}
+
+	// Directory accounts reset their password in the directory
+	userID, ok := findAccountByEmail(req.UserType, req.Email)
+	if !ok || passwordManagedByDirectory(accountDirectoryDN(req.UserType, userID)) {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	var token string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = createPasswordToken(tx, userID, req.UserType, c.ClientIP(), PasswordResetTTL)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	body := fmt.Sprintf("Kami menerima permintaan untuk mengatur ulang password akun Anda.\n\n"+
+		"Buka tautan berikut dalam %d menit:\n%s\n\n"+
+		"Abaikan email ini jika Anda tidak meminta reset password.\n",
+		int(PasswordResetTTL.Minutes()), resetPasswordURL(token))
+
+	go func(to string) {
+		if err := mailer.Send(to, "Reset Password - Sistem Presensi", body); err != nil {
+			log.Printf("Error sending password reset email: %v", err)
+		}
+	}(req.Email)
+
+	c.JSON(http.StatusOK, response)
+}
+
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkPasswordLength(c, req.Password) {
+		return
+	}
+
+	var reset models.PasswordResetToken
+	if err := database.DB.Where("token_hash = ?", hashToken(req.Token)).First(&reset).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	// A link sent before the account moved to the directory must not set a
+	// local password the login no longer checks
+	if passwordManagedByDirectory(accountDirectoryDN(reset.UserType, reset.UserID)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the school directory"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the token first so concurrent requests cannot both use it
+		result := tx.Model(&reset).Where("used_at IS NULL").Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		updates := map[string]interface{}{"password": string(hashedPassword)}
+		if reset.UserType == "admin" {
+			// The password was just chosen by its owner
+			updates["must_change_password"] = false
+		}
+		if err := tx.Model(accountModel(reset.UserType)).Where("id = ?", reset.UserID).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Sign out every existing session after a password change
+		return revokeAllUserTokens(tx, reset.UserID, reset.UserType, "password_reset")
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully"})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/directory"
+	"school-attendance/mailer"
+	"school-attendance/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func init() {
+	testModels = append(testModels, &models.PasswordResetToken{}, &models.LoginThrottle{})
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(mailer.Message) error { return nil }
+
+func passwordResetRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	mailer.SetMailer(discardMailer{})
+	r := gin.New()
+	r.POST("/forgot-password", ForgotPassword)
+	r.POST("/reset-password", ResetPassword)
+	return r
+}
+
+// useDirectoryAuth enables LDAP password checks for the test.
+func useDirectoryAuth(t *testing.T) {
+	t.Helper()
+	t.Cleanup(directory.Init)
+	t.Setenv("LDAP_URL", "ldap://127.0.0.1:1")
+	t.Setenv("LDAP_AUTH", "true")
+	directory.Init()
+}
+
+func resetTokenFor(t *testing.T, userID uint, userType string) string {
+	t.Helper()
+	var token string
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = createPasswordToken(tx, userID, userType, "127.0.0.1", PasswordResetTTL)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestForgotPasswordThrottled(t *testing.T) {
+	setupTestDB(t)
+	createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := passwordResetRouter(t)
+
+	for _, email := range []string{"s1@school.id", "nobody@school.id"} {
+		for i := 0; i < resetEmailThrottle.LockoutAfter; i++ {
+			w := doJSON(t, r, http.MethodPost, "/forgot-password", ForgotPasswordRequest{Email: email, UserType: "student"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s request %d: %d %s", email, i+1, w.Code, w.Body.String())
+			}
+			// Step past the backoff; only the lockout should stop the next one
+			database.DB.Model(&models.LoginThrottle{}).Where("throttle_key = ?", resetThrottleKey("student", email)).
+				Update("last_failure_at", time.Now().Add(-resetEmailThrottle.MaxBackoff))
+		}
+
+		w := doJSON(t, r, http.MethodPost, "/forgot-password", ForgotPasswordRequest{Email: email, UserType: "student"})
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s after %d requests: %d, want 429 with Retry-After", email, resetEmailThrottle.LockoutAfter, w.Code)
+		}
+	}
+
+	var tokens int64
+	database.DB.Model(&models.PasswordResetToken{}).Count(&tokens)
+	if tokens != int64(resetEmailThrottle.LockoutAfter) {
+		t.Errorf("%d reset tokens created, want %d", tokens, resetEmailThrottle.LockoutAfter)
+	}
+}
+
+func TestResetPasswordMinimumLength(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := passwordResetRouter(t)
+	token := resetTokenFor(t, student.ID, "student")
+
+	short := "Pass123"
+	if w := doJSON(t, r, http.MethodPost, "/reset-password", ResetPasswordRequest{Token: token, Password: short}); w.Code != http.StatusBadRequest {
+		t.Fatalf("%d character password: %d, want 400", len(short), w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/reset-password", ResetPasswordRequest{Token: token, Password: "Password2"}); w.Code != http.StatusOK {
+		t.Fatalf("reset after a rejected password: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestResetPasswordDirectoryAccount(t *testing.T) {
+	setupTestDB(t)
+	useDirectoryAuth(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	database.DB.Model(&student).Update("directory_dn", "cn=s1,ou=students,dc=school,dc=id")
+	r := passwordResetRouter(t)
+
+	// An older link must not set a local password
+	token := resetTokenFor(t, student.ID, "student")
+	if w := doJSON(t, r, http.MethodPost, "/reset-password", ResetPasswordRequest{Token: token, Password: "Password2"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("reset: %d, want 400", w.Code)
+	}
+	var stored models.Student
+	database.DB.First(&stored, student.ID)
+	if stored.Password != student.Password {
+		t.Error("password of a directory account changed")
+	}
+
+	database.DB.Where("1 = 1").Delete(&models.PasswordResetToken{})
+	if w := doJSON(t, r, http.MethodPost, "/forgot-password", ForgotPasswordRequest{Email: "s1@school.id", UserType: "student"}); w.Code != http.StatusOK {
+		t.Fatalf("forgot password: %d, want the usual 200", w.Code)
+	}
+	var tokens int64
+	database.DB.Model(&models.PasswordResetToken{}).Count(&tokens)
+	if tokens != 0 {
+		t.Errorf("%d reset tokens created for a directory account", tokens)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"school-attendance/database"
+	"school-attendance/models"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,25 +16,20 @@ import (
 	"gorm.io/gorm"
 )
 
-type QRSession struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	SessionCode string    `json:"session_code" gorm:"unique;not null"`
-	Subject     string    `json:"subject"`
-	Teacher     string    `json:"teacher"`
-	Location    string    `json:"location"`
-	ExpiresAt   time.Time `json:"expires_at"`
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-}
-
-type QRAttendance struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	SessionCode string    `json:"session_code"`
-	StudentID   string    `json:"student_id"`
-	ScanTime    time.Time `json:"scan_time"`
-	Location    string    `json:"location"`
-	CreatedAt   time.Time `json:"created_at"`
+// allowQRSession answers with 403 unless the caller opened the session or
+// teaches its class and subject.
+func allowQRSession(c *gin.Context, scope *classScope, session models.QRSession) bool {
+	if scope.All {
+		return true
+	}
+	if session.TeacherID != nil && *session.TeacherID == c.GetUint("user_id") && c.GetString("user_type") == "admin" {
+		return true
+	}
+	if session.Class != "" && scope.AllowsSubject(session.Class, session.Subject) {
+		return true
+	}
+	denyClass(c)
+	return false
 }
 
 func generateSessionCode() string {
@@ -44,8 +41,10 @@ func generateSessionCode() string {
 func GenerateQRCode(c *gin.Context) {
 	var request struct {
 		Subject  string `json:"subject" binding:"required"`
-		Teacher  string `json:"teacher" binding:"required"`
+		Teacher  string `json:"teacher"` // defaults to the admin's name
+		Class    string `json:"class"`   // required for teachers limited to their classes
 		Location string `json:"location" binding:"required"`
+		Period   int    `json:"period"`   // defaults to the lesson in progress
 		Duration int    `json:"duration"` // Duration in minutes, default 30
 	}
 
@@ -54,6 +53,26 @@ func GenerateQRCode(c *gin.Context) {
 		return
 	}
 
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.All && request.Class == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class is required"})
+		return
+	}
+	if request.Class != "" && !scope.AllowsSubject(request.Class, request.Subject) {
+		denyClass(c)
+		return
+	}
+
+	// A session opened outside lesson time is not tied to a period
+	period, err := checkInPeriod(request.Period, request.Subject, time.Now())
+	if err != nil && err != errNoPeriodInProgress {
+		periodError(c, err)
+		return
+	}
+
 	duration := request.Duration
 	if duration == 0 {
 		duration = 30 // Default 30 minutes
@@ -62,26 +81,50 @@ func GenerateQRCode(c *gin.Context) {
 	sessionCode := generateSessionCode()
 	expiresAt := time.Now().Add(time.Duration(duration) * time.Minute)
 
-	qrSession := QRSession{
+	qrSession := models.QRSession{
 		SessionCode: sessionCode,
 		Subject:     request.Subject,
 		Teacher:     request.Teacher,
+		Class:       request.Class,
 		Location:    request.Location,
 		ExpiresAt:   expiresAt,
 		IsActive:    true,
 	}
+	if period != nil {
+		qrSession.Period = period.Number
+	}
+
+	db := database.DB
+
+	if c.GetString("user_type") == "admin" {
+		adminID := c.GetUint("user_id")
+		qrSession.TeacherID = &adminID
 
-	db := c.MustGet("db").(*gorm.DB)
+		if qrSession.Teacher == "" {
+			var admin models.Admin
+			if err := db.Select("id", "name").First(&admin, adminID).Error; err == nil {
+				qrSession.Teacher = admin.Name
+			}
+		}
+	}
+	if qrSession.Teacher == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher is required"})
+		return
+	}
 	if err := db.Create(&qrSession).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create QR session"})
 		return
 	}
 
+	recordAudit(c, AuditCreate, "qr_session", qrSession.SessionCode, nil, qrSession)
+
 	// Create QR code data
 	qrData := map[string]interface{}{
 		"session_code": sessionCode,
 		"subject":      request.Subject,
-		"teacher":      request.Teacher,
+		"teacher":      qrSession.Teacher,
+		"class":        qrSession.Class,
+		"period":       qrSession.Period,
 		"location":     request.Location,
 		"expires_at":   expiresAt.Unix(),
 	}
@@ -100,16 +143,23 @@ func GenerateQRCode(c *gin.Context) {
 		"qr_code":      qrCode,
 		"expires_at":   expiresAt,
 		"subject":      request.Subject,
-		"teacher":      request.Teacher,
+		"teacher":      qrSession.Teacher,
+		"class":        qrSession.Class,
+		"period":       qrSession.Period,
 		"location":     request.Location,
 	})
 }
 
 func ScanQRCode(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
 	var request struct {
-		QRData    string `json:"qr_data" binding:"required"`
-		StudentID string `json:"student_id" binding:"required"`
-		Location  string `json:"location"`
+		QRData   string `json:"qr_data" binding:"required"`
+		Location string `json:"location"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -142,63 +192,120 @@ func ScanQRCode(c *gin.Context) {
 		return
 	}
 
-	db := c.MustGet("db").(*gorm.DB)
+	db := database.DB
 
 	// Check if QR session exists and is active
-	var qrSession QRSession
+	var qrSession models.QRSession
 	if err := db.Where("session_code = ? AND is_active = ?", sessionCode, true).First(&qrSession).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "QR session not found or inactive"})
 		return
 	}
 
-	// Check if student already scanned this QR code
-	var existingAttendance QRAttendance
-	if err := db.Where("session_code = ? AND student_id = ?", sessionCode, request.StudentID).First(&existingAttendance).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Student already marked attendance for this session"})
+	// The scan is always for the signed-in student, whatever the body says
+	var student models.Student
+	if err := db.First(&student, userID.(uint)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	if qrSession.Class != "" && student.Class != qrSession.Class {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Student is not in the class for this session"})
+		return
+	}
+	if rejectLockedCheckIn(c, student.ID, time.Now()) {
 		return
 	}
 
 	// Create attendance record
-	qrAttendance := QRAttendance{
+	scanTime := time.Now()
+	var period *models.LessonPeriod
+	if qrSession.Period > 0 {
+		if p, err := checkInPeriod(qrSession.Period, "", scanTime); err == nil {
+			period = p
+		}
+	}
+	in := newCheckIn(student, qrSession.Subject, period, scanTime)
+	status, lateMinutes := in.Status, in.LateMinutes
+	qrAttendance := models.QRAttendance{
 		SessionCode: sessionCode,
-		StudentID:   request.StudentID,
-		ScanTime:    time.Now(),
+		StudentID:   student.StudentID,
+		ScanTime:    scanTime,
+		Status:      status,
+		LateMinutes: lateMinutes,
 		Location:    request.Location,
 	}
 
-	if err := db.Create(&qrAttendance).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attendance"})
+	// The scan also checks the student in, so reports and the auto absence
+	// job see it. The unique index turns a repeated or concurrent scan into
+	// a duplicate key error instead of a second row
+	err := attendanceDB(c, "QR check-in").Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&qrAttendance).Error; err != nil {
+			return err
+		}
+		_, _, err := recordCheckIn(tx, student.ID, in)
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// A repeated scan gets the first scan's answer without notifying again
+		var existing models.QRAttendance
+		if err := db.Where("session_code = ? AND student_id = ?", sessionCode, student.StudentID).First(&existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attendance"})
+			return
+		}
+		c.JSON(http.StatusOK, qrScanResponse(student, qrSession, existing))
 		return
 	}
-
-	// Get student information for notification
-	var student Student
-	if err := db.Where("student_id = ?", request.StudentID).First(&student).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attendance"})
 		return
 	}
 
 	// Send real-time notification
-	SendAttendanceNotification(student.Name, "hadir via QR Code", time.Now())
+	SendAttendanceNotification(student.Name, arrivalLabel(status)+" via QR Code", scanTime)
 
 	// Send parent notification
 	SendParentNotification(int(student.ID), student.Name, 
-		fmt.Sprintf("hadir di %s pada %s", qrSession.Subject, time.Now().Format("15:04")))
+		fmt.Sprintf("%s di %s pada %s", arrivalLabel(status), qrSession.Subject, scanTime.Format("15:04")))
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, qrScanResponse(student, qrSession, qrAttendance))
+}
+
+// qrScanResponse is the body answering a student's scan of a session.
+func qrScanResponse(student models.Student, qrSession models.QRSession, scan models.QRAttendance) gin.H {
+	return gin.H{
 		"message":      "Attendance recorded successfully",
 		"student_name": student.Name,
 		"subject":      qrSession.Subject,
 		"teacher":      qrSession.Teacher,
-		"scan_time":    qrAttendance.ScanTime,
-	})
+		"period":       qrSession.Period,
+		"scan_time":    scan.ScanTime,
+		"status":       scan.Status,
+		"late_minutes": scan.LateMinutes,
+	}
 }
 
 func GetQRSessions(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
+	db := database.DB
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	query := db.Where("is_active = ?", true)
+	if !scope.All {
+		// Sessions the teacher opened, plus those for the classes they teach
+		mine := db.Where("teacher_id = ?", c.GetUint("user_id"))
+		if c.GetString("user_type") != "admin" {
+			mine = db.Where("1 = 0")
+		}
+		if classes := scope.Classes(); len(classes) > 0 {
+			mine = mine.Or("class IN ?", classes)
+		}
+		query = query.Where(mine)
+	}
 
-	var sessions []QRSession
-	if err := db.Where("is_active = ?", true).Order("created_at DESC").Find(&sessions).Error; err != nil {
+	var sessions []models.QRSession
+	if err := query.Order("created_at DESC").Find(&sessions).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch QR sessions"})
 		return
 	}
@@ -208,22 +315,54 @@ func GetQRSessions(c *gin.Context) {
 
 func DeactivateQRSession(c *gin.Context) {
 	sessionCode := c.Param("session_code")
-	db := c.MustGet("db").(*gorm.DB)
+	db := database.DB
+
+	var session models.QRSession
+	if err := db.Where("session_code = ?", sessionCode).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !allowQRSession(c, scope, session) {
+		return
+	}
 
-	if err := db.Model(&QRSession{}).Where("session_code = ?", sessionCode).Update("is_active", false).Error; err != nil {
+	before := session
+
+	if err := db.Model(&session).Update("is_active", false).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate QR session"})
 		return
 	}
 
+	recordAudit(c, AuditDeactivate, "qr_session", sessionCode, before, session)
+
 	c.JSON(http.StatusOK, gin.H{"message": "QR session deactivated successfully"})
 }
 
 func GetQRAttendanceReport(c *gin.Context) {
 	sessionCode := c.Param("session_code")
-	db := c.MustGet("db").(*gorm.DB)
+	db := database.DB
+
+	// Get session information
+	var session models.QRSession
+	if err := db.Where("session_code = ?", sessionCode).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !allowQRSession(c, scope, session) {
+		return
+	}
 
 	var attendances []struct {
-		QRAttendance
+		models.QRAttendance
 		StudentName string `json:"student_name"`
 		Class       string `json:"class"`
 		Grade       string `json:"grade"`
@@ -242,13 +381,6 @@ func GetQRAttendanceReport(c *gin.Context) {
 		return
 	}
 
-	// Get session information
-	var session QRSession
-	if err := db.Where("session_code = ?", sessionCode).First(&session).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"session":     session,
 		"attendances": attendances,
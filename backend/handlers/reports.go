@@ -3,13 +3,14 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"strconv"
+	"school-attendance/database"
+	"school-attendance/models"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jung-kurt/gofpdf"
 	"github.com/tealeg/xlsx/v3"
-	"gorm.io/gorm"
 )
 
 type AttendanceReport struct {
@@ -25,16 +26,55 @@ type AttendanceReport struct {
 	Notes       string    `json:"notes"`
 }
 
-func ExportAttendanceToPDF(c *gin.Context) {
-	// Get query parameters
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-	class := c.Query("class")
-	grade := c.Query("grade")
+// countSchoolDays counts the school days in a report period per the
+// academic calendar. ok is false when the dates cannot be used.
+func countSchoolDays(startDate, endDate string) (int, bool) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return 0, false
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil || end.Before(start) {
+		return 0, false
+	}
 
-	db := c.MustGet("db").(*gorm.DB)
+	cal, err := loadSchoolCalendar(start, end)
+	if err != nil {
+		return 0, false
+	}
+	return len(cal.SchoolDays(start, end)), true
+}
+
+// reportDates parses the optional start_date and end_date filters of a
+// report; an unset date is zero. It answers with 400 and returns false when
+// one is malformed.
+func reportDates(c *gin.Context) (start, end time.Time, ok bool) {
+	var err error
+	if date := c.Query("start_date"); date != "" {
+		if start, err = time.Parse("2006-01-02", date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+			return start, end, false
+		}
+	}
+	if date := c.Query("end_date"); date != "" {
+		if end, err = time.Parse("2006-01-02", date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+			return start, end, false
+		}
+	}
+	return start, end, true
+}
+
+// loadAttendanceReport loads the rows of the exported attendance report,
+// filtered by the request's dates, class and grade and the caller's scope.
+// Students without records are listed once; records on holidays and other
+// non-school days are left out, as in the statistics.
+func loadAttendanceReport(c *gin.Context) ([]AttendanceReport, bool) {
+	start, end, ok := reportDates(c)
+	if !ok {
+		return nil, false
+	}
 
-	// Build query
 	query := `
 		SELECT 
 			s.student_id,
@@ -48,34 +88,91 @@ func ExportAttendanceToPDF(c *gin.Context) {
 			a.subject,
 			a.notes
 		FROM students s
-		LEFT JOIN attendances a ON s.student_id = a.student_id
-		WHERE 1=1
+		LEFT JOIN attendances a ON a.student_id = s.id AND a.deleted_at IS NULL
+		WHERE s.deleted_at IS NULL
 	`
 
 	args := []interface{}{}
 
-	if startDate != "" {
+	if !start.IsZero() {
 		query += " AND a.date >= ?"
-		args = append(args, startDate)
+		args = append(args, start)
 	}
-	if endDate != "" {
+	if !end.IsZero() {
 		query += " AND a.date <= ?"
-		args = append(args, endDate)
+		args = append(args, end)
 	}
-	if class != "" {
+	if class := c.Query("class"); class != "" {
 		query += " AND s.class = ?"
 		args = append(args, class)
 	}
-	if grade != "" {
+	if grade := c.Query("grade"); grade != "" {
 		query += " AND s.grade = ?"
 		args = append(args, grade)
 	}
 
-	query += " ORDER BY s.class, s.name, a.date"
+	scope, ok := callerScope(c)
+	if !ok {
+		return nil, false
+	}
+	if condition, scopeArgs := scope.AttendanceCondition("s.class", "a.subject"); condition != "" {
+		query += " AND " + condition
+		args = append(args, scopeArgs...)
+	}
+
+	query += " ORDER BY s.class, s.name, a.date, a.period"
 
-	var reports []AttendanceReport
-	if err := db.Raw(query, args...).Scan(&reports).Error; err != nil {
+	var rows []AttendanceReport
+	if err := database.DB.Raw(query, args...).Scan(&rows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance data"})
+		return nil, false
+	}
+
+	from, to := recordedRange(len(rows), func(i int) time.Time { return rows[i].Date })
+	cal, err := loadSchoolCalendar(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load school calendar"})
+		return nil, false
+	}
+
+	reports := []AttendanceReport{}
+	for _, row := range rows {
+		if !row.Date.IsZero() && !cal.IsSchoolDay(row.Date) {
+			continue
+		}
+		reports = append(reports, row)
+	}
+	return reports, true
+}
+
+// recordedRange returns the first and last of n record dates, skipping
+// zero dates, for loading the school calendar they need.
+func recordedRange(n int, date func(i int) time.Time) (from, to time.Time) {
+	from = time.Now()
+	for i := 0; i < n; i++ {
+		d := date(i)
+		if d.IsZero() {
+			continue
+		}
+		if d.Before(from) {
+			from = d
+		}
+		if d.After(to) {
+			to = d
+		}
+	}
+	return from, to
+}
+
+func ExportAttendanceToPDF(c *gin.Context) {
+	// Get query parameters
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+	class := c.Query("class")
+	grade := c.Query("grade")
+
+	reports, ok := loadAttendanceReport(c)
+	if !ok {
 		return
 	}
 
@@ -93,6 +190,10 @@ func ExportAttendanceToPDF(c *gin.Context) {
 	if startDate != "" && endDate != "" {
 		pdf.Cell(0, 5, fmt.Sprintf("Periode: %s - %s", startDate, endDate))
 		pdf.Ln(5)
+		if schoolDays, ok := countSchoolDays(startDate, endDate); ok {
+			pdf.Cell(0, 5, fmt.Sprintf("Jumlah hari sekolah: %d", schoolDays))
+			pdf.Ln(5)
+		}
 	}
 	if class != "" {
 		pdf.Cell(0, 5, fmt.Sprintf("Kelas: %s", class))
@@ -164,53 +265,9 @@ func ExportAttendanceToExcel(c *gin.Context) {
 	// Get query parameters
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
-	class := c.Query("class")
-	grade := c.Query("grade")
-
-	db := c.MustGet("db").(*gorm.DB)
-
-	// Build query (same as PDF)
-	query := `
-		SELECT 
-			s.student_id,
-			s.name as student_name,
-			s.class,
-			s.grade,
-			a.date,
-			a.check_in_time as check_in,
-			a.check_out_time as check_out,
-			a.status,
-			a.subject,
-			a.notes
-		FROM students s
-		LEFT JOIN attendances a ON s.student_id = a.student_id
-		WHERE 1=1
-	`
 
-	args := []interface{}{}
-
-	if startDate != "" {
-		query += " AND a.date >= ?"
-		args = append(args, startDate)
-	}
-	if endDate != "" {
-		query += " AND a.date <= ?"
-		args = append(args, endDate)
-	}
-	if class != "" {
-		query += " AND s.class = ?"
-		args = append(args, class)
-	}
-	if grade != "" {
-		query += " AND s.grade = ?"
-		args = append(args, grade)
-	}
-
-	query += " ORDER BY s.class, s.name, a.date"
-
-	var reports []AttendanceReport
-	if err := db.Raw(query, args...).Scan(&reports).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance data"})
+	reports, ok := loadAttendanceReport(c)
+	if !ok {
 		return
 	}
 
@@ -236,6 +293,10 @@ func ExportAttendanceToExcel(c *gin.Context) {
 		filterRow := sheet.AddRow()
 		filterCell := filterRow.AddCell()
 		filterCell.Value = fmt.Sprintf("Periode: %s - %s", startDate, endDate)
+		if schoolDays, ok := countSchoolDays(startDate, endDate); ok {
+			daysCell := sheet.AddRow().AddCell()
+			daysCell.Value = fmt.Sprintf("Jumlah hari sekolah: %d", schoolDays)
+		}
 	}
 
 	// Add empty row
@@ -310,13 +371,11 @@ func ExportAttendanceToExcel(c *gin.Context) {
 	}
 
 	// Auto-resize columns
-	for i := 0; i < len(headers); i++ {
-		sheet.Col(i).Width = 15
-	}
+	sheet.SetColWidth(1, len(headers), 15)
 
 	// Add footer
+	sheet.AddRow() // Empty row
 	footerRow := sheet.AddRow()
-	footerRow.AddRow() // Empty row
 	footerCell := footerRow.AddCell()
 	footerCell.Value = fmt.Sprintf("Dicetak pada: %s", time.Now().Format("02/01/2006 15:04"))
 
@@ -330,101 +389,147 @@ func ExportAttendanceToExcel(c *gin.Context) {
 	}
 }
 
-func GetAttendanceStats(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
+// reportStatusCounts tallies students' days by their rolled-up status.
+type reportStatusCounts struct {
+	Present int64 `json:"present"`
+	Absent  int64 `json:"absent"`
+	Late    int64 `json:"late"`
+	Excused int64 `json:"excused"`
+}
 
-	// Get query parameters
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-	class := c.Query("class")
-	grade := c.Query("grade")
+func (counts *reportStatusCounts) add(status string) {
+	switch status {
+	case models.StatusPresent:
+		counts.Present++
+	case models.StatusAbsent:
+		counts.Absent++
+	case models.StatusLate:
+		counts.Late++
+	case models.StatusExcused:
+		counts.Excused++
+	}
+}
 
-	// Build base query
-	baseQuery := "FROM attendances a JOIN students s ON a.student_id = s.student_id WHERE 1=1"
-	args := []interface{}{}
+// GetReportStats returns the totals, last week's daily counts and the
+// per-class counts shown on the analytics dashboard. Like
+// GetAttendanceStats it counts each student's day once, rolled up from its
+// lesson periods, and ignores records on non-school days.
+func GetReportStats(c *gin.Context) {
+	start, end, ok := reportDates(c)
+	if !ok {
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
 
-	if startDate != "" {
-		baseQuery += " AND a.date >= ?"
-		args = append(args, startDate)
+	query := database.DB.Model(&models.Attendance{}).
+		Joins("JOIN students ON attendances.student_id = students.id")
+	query = scope.ScopeAttendance(query, "students.class", "attendances.subject")
+
+	if !start.IsZero() {
+		query = query.Where("attendances.date >= ?", start)
 	}
-	if endDate != "" {
-		baseQuery += " AND a.date <= ?"
-		args = append(args, endDate)
+	if !end.IsZero() {
+		query = query.Where("attendances.date <= ?", end)
 	}
-	if class != "" {
-		baseQuery += " AND s.class = ?"
-		args = append(args, class)
+	if class := c.Query("class"); class != "" {
+		query = query.Where("students.class = ?", class)
 	}
-	if grade != "" {
-		baseQuery += " AND s.grade = ?"
-		args = append(args, grade)
+	if grade := c.Query("grade"); grade != "" {
+		query = query.Where("students.grade = ?", grade)
 	}
 
-	// Get overall stats
-	var totalStudents, presentCount, absentCount, lateCount, excusedCount int64
-
-	// Total students
-	studentQuery := "SELECT COUNT(DISTINCT s.student_id) " + baseQuery
-	db.Raw(studentQuery, args...).Scan(&totalStudents)
+	days, err := rollupAttendance(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance statistics"})
+		return
+	}
 
-	// Present count
-	presentQuery := "SELECT COUNT(*) " + baseQuery + " AND a.status = 'present'"
-	db.Raw(presentQuery, args...).Scan(&presentCount)
+	from, to := recordedRange(len(days), func(i int) time.Time { return days[i].Date })
+	cal, err := loadSchoolCalendar(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load school calendar"})
+		return
+	}
 
-	// Absent count
-	absentQuery := "SELECT COUNT(*) " + baseQuery + " AND a.status = 'absent'"
-	db.Raw(absentQuery, args...).Scan(&absentCount)
+	// The class of each student counted, for the per-class totals
+	var studentIDs []uint
+	for _, day := range days {
+		if len(studentIDs) == 0 || studentIDs[len(studentIDs)-1] != day.StudentID {
+			studentIDs = append(studentIDs, day.StudentID)
+		}
+	}
+	var students []models.Student
+	if len(studentIDs) > 0 {
+		if err := database.DB.Unscoped().Select("id", "class").Where("id IN ?", studentIDs).Find(&students).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance statistics"})
+			return
+		}
+	}
+	classOf := map[uint]string{}
+	for _, student := range students {
+		classOf[student.ID] = student.Class
+	}
 
-	// Late count
-	lateQuery := "SELECT COUNT(*) " + baseQuery + " AND a.status = 'late'"
-	db.Raw(lateQuery, args...).Scan(&lateCount)
+	type dailyStat struct {
+		Date time.Time `json:"date"`
+		reportStatusCounts
+	}
+	type classStat struct {
+		Class string `json:"class"`
+		reportStatusCounts
+	}
 
-	// Excused count
-	excusedQuery := "SELECT COUNT(*) " + baseQuery + " AND a.status = 'excused'"
-	db.Raw(excusedQuery, args...).Scan(&excusedCount)
+	var overall reportStatusCounts
+	counted := map[uint]bool{}
+	weekAgo := dateOnly(time.Now()).AddDate(0, 0, -7)
+	daily := map[time.Time]*reportStatusCounts{}
+	byClass := map[string]*reportStatusCounts{}
+	for _, day := range days {
+		if !cal.IsSchoolDay(day.Date) {
+			continue
+		}
+		counted[day.StudentID] = true
+		overall.add(day.Status)
 
-	// Get daily stats for the last 7 days
-	dailyStatsQuery := `
-		SELECT 
-			a.date,
-			COUNT(CASE WHEN a.status = 'present' THEN 1 END) as present,
-			COUNT(CASE WHEN a.status = 'absent' THEN 1 END) as absent,
-			COUNT(CASE WHEN a.status = 'late' THEN 1 END) as late,
-			COUNT(CASE WHEN a.status = 'excused' THEN 1 END) as excused
-		` + baseQuery + `
-		AND a.date >= DATE('now', '-7 days')
-		GROUP BY a.date
-		ORDER BY a.date
-	`
+		if !day.Date.Before(weekAgo) {
+			if daily[day.Date] == nil {
+				daily[day.Date] = &reportStatusCounts{}
+			}
+			daily[day.Date].add(day.Status)
+		}
 
-	var dailyStats []map[string]interface{}
-	db.Raw(dailyStatsQuery, args...).Scan(&dailyStats)
+		class := classOf[day.StudentID]
+		if byClass[class] == nil {
+			byClass[class] = &reportStatusCounts{}
+		}
+		byClass[class].add(day.Status)
+	}
 
-	// Get class-wise stats
-	classStatsQuery := `
-		SELECT 
-			s.class,
-			COUNT(CASE WHEN a.status = 'present' THEN 1 END) as present,
-			COUNT(CASE WHEN a.status = 'absent' THEN 1 END) as absent,
-			COUNT(CASE WHEN a.status = 'late' THEN 1 END) as late,
-			COUNT(CASE WHEN a.status = 'excused' THEN 1 END) as excused
-		` + baseQuery + `
-		GROUP BY s.class
-		ORDER BY s.class
-	`
+	dailyStats := []dailyStat{}
+	for date, counts := range daily {
+		dailyStats = append(dailyStats, dailyStat{Date: date, reportStatusCounts: *counts})
+	}
+	sort.Slice(dailyStats, func(i, j int) bool { return dailyStats[i].Date.Before(dailyStats[j].Date) })
 
-	var classStats []map[string]interface{}
-	db.Raw(classStatsQuery, args...).Scan(&classStats)
+	classStats := []classStat{}
+	for class, counts := range byClass {
+		classStats = append(classStats, classStat{Class: class, reportStatusCounts: *counts})
+	}
+	sort.Slice(classStats, func(i, j int) bool { return classStats[i].Class < classStats[j].Class })
 
 	c.JSON(http.StatusOK, gin.H{
 		"overall": gin.H{
-			"total_students": totalStudents,
-			"present_count":  presentCount,
-			"absent_count":   absentCount,
-			"late_count":     lateCount,
-			"excused_count":  excusedCount,
+			"total_students": len(counted),
+			"present_count":  overall.Present,
+			"absent_count":   overall.Absent,
+			"late_count":     overall.Late,
+			"excused_count":  overall.Excused,
 		},
 		"daily_stats": dailyStats,
 		"class_stats": classStats,
 	})
-}
\ No newline at end of file
+}
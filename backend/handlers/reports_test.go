@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportFixture records two students' attendance over the last three days,
+// the first of which is a holiday:
+//
+//	S1 (X-1): yesterday lessons 1 present and 2 late, today present
+//	S2 (X-2): a record on the holiday, yesterday absent, today's deleted
+func reportFixture(t *testing.T) (today, holiday time.Time) {
+	t.Helper()
+	t.Setenv("SCHOOL_DAYS", "0,1,2,3,4,5,6")
+	today = dateOnly(time.Now())
+	yesterday := today.AddDate(0, 0, -1)
+	holiday = today.AddDate(0, 0, -2)
+
+	s1 := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	s2 := createTestStudent(t, "S2", "s2@school.id", "Password1")
+	database.DB.Model(&s2).Update("class", "X-2")
+
+	records := []models.Attendance{
+		{StudentID: s1.ID, Date: yesterday, Period: 1, Status: models.StatusPresent},
+		{StudentID: s1.ID, Date: yesterday, Period: 2, Status: models.StatusLate},
+		{StudentID: s1.ID, Date: today, Status: models.StatusPresent},
+		{StudentID: s2.ID, Date: holiday, Status: models.StatusPresent},
+		{StudentID: s2.ID, Date: yesterday, Status: models.StatusAbsent},
+		{StudentID: s2.ID, Date: today, Status: models.StatusPresent},
+	}
+	for i := range records {
+		if err := database.DB.Create(&records[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	database.DB.Delete(&records[5])
+
+	event := models.CalendarEvent{Name: "Libur", Type: models.EventHoliday, StartDate: holiday, EndDate: holiday}
+	if err := database.DB.Create(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	return today, holiday
+}
+
+func reportRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(asUser(1, "admin"), withPermissions(models.PermAll))
+	r.GET("/reports/stats", GetReportStats)
+	r.GET("/reports/rows", func(c *gin.Context) {
+		if rows, ok := loadAttendanceReport(c); ok {
+			c.JSON(http.StatusOK, rows)
+		}
+	})
+	return r
+}
+
+func TestReportStatsRollsUpSchoolDays(t *testing.T) {
+	setupTestDB(t)
+	reportFixture(t)
+
+	w := doJSON(t, reportRouter(), http.MethodGet, "/reports/stats", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: %d %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Overall struct {
+			TotalStudents int64 `json:"total_students"`
+			Present       int64 `json:"present_count"`
+			Absent        int64 `json:"absent_count"`
+			Late          int64 `json:"late_count"`
+		} `json:"overall"`
+		DailyStats []struct {
+			Date    time.Time `json:"date"`
+			Present int64     `json:"present"`
+		} `json:"daily_stats"`
+		ClassStats []struct {
+			Class   string `json:"class"`
+			Present int64  `json:"present"`
+			Absent  int64  `json:"absent"`
+			Late    int64  `json:"late"`
+		} `json:"class_stats"`
+	}
+	decodeJSON(t, w, &stats)
+
+	// Two lessons make one late day; the holiday and the deleted record
+	// are not counted
+	o := stats.Overall
+	if o.TotalStudents != 2 || o.Present != 1 || o.Late != 1 || o.Absent != 1 {
+		t.Errorf("overall = %+v, want 2 students, 1 present, 1 late, 1 absent", o)
+	}
+	if len(stats.DailyStats) != 2 {
+		t.Errorf("daily stats = %+v, want yesterday and today", stats.DailyStats)
+	}
+	if len(stats.ClassStats) != 2 || stats.ClassStats[0].Class != "X-1" || stats.ClassStats[0].Late != 1 ||
+		stats.ClassStats[1].Class != "X-2" || stats.ClassStats[1].Absent != 1 {
+		t.Errorf("class stats = %+v", stats.ClassStats)
+	}
+}
+
+func TestReportStatsFiltersByDate(t *testing.T) {
+	setupTestDB(t)
+	today, _ := reportFixture(t)
+
+	w := doJSON(t, reportRouter(), http.MethodGet, "/reports/stats?start_date="+today.Format("2006-01-02")+"&end_date="+today.Format("2006-01-02"), nil)
+	var stats struct {
+		Overall struct {
+			TotalStudents int64 `json:"total_students"`
+			Present       int64 `json:"present_count"`
+		} `json:"overall"`
+	}
+	decodeJSON(t, w, &stats)
+	if stats.Overall.TotalStudents != 1 || stats.Overall.Present != 1 {
+		t.Errorf("overall = %+v, want S1 present today", stats.Overall)
+	}
+
+	if w := doJSON(t, reportRouter(), http.MethodGet, "/reports/stats?start_date=yesterday", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed date: %d, want 400", w.Code)
+	}
+}
+
+func TestExportReportRows(t *testing.T) {
+	setupTestDB(t)
+	_, holiday := reportFixture(t)
+
+	w := doJSON(t, reportRouter(), http.MethodGet, "/reports/rows", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rows: %d %s", w.Code, w.Body.String())
+	}
+	var rows []AttendanceReport
+	decodeJSON(t, w, &rows)
+
+	if len(rows) != 4 {
+		t.Fatalf("%d rows, want S1's three records and S2's absence: %+v", len(rows), rows)
+	}
+	for _, row := range rows {
+		if row.Date.Equal(holiday) {
+			t.Errorf("row on the holiday: %+v", row)
+		}
+		if row.StudentID == "S2" && row.Status != models.StatusAbsent {
+			t.Errorf("S2 row = %+v, want only the absence", row)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// ResolvePermissions is installed into middleware.RequirePermission. Admins
+// get the permissions of their role; other user types have none.
+func ResolvePermissions(userID uint, userType string) ([]string, error) {
+	if userType != "admin" {
+		return []string{}, nil
+	}
+
+	var admin models.Admin
+	if err := database.DB.Select("id", "role").First(&admin, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	var role models.Role
+	if err := database.DB.Preload("Permissions").Where("name = ?", admin.Role).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	return role.PermissionNames(), nil
+}
+
+// roleAuditView flattens the permission list into a string so permission
+// changes show up in the audit diff.
+func roleAuditView(role models.Role) gin.H {
+	return gin.H{
+		"name":         role.Name,
+		"display_name": role.DisplayName,
+		"description":  role.Description,
+		"permissions":  strings.Join(role.PermissionNames(), ","),
+	}
+}
+
+func validatePermissions(permissions []string) (string, bool) {
+	for _, perm := range permissions {
+		if !models.IsValidPermission(perm) {
+			return perm, false
+		}
+	}
+	return "", true
+}
+
+// checkPermissionsGrantable answers with 403 unless the caller holds every
+// permission, so nobody can hand out more than they have themselves.
+func checkPermissionsGrantable(c *gin.Context, permissions []string) bool {
+	granted, _ := c.Get("permissions")
+	held, _ := granted.([]string)
+	for _, perm := range permissions {
+		if !models.HasPermission(held, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant permission: " + perm})
+			return false
+		}
+	}
+	return true
+}
+
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": models.AllPermissions})
+}
+
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+func CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is required"})
+		return
+	}
+	if perm, ok := validatePermissions(req.Permissions); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + perm})
+		return
+	}
+	if !checkPermissionsGrantable(c, req.Permissions) {
+		return
+	}
+
+	var existing models.Role
+	if err := database.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+	}
+	for _, perm := range req.Permissions {
+		role.Permissions = append(role.Permissions, models.RolePermission{Permission: perm})
+	}
+
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "role", role.ID, nil, roleAuditView(role))
+
+	c.JSON(http.StatusCreated, role)
+}
+
+func UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if perm, ok := validatePermissions(req.Permissions); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + perm})
+		return
+	}
+
+	var role models.Role
+	if err := database.DB.First(&role, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	database.DB.Preload("Permissions").First(&role, role.ID)
+	before := roleAuditView(role)
+
+	if role.Name == models.RoleSuperAdmin && req.Permissions != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Super admin permissions cannot be changed"})
+		return
+	}
+	// Editing a role affects everyone holding it, so the caller must hold
+	// both its current and its new permissions
+	if !checkPermissionsGrantable(c, role.PermissionNames()) || !checkPermissionsGrantable(c, req.Permissions) {
+		return
+	}
+
+	if req.DisplayName != "" {
+		role.DisplayName = req.DisplayName
+	}
+	if req.Description != "" {
+		role.Description = req.Description
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Save(&role).Error; err != nil {
+			return err
+		}
+		if req.Permissions == nil {
+			return nil
+		}
+
+		// Replace the permission set wholesale
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		for _, perm := range req.Permissions {
+			if err := tx.Create(&models.RolePermission{RoleID: role.ID, Permission: perm}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	database.DB.Preload("Permissions").First(&role, role.ID)
+	recordAudit(c, AuditUpdate, "role", role.ID, before, roleAuditView(role))
+
+	c.JSON(http.StatusOK, role)
+}
+
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var role models.Role
+	if err := database.DB.First(&role, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if role.IsSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "System roles cannot be deleted"})
+		return
+	}
+
+	var inUse int64
+	database.DB.Model(&models.Admin{}).Where("role = ?", role.Name).Count(&inUse)
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to admins"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "role", role.ID, roleAuditView(role), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	testModels = append(testModels, &models.Role{}, &models.RolePermission{})
+}
+
+func roleRouter(perms ...string) *gin.Engine {
+	r := gin.New()
+	r.Use(asUser(1, "admin"), withPermissions(perms...))
+	r.POST("/roles", CreateRole)
+	r.PUT("/roles/:id", UpdateRole)
+	return r
+}
+
+func TestCreateRoleRejectsUnheldPermission(t *testing.T) {
+	setupTestDB(t)
+	r := roleRouter(models.PermRolesManage, models.PermAttendanceRead)
+
+	w := doJSON(t, r, http.MethodPost, "/roles", RoleRequest{Name: "piket", Permissions: []string{models.PermAttendanceRead, models.PermAttendanceUpdate}})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("unheld permission: %d, want 403", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/roles", RoleRequest{Name: "piket", Permissions: []string{"*"}}); w.Code != http.StatusForbidden {
+		t.Fatalf("wildcard: %d, want 403", w.Code)
+	}
+
+	var count int64
+	database.DB.Model(&models.Role{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d roles created", count)
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/roles", RoleRequest{Name: "piket", Permissions: []string{models.PermAttendanceRead}}); w.Code != http.StatusCreated {
+		t.Errorf("held permission: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUpdateRoleRejectsUnheldPermission(t *testing.T) {
+	setupTestDB(t)
+	role := models.Role{Name: "guru", Permissions: []models.RolePermission{{Permission: models.PermAttendanceRead}}}
+	database.DB.Create(&role)
+	path := "/roles/" + strconv.FormatUint(uint64(role.ID), 10)
+
+	r := roleRouter(models.PermRolesManage, models.PermAttendanceRead)
+	if w := doJSON(t, r, http.MethodPut, path, RoleRequest{Permissions: []string{models.PermUsersManage}}); w.Code != http.StatusForbidden {
+		t.Fatalf("unheld permission: %d, want 403", w.Code)
+	}
+	var stored models.Role
+	database.DB.Preload("Permissions").First(&stored, role.ID)
+	if perms := stored.PermissionNames(); len(perms) != 1 || perms[0] != models.PermAttendanceRead {
+		t.Fatalf("permissions = %v, want unchanged", perms)
+	}
+
+	// A role holding more than the caller cannot be edited at all
+	weaker := roleRouter(models.PermRolesManage)
+	if w := doJSON(t, weaker, http.MethodPut, path, RoleRequest{Permissions: []string{}}); w.Code != http.StatusForbidden {
+		t.Errorf("role above the caller: %d, want 403", w.Code)
+	}
+
+	if w := doJSON(t, r, http.MethodPut, path, RoleRequest{Description: "Guru mapel"}); w.Code != http.StatusOK {
+		t.Errorf("update: %d %s", w.Code, w.Body.String())
+	}
+}
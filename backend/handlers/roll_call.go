@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RollCallEntry is one student's status in a roll call. StudentID is the
+// student's database ID, as elsewhere in the attendance API.
+type RollCallEntry struct {
+	StudentID uint   `json:"student_id" binding:"required"`
+	Status    string `json:"status" binding:"required"`
+	Notes     string `json:"notes"`
+}
+
+type RollCallRequest struct {
+	Class   string          `json:"class" binding:"required"`
+	Date    string          `json:"date"` // YYYY-MM-DD, default today
+	Period  int             `json:"period" binding:"min=0"`
+	Subject string          `json:"subject"`
+	Reason  string          `json:"reason"` // kept in the history of changed records
+	Entries []RollCallEntry `json:"entries" binding:"required,min=1,dive"`
+}
+
+// RollCallResult reports what happened to one entry: created, updated,
+// unchanged or error, or skipped when another entry was invalid.
+type RollCallResult struct {
+	StudentID    uint   `json:"student_id"`
+	Name         string `json:"name,omitempty"`
+	Result       string `json:"result"`
+	AttendanceID uint   `json:"attendance_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RosterEntry is an active student of the class with the record for the
+// date and period. Status is empty when nothing has been recorded, unless
+// an approved leave request covers the date.
+type RosterEntry struct {
+	StudentID      uint       `json:"student_id"`
+	StudentNumber  string     `json:"student_number"`
+	Name           string     `json:"name"`
+	AttendanceID   uint       `json:"attendance_id,omitempty"`
+	Status         string     `json:"status"`
+	Notes          string     `json:"notes"`
+	CheckInTime    *time.Time `json:"check_in_time"`
+	LateMinutes    int        `json:"late_minutes"`
+	LeaveRequestID uint       `json:"leave_request_id,omitempty"`
+}
+
+// checkRollCall validates the class, date and period of a roster or roll
+// call and returns the date with the reason it is not a school day, if any.
+// It answers with 400 or 403 and returns false when they are unusable.
+func checkRollCall(c *gin.Context, class, date string, period int, subject string) (time.Time, string, bool) {
+	if class == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class is required"})
+		return time.Time{}, "", false
+	}
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return time.Time{}, "", false
+	}
+	if day.After(dateOnly(time.Now())) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot take a roll call for a future date"})
+		return time.Time{}, "", false
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	if !scope.AllowsSubject(class, subject) {
+		denyClass(c)
+		return time.Time{}, "", false
+	}
+
+	if period > 0 {
+		if _, err := checkInPeriod(period, "", day); err != nil {
+			periodError(c, err)
+			return time.Time{}, "", false
+		}
+	}
+
+	cal, err := loadSchoolCalendar(day, day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load academic calendar"})
+		return time.Time{}, "", false
+	}
+	return day, cal.NonSchoolDayReason(day), true
+}
+
+// rollCallRecords returns the records of the students on day for the
+// period, by student.
+func rollCallRecords(db *gorm.DB, studentIDs []uint, day time.Time, period int) (map[uint]*models.Attendance, error) {
+	var records []models.Attendance
+	if err := db.Where("student_id IN ? AND date = ? AND period = ?", studentIDs, day, period).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	byStudent := make(map[uint]*models.Attendance, len(records))
+	for i := range records {
+		byStudent[records[i].StudentID] = &records[i]
+	}
+	return byStudent, nil
+}
+
+// rollCallChanges reports whether applying the entry would change record.
+func rollCallChanges(record *models.Attendance, entry RollCallEntry, subject string) bool {
+	return entry.Status != record.Status ||
+		(entry.Notes != "" && entry.Notes != record.Notes) ||
+		(subject != "" && !strings.EqualFold(subject, record.Subject))
+}
+
+// GetRollCallRoster lists the class for a roll call
+// (?class=&date=&period=&subject=), pre-filled with the current statuses.
+func GetRollCallRoster(c *gin.Context) {
+	class := c.Query("class")
+	period, _ := strconv.Atoi(c.Query("period"))
+	subject := c.Query("subject")
+
+	day, reason, ok := checkRollCall(c, class, c.Query("date"), period, subject)
+	if !ok {
+		return
+	}
+
+	var students []models.Student
+	if err := database.DB.Where("class = ? AND is_active = ?", class, true).Order("name").Find(&students).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
+		return
+	}
+
+	ids := make([]uint, 0, len(students))
+	for _, s := range students {
+		ids = append(ids, s.ID)
+	}
+
+	records, err := rollCallRecords(database.DB, ids, day, period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance records"})
+		return
+	}
+
+	var leaves []models.LeaveRequest
+	if err := database.DB.Where("student_id IN ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		ids, models.LeaveApproved, day, day).Find(&leaves).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
+		return
+	}
+	leaveByStudent := map[uint]uint{}
+	for _, l := range leaves {
+		leaveByStudent[l.StudentID] = l.ID
+	}
+
+	roster := make([]RosterEntry, 0, len(students))
+	for _, s := range students {
+		entry := RosterEntry{
+			StudentID:      s.ID,
+			StudentNumber:  s.StudentID,
+			Name:           s.Name,
+			LeaveRequestID: leaveByStudent[s.ID],
+		}
+		if record, ok := records[s.ID]; ok {
+			entry.AttendanceID = record.ID
+			entry.Status = record.Status
+			entry.Notes = record.Notes
+			entry.CheckInTime = record.CheckInTime
+			entry.LateMinutes = record.LateMinutes
+		} else if entry.LeaveRequestID != 0 {
+			entry.Status = models.StatusExcused
+		}
+		roster = append(roster, entry)
+	}
+
+	locks, err := classLocks(database.DB, class, day, day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response := gin.H{
+		"class":    class,
+		"date":     day.Format("2006-01-02"),
+		"period":   period,
+		"subject":  subject,
+		"locked":   len(locks) > 0,
+		"students": roster,
+	}
+	if reason != "" {
+		response["non_school_day"] = reason
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// errRollCallInvalid rolls back a roll call with invalid entries.
+var errRollCallInvalid = errors.New("roll call has invalid entries")
+
+// SubmitRollCall records the statuses of a class for a date and period in
+// one transaction. Entries are validated first; if any is invalid nothing
+// is saved and the per-row results say why. Changing an existing record
+// requires attendance:update, creating one only attendance:create.
+func SubmitRollCall(c *gin.Context) {
+	var req RollCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	day, reason, ok := checkRollCall(c, req.Class, req.Date, req.Period, req.Subject)
+	if !ok {
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not a school day: " + reason})
+		return
+	}
+
+	locks, err := classLocks(database.DB, req.Class, day, day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(locks) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attendance of this class is locked for the date; request corrections instead"})
+		return
+	}
+
+	granted, _ := c.Get("permissions")
+	held, _ := granted.([]string)
+	canUpdate := models.HasPermission(held, models.PermAttendanceUpdate)
+
+	var students []models.Student
+	if err := database.DB.Where("class = ? AND is_active = ?", req.Class, true).Find(&students).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
+		return
+	}
+	byID := make(map[uint]*models.Student, len(students))
+	ids := make([]uint, 0, len(students))
+	for i := range students {
+		byID[students[i].ID] = &students[i]
+		ids = append(ids, students[i].ID)
+	}
+
+	if req.Reason == "" {
+		req.Reason = "Roll call"
+	}
+	results := make([]RollCallResult, len(req.Entries))
+	var absent []*models.Student
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// The records are read inside the transaction, which holds the write
+		// lock, so a check-in arriving meanwhile cannot collide with the
+		// inserts below
+		records, err := rollCallRecords(tx, ids, day, req.Period)
+		if err != nil {
+			return err
+		}
+
+		seen := map[uint]bool{}
+		invalid := false
+		for i, entry := range req.Entries {
+			result := RollCallResult{StudentID: entry.StudentID}
+			student, ok := byID[entry.StudentID]
+			if ok {
+				result.Name = student.Name
+			}
+			record := records[entry.StudentID]
+
+			switch {
+			case !ok:
+				result.Error = "Student is not an active member of class " + req.Class
+			case seen[entry.StudentID]:
+				result.Error = "Student is listed more than once"
+			case !models.IsValidStatus(entry.Status):
+				result.Error = "Invalid status. Use present, absent, late or excused"
+			case record != nil && !canUpdate && rollCallChanges(record, entry, req.Subject):
+				result.Error = "Changing an existing record requires the attendance:update permission"
+			}
+			if result.Error != "" {
+				result.Result = "error"
+				invalid = true
+			}
+			seen[entry.StudentID] = true
+			results[i] = result
+		}
+		if invalid {
+			return errRollCallInvalid
+		}
+
+		db := models.WithEditor(tx, c.GetUint("user_id"), c.GetString("user_type"), req.Reason).
+			Session(&gorm.Session{})
+
+		for i, entry := range req.Entries {
+			record := records[entry.StudentID]
+			wasAbsent := record != nil && record.Status == models.StatusAbsent
+			if record == nil {
+				attendance := models.Attendance{
+					StudentID: entry.StudentID,
+					Date:      day,
+					Status:    entry.Status,
+					Notes:     entry.Notes,
+					Subject:   req.Subject,
+					Period:    req.Period,
+				}
+				if err := db.Create(&attendance).Error; err != nil {
+					return err
+				}
+				recordAuditTx(tx, c, AuditCreate, "attendance", attendance.ID, nil, attendance)
+				results[i].Result = "created"
+				results[i].AttendanceID = attendance.ID
+			} else if !rollCallChanges(record, entry, req.Subject) {
+				results[i].Result = "unchanged"
+				results[i].AttendanceID = record.ID
+			} else {
+				before := *record
+				record.Status = entry.Status
+				if entry.Status != models.StatusLate {
+					record.LateMinutes = 0
+				}
+				if entry.Notes != "" {
+					record.Notes = entry.Notes
+				}
+				if req.Subject != "" {
+					record.Subject = req.Subject
+				}
+				if err := db.Save(record).Error; err != nil {
+					return err
+				}
+				recordAuditTx(tx, c, AuditUpdate, "attendance", record.ID, before, record)
+				results[i].Result = "updated"
+				results[i].AttendanceID = record.ID
+			}
+
+			if entry.Status == models.StatusAbsent && !wasAbsent {
+				absent = append(absent, byID[entry.StudentID])
+			}
+		}
+		return nil
+	})
+	if err == errRollCallInvalid {
+		for i := range results {
+			if results[i].Result == "" {
+				results[i].Result = "skipped"
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Roll call has invalid entries, nothing was saved",
+			"results": results,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save roll call"})
+		return
+	}
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Result]++
+	}
+
+	when := day.Format("02/01/2006")
+	if req.Period > 0 {
+		when += fmt.Sprintf(" jam ke-%d", req.Period)
+	}
+	for _, s := range absent {
+		SendParentNotification(int(s.ID), s.Name, "tidak hadir pada "+when)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"class":     req.Class,
+		"date":      day.Format("2006-01-02"),
+		"period":    req.Period,
+		"created":   counts["created"],
+		"updated":   counts["updated"],
+		"unchanged": counts["unchanged"],
+		"results":   results,
+	})
+}
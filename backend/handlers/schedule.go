@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BellScheduleRequest struct {
+	Weekday      *int   `json:"weekday" binding:"omitempty,min=0,max=6"`
+	Grade        string `json:"grade"`
+	StartTime    string `json:"start_time" binding:"required"`
+	GraceMinutes int    `json:"grace_minutes" binding:"min=0,max=240"`
+}
+
+// resolveBellSchedule returns the most specific schedule for the grade on
+// the given day, or nil when none is configured.
+func resolveBellSchedule(grade string, day time.Time) (*models.BellSchedule, error) {
+	var schedules []models.BellSchedule
+	if err := database.DB.Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.BellSchedule
+	for i := range schedules {
+		s := &schedules[i]
+		if !s.Matches(grade, day.Weekday()) {
+			continue
+		}
+		if best == nil || s.Specificity() > best.Specificity() {
+			best = s
+		}
+	}
+	return best, nil
+}
+
+// arrivalStatus compares an arrival with the bell schedule. Arrivals after
+// the grace period are late by the minutes since the bell; without a
+// schedule every arrival counts as present.
+func arrivalStatus(grade string, at time.Time) (string, int) {
+	schedule, err := resolveBellSchedule(grade, at)
+	if err != nil {
+		log.Printf("Error resolving bell schedule: %v", err)
+		return models.StatusPresent, 0
+	}
+	if schedule == nil {
+		return models.StatusPresent, 0
+	}
+
+	start, err := schedule.StartOn(at)
+	if err != nil {
+		log.Printf("Invalid bell schedule %d start time %q", schedule.ID, schedule.StartTime)
+		return models.StatusPresent, 0
+	}
+
+	return lateness(start, schedule.GraceMinutes, at)
+}
+
+// lateness marks an arrival late once the grace period after start has
+// passed, counting the minutes from start.
+func lateness(start time.Time, graceMinutes int, at time.Time) (string, int) {
+	if !at.After(start.Add(time.Duration(graceMinutes) * time.Minute)) {
+		return models.StatusPresent, 0
+	}
+	return models.StatusLate, int(at.Sub(start).Minutes())
+}
+
+// arrivalLabel is the status wording used in notifications.
+func arrivalLabel(status string) string {
+	if status == models.StatusLate {
+		return "terlambat"
+	}
+	return "hadir"
+}
+
+// validateBellSchedule answers with 400 or 409 and returns false when the
+// request is malformed or duplicates another schedule.
+func validateBellSchedule(c *gin.Context, req BellScheduleRequest, excludeID uint) bool {
+	if _, err := time.Parse("15:04", req.StartTime); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format. Use HH:MM"})
+		return false
+	}
+
+	query := database.DB.Model(&models.BellSchedule{}).Where("grade = ? AND id != ?", req.Grade, excludeID)
+	if req.Weekday == nil {
+		query = query.Where("weekday IS NULL")
+	} else {
+		query = query.Where("weekday = ?", *req.Weekday)
+	}
+
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A schedule for this weekday and grade already exists"})
+		return false
+	}
+	return true
+}
+
+func findBellSchedule(c *gin.Context) (*models.BellSchedule, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return nil, false
+	}
+
+	var schedule models.BellSchedule
+	if err := database.DB.First(&schedule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	return &schedule, true
+}
+
+func GetBellSchedules(c *gin.Context) {
+	var schedules []models.BellSchedule
+	if err := database.DB.Order("grade, weekday").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bell schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetEffectiveBellSchedule shows which schedule applies to a grade on a
+// date (?grade=&date=YYYY-MM-DD, default today).
+func GetEffectiveBellSchedule(c *gin.Context) {
+	day := time.Now()
+	if date := c.Query("date"); date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		day = parsed
+	}
+
+	schedule, err := resolveBellSchedule(c.Query("grade"), day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve bell schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No bell schedule configured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":     day.Format("2006-01-02"),
+		"schedule": schedule,
+	})
+}
+
+func CreateBellSchedule(c *gin.Context) {
+	var req BellScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateBellSchedule(c, req, 0) {
+		return
+	}
+
+	schedule := models.BellSchedule{
+		Weekday:      req.Weekday,
+		Grade:        req.Grade,
+		StartTime:    req.StartTime,
+		GraceMinutes: req.GraceMinutes,
+	}
+
+	if err := database.DB.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bell schedule"})
+		return
+	}
+
+	recordAudit(c, AuditCreate, "bell_schedule", schedule.ID, nil, schedule)
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func UpdateBellSchedule(c *gin.Context) {
+	schedule, ok := findBellSchedule(c)
+	if !ok {
+		return
+	}
+
+	before := *schedule
+
+	var req BellScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateBellSchedule(c, req, schedule.ID) {
+		return
+	}
+
+	schedule.Weekday = req.Weekday
+	schedule.Grade = req.Grade
+	schedule.StartTime = req.StartTime
+	schedule.GraceMinutes = req.GraceMinutes
+
+	if err := database.DB.Save(schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bell schedule"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "bell_schedule", schedule.ID, before, schedule)
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func DeleteBellSchedule(c *gin.Context) {
+	schedule, ok := findBellSchedule(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bell schedule"})
+		return
+	}
+
+	recordAudit(c, AuditDelete, "bell_schedule", schedule.ID, schedule, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bell schedule deleted successfully"})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func activeSessions(userID uint, userType string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.
+		Where("user_id = ? AND user_type = ? AND revoked_at IS NULL AND expires_at > ?", userID, userType, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// revokeSessions ends the sessions together with their refresh tokens and
+// the access tokens still in use.
+func revokeSessions(tx *gorm.DB, sessions []models.Session, reason string) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+
+	if err := tx.Model(&models.Session{}).Where("id IN ? AND revoked_at IS NULL", ids).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error; err != nil {
+		return err
+	}
+
+	var tokens []models.RefreshToken
+	if err := tx.Where("session_id IN ? AND expires_at > ?", ids, time.Now()).Find(&tokens).Error; err != nil {
+		return err
+	}
+	return revokeRefreshTokens(tx, tokens, reason)
+}
+
+// GetMySessions lists the caller's active sessions, marking the one the
+// request was made from.
+func GetMySessions(c *gin.Context) {
+	sessions, err := activeSessions(c.GetUint("user_id"), c.GetString("user_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	current := c.GetUint("session_id")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func RevokeMySession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND user_type = ?", id, c.GetUint("user_id"), c.GetString("user_type")).
+		First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if !session.IsActive() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session already ended"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeSessions(tx, []models.Session{session}, "user_revoke")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions signs the caller out everywhere except the current
+// device.
+func RevokeOtherSessions(c *gin.Context) {
+	sessions, err := activeSessions(c.GetUint("user_id"), c.GetString("user_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	current := c.GetUint("session_id")
+	others := make([]models.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.ID != current {
+			others = append(others, session)
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeSessions(tx, others, "user_revoke")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions revoked successfully",
+		"revoked": len(others),
+	})
+}
+
+// GetUserSessions lets an admin see where a student, admin or parent is
+// signed in.
+func GetUserSessions(c *gin.Context) {
+	userType := c.Param("user_type")
+	if userType != "student" && userType != "admin" && userType != "parent" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user type"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	sessions, err := activeSessions(uint(id), userType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// SigningKeyReloadInterval is how often each server reloads the keyset,
+	// so keys rotated from the CLI or another instance are picked up.
+	SigningKeyReloadInterval = time.Minute
+
+	// DefaultSigningKeyGrace is how long retired keys keep verifying tokens.
+	DefaultSigningKeyGrace = time.Hour
+)
+
+// DefaultSigningAlgorithm is read from JWT_ALGORITHM: HS256 (default), RS256
+// or EdDSA.
+func DefaultSigningAlgorithm() string {
+	if alg := os.Getenv("JWT_ALGORITHM"); alg != "" {
+		return alg
+	}
+	return middleware.AlgHS256
+}
+
+func generateKeyID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return time.Now().Format("20060102") + "-" + hex.EncodeToString(bytes), nil
+}
+
+// LoadSigningKeys installs the stored keys into the middleware, creating the
+// first key on a fresh database.
+func LoadSigningKeys() error {
+	var stored []models.SigningKey
+	if err := database.DB.Where("verify_until IS NULL OR verify_until > ?", time.Now()).
+		Find(&stored).Error; err != nil {
+		return err
+	}
+
+	if len(stored) == 0 {
+		key, err := RotateSigningKey(DefaultSigningAlgorithm(), 0)
+		if err != nil {
+			return err
+		}
+		log.Printf("Created initial %s JWT signing key %s", key.Algorithm, key.KID)
+		stored = append(stored, *key)
+	}
+
+	keys := make([]middleware.SigningKey, 0, len(stored))
+	for _, s := range stored {
+		key, err := middleware.NewSigningKey(s.KID, s.Algorithm, s.PrivateKey, s.ActiveFrom, s.VerifyUntil)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", s.KID, err)
+		}
+		keys = append(keys, key)
+	}
+
+	middleware.SetSigningKeys(keys)
+	return nil
+}
+
+// WatchSigningKeys reloads the keyset periodically in the background.
+func WatchSigningKeys() {
+	go func() {
+		ticker := time.NewTicker(SigningKeyReloadInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := LoadSigningKeys(); err != nil {
+				log.Printf("Error reloading signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+// RotateSigningKey creates a new key for alg and retires the current ones.
+// The new key is published two reload intervals before it starts signing so
+// every instance can verify its tokens; retired keys keep verifying for
+// grace after that. Keys past their grace period are deleted.
+func RotateSigningKey(alg string, grace time.Duration) (*models.SigningKey, error) {
+	material, err := middleware.GenerateKeyMaterial(alg)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := generateKeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens signed just before the rotation must outlive the grace period
+	if grace < middleware.AccessTokenTTL {
+		grace = middleware.AccessTokenTTL
+	}
+
+	now := time.Now()
+	key := models.SigningKey{
+		KID:        kid,
+		Algorithm:  alg,
+		PrivateKey: material,
+		ActiveFrom: now,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var current int64
+		tx.Model(&models.SigningKey{}).Where("verify_until IS NULL").Count(&current)
+		if current > 0 {
+			key.ActiveFrom = now.Add(2 * SigningKeyReloadInterval)
+			if err := tx.Model(&models.SigningKey{}).Where("verify_until IS NULL").
+				Update("verify_until", key.ActiveFrom.Add(grace)).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("verify_until < ?", now).Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetJWKS publishes the public signing keys so other services can verify
+// access tokens without sharing a secret.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(SigningKeyReloadInterval.Seconds())))
+	c.JSON(http.StatusOK, gin.H{"keys": middleware.PublicJWKS()})
+}
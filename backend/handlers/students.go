@@ -20,7 +20,12 @@ func GetAllStudents(c *gin.Context) {
 	
 	offset := (page - 1) * limit
 
-	query := database.DB.Model(&models.Student{})
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	query := scope.ScopeStudents(database.DB.Model(&models.Student{}), "class")
 	
 	if class != "" {
 		query = query.Where("class = ?", class)
@@ -59,8 +64,13 @@ func GetStudent(c *gin.Context) {
 		return
 	}
 
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
 	var student models.Student
-	if err := database.DB.Preload("Attendances").First(&student, studentID).Error; err != nil {
+	if err := database.DB.First(&student, studentID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
 			return
@@ -68,6 +78,21 @@ func GetStudent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	if !scope.AllowsClass(student.Class) {
+		denyClass(c)
+		return
+	}
+
+	scope.ScopeStudentAttendance(database.DB.Where("student_id = ?", student.ID), student.Class).
+		Order("date DESC").
+		Find(&student.Attendances)
+
+	// Load linked guardians
+	database.DB.
+		Joins("JOIN student_parents sp ON sp.parent_id = parents.id").
+		Where("sp.student_id = ?", student.StudentID).
+		Order("parents.name").
+		Find(&student.Guardians)
 
 	c.JSON(http.StatusOK, student)
 }
@@ -78,6 +103,18 @@ func CreateStudent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkPasswordLength(c, req.Password) {
+		return
+	}
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.AllowsClass(req.Class) {
+		denyClass(c)
+		return
+	}
 
 	// Check if student ID or email already exists
 	var existingStudent models.Student
@@ -110,6 +147,8 @@ func CreateStudent(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, AuditCreate, "student", student.ID, nil, student)
+
 	c.JSON(http.StatusCreated, student)
 }
 
@@ -131,6 +170,17 @@ func UpdateStudent(c *gin.Context) {
 		return
 	}
 
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.AllowsClass(student.Class) {
+		denyClass(c)
+		return
+	}
+
+	before := student
+
 	type UpdateStudentRequest struct {
 		Name        string `json:"name"`
 		Email       string `json:"email"`
@@ -163,6 +213,11 @@ func UpdateStudent(c *gin.Context) {
 		student.Name = req.Name
 	}
 	if req.Class != "" {
+		// Teachers cannot move students out of their classes
+		if !scope.AllowsClass(req.Class) {
+			denyClass(c)
+			return
+		}
 		student.Class = req.Class
 	}
 	if req.Grade != "" {
@@ -191,6 +246,8 @@ func UpdateStudent(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, AuditUpdate, "student", student.ID, before, student)
+
 	c.JSON(http.StatusOK, student)
 }
 
@@ -212,17 +269,37 @@ func DeleteStudent(c *gin.Context) {
 		return
 	}
 
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.AllowsClass(student.Class) {
+		denyClass(c)
+		return
+	}
+
 	// Soft delete
 	if err := database.DB.Delete(&student).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete student"})
 		return
 	}
 
+	recordAudit(c, AuditDelete, "student", student.ID, student, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Student deleted successfully"})
 }
 
 func GetStudentsByClass(c *gin.Context) {
 	class := c.Param("class")
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.AllowsClass(class) {
+		denyClass(c)
+		return
+	}
 	
 	var students []models.Student
 	if err := database.DB.Where("class = ? AND is_active = ?", class, true).Order("name").Find(&students).Error; err != nil {
@@ -235,9 +312,14 @@ func GetStudentsByClass(c *gin.Context) {
 
 func GetStudentsByGrade(c *gin.Context) {
 	grade := c.Param("grade")
+
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
 	
 	var students []models.Student
-	if err := database.DB.Where("grade = ? AND is_active = ?", grade, true).Order("class, name").Find(&students).Error; err != nil {
+	if err := scope.ScopeStudents(database.DB, "class").Where("grade = ? AND is_active = ?", grade, true).Order("class, name").Find(&students).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
 		return
 	}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TeachingAssignmentRequest struct {
+	Class   string `json:"class" binding:"required"`
+	Subject string `json:"subject"`
+}
+
+type SetTeachingAssignmentsRequest struct {
+	Assignments []TeachingAssignmentRequest `json:"assignments"`
+}
+
+// classScope is the part of the school an admin may see. Admins holding
+// classes:all are unrestricted; everyone else is limited to the classes,
+// and for subject teachers the subjects, they are assigned to.
+type classScope struct {
+	All         bool
+	Assignments []models.TeachingAssignment
+}
+
+// callerScope answers with 500 and returns false if the scope cannot be
+// loaded.
+func callerScope(c *gin.Context) (*classScope, bool) {
+	scope, err := loadClassScope(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve class access"})
+		return nil, false
+	}
+	return scope, true
+}
+
+func loadClassScope(c *gin.Context) (*classScope, error) {
+	userType := c.GetString("user_type")
+	userID := c.GetUint("user_id")
+
+	granted, ok := c.Get("permissions")
+	if !ok {
+		resolved, err := ResolvePermissions(userID, userType)
+		if err != nil {
+			return nil, err
+		}
+		granted = resolved
+	}
+	held, _ := granted.([]string)
+
+	if models.HasPermission(held, models.PermClassesAll) {
+		return &classScope{All: true}, nil
+	}
+
+	scope := &classScope{}
+	// API keys have no assignments; their IDs are not admin IDs
+	if userType != "admin" {
+		return scope, nil
+	}
+
+	err := database.DB.Where("admin_id = ?", userID).Order("class, subject").Find(&scope.Assignments).Error
+	return scope, err
+}
+
+// Classes returns the assigned classes without duplicates.
+func (s *classScope) Classes() []string {
+	seen := map[string]bool{}
+	classes := []string{}
+	for _, a := range s.Assignments {
+		if !seen[a.Class] {
+			seen[a.Class] = true
+			classes = append(classes, a.Class)
+		}
+	}
+	return classes
+}
+
+// AllowsClass reports whether students of the class are visible.
+func (s *classScope) AllowsClass(class string) bool {
+	if s.All {
+		return true
+	}
+	for _, a := range s.Assignments {
+		if a.Class == class {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSubject reports whether attendance for the subject in the class is
+// visible. Homeroom assignments cover every subject, including daily
+// check-ins that have none.
+func (s *classScope) AllowsSubject(class, subject string) bool {
+	if s.All {
+		return true
+	}
+	for _, a := range s.Assignments {
+		if a.Class == class && (a.Subject == "" || strings.EqualFold(a.Subject, subject)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHomeroom reports whether the scope holds the class's homeroom
+// assignment. Unrestricted scopes count as homeroom for every class.
+func (s *classScope) IsHomeroom(class string) bool {
+	if s.All {
+		return true
+	}
+	for _, a := range s.Assignments {
+		if a.Class == class && a.Subject == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// denyClass answers with 403 for records outside the caller's classes.
+func denyClass(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this class"})
+}
+
+// allowAttendance answers with 403 unless the scope covers the subject in
+// the student's class.
+func allowAttendance(c *gin.Context, scope *classScope, studentID uint, subject string) bool {
+	if scope.All {
+		return true
+	}
+
+	var student models.Student
+	if err := database.DB.Unscoped().Select("id", "class").First(&student, studentID).Error; err != nil ||
+		!scope.AllowsSubject(student.Class, subject) {
+		denyClass(c)
+		return false
+	}
+	return true
+}
+
+// StudentCondition returns a SQL condition limiting classColumn to the
+// scope. It is empty when the scope is unrestricted.
+func (s *classScope) StudentCondition(classColumn string) (string, []interface{}) {
+	if s.All {
+		return "", nil
+	}
+	if len(s.Assignments) == 0 {
+		return "1 = 0", nil
+	}
+	return classColumn + " IN ?", []interface{}{s.Classes()}
+}
+
+// AttendanceCondition is StudentCondition narrowed to the subjects taught
+// in each class.
+func (s *classScope) AttendanceCondition(classColumn, subjectColumn string) (string, []interface{}) {
+	if s.All {
+		return "", nil
+	}
+	if len(s.Assignments) == 0 {
+		return "1 = 0", nil
+	}
+
+	var conditions []string
+	var args []interface{}
+	for _, a := range s.Assignments {
+		if a.Subject == "" {
+			conditions = append(conditions, classColumn+" = ?")
+			args = append(args, a.Class)
+		} else {
+			conditions = append(conditions, "("+classColumn+" = ? AND LOWER("+subjectColumn+") = LOWER(?))")
+			args = append(args, a.Class, a.Subject)
+		}
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// ScopeStudents limits a query that has the students table joined.
+func (s *classScope) ScopeStudents(query *gorm.DB, classColumn string) *gorm.DB {
+	if condition, args := s.StudentCondition(classColumn); condition != "" {
+		return query.Where(condition, args...)
+	}
+	return query
+}
+
+// ScopeAttendance limits a query over attendances joined with students.
+func (s *classScope) ScopeAttendance(query *gorm.DB, classColumn, subjectColumn string) *gorm.DB {
+	if condition, args := s.AttendanceCondition(classColumn, subjectColumn); condition != "" {
+		return query.Where(condition, args...)
+	}
+	return query
+}
+
+// ScopeStudentAttendance limits one student's attendances to the subjects
+// the scope covers in the student's class.
+func (s *classScope) ScopeStudentAttendance(query *gorm.DB, class string) *gorm.DB {
+	if s.All {
+		return query
+	}
+
+	subjects := []string{}
+	for _, a := range s.Assignments {
+		if a.Class != class {
+			continue
+		}
+		if a.Subject == "" {
+			return query
+		}
+		subjects = append(subjects, strings.ToLower(a.Subject))
+	}
+	if len(subjects) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where("LOWER(subject) IN ?", subjects)
+}
+
+// GetMyClasses tells the frontend which classes the caller can work with.
+func GetMyClasses(c *gin.Context) {
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
+	assignments := scope.Assignments
+	if assignments == nil {
+		assignments = []models.TeachingAssignment{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"all_classes": scope.All,
+		"classes":     scope.Classes(),
+		"assignments": assignments,
+	})
+}
+
+func GetTeachingAssignments(c *gin.Context) {
+	admin, ok := findAdmin(c)
+	if !ok {
+		return
+	}
+
+	var assignments []models.TeachingAssignment
+	if err := database.DB.Where("admin_id = ?", admin.ID).Order("class, subject").Find(&assignments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teaching assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"admin":       admin,
+		"assignments": assignments,
+	})
+}
+
+// SetTeachingAssignments replaces the classes and subjects an admin teaches.
+func SetTeachingAssignments(c *gin.Context) {
+	admin, ok := findAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req SetTeachingAssignmentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkRoleGrantable(c, admin.Role) {
+		return
+	}
+
+	var before []models.TeachingAssignment
+	database.DB.Where("admin_id = ?", admin.ID).Order("class, subject").Find(&before)
+
+	seen := map[string]bool{}
+	assignments := []models.TeachingAssignment{}
+	for _, a := range req.Assignments {
+		class := strings.TrimSpace(a.Class)
+		subject := strings.TrimSpace(a.Subject)
+		if class == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Class is required"})
+			return
+		}
+
+		key := class + "\x00" + strings.ToLower(subject)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		assignments = append(assignments, models.TeachingAssignment{AdminID: admin.ID, Class: class, Subject: subject})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("admin_id = ?", admin.ID).Delete(&models.TeachingAssignment{}).Error; err != nil {
+			return err
+		}
+		if len(assignments) == 0 {
+			return nil
+		}
+		return tx.Create(&assignments).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update teaching assignments"})
+		return
+	}
+
+	recordAudit(c, AuditUpdate, "teaching_assignments", admin.ID,
+		gin.H{"assignments": assignmentList(before)}, gin.H{"assignments": assignmentList(assignments)})
+
+	c.JSON(http.StatusOK, gin.H{
+		"admin":       admin,
+		"assignments": assignments,
+	})
+}
+
+// assignmentList flattens assignments into "class/subject" pairs so changes
+// show up in the audit diff.
+func assignmentList(assignments []models.TeachingAssignment) string {
+	pairs := make([]string, 0, len(assignments))
+	for _, a := range assignments {
+		pairs = append(pairs, a.Class+"/"+a.Subject)
+	}
+	return strings.Join(pairs, ",")
+}
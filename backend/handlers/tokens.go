@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/middleware"
+	"school-attendance/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RefreshTokenTTL is how long a refresh token may be exchanged before the
+// user has to log in again.
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+// errRefreshTokenReused is returned when a refresh token was already
+// rotated, possibly by a concurrent refresh with the same token.
+var errRefreshTokenReused = errors.New("refresh token already used")
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateSecureToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// issueTokens starts a new login session for the user and returns the
+// response sent back by every login endpoint.
+func issueTokens(c *gin.Context, userID uint, userType string, user interface{}) (*AuthResponse, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		UserType:   userType,
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	response, _, err := issueSessionTokens(database.DB, c, &session, user)
+	return response, err
+}
+
+// issueSessionTokens creates an access token and a matching refresh token
+// within an existing session and extends the session accordingly. It also
+// returns the id of the new refresh token.
+func issueSessionTokens(db *gorm.DB, c *gin.Context, session *models.Session, user interface{}) (*AuthResponse, uint, error) {
+	accessToken, jti, err := middleware.GenerateToken(session.UserID, session.UserType, session.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	refreshToken, err := generateSecureToken()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	record := models.RefreshToken{
+		UserID:    session.UserID,
+		UserType:  session.UserType,
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		AccessJTI: jti,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := db.Model(session).Updates(map[string]interface{}{
+		"ip_address":   c.ClientIP(),
+		"last_seen_at": now,
+		"expires_at":   record.ExpiresAt,
+	}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return &AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(middleware.AccessTokenTTL.Seconds()),
+		User:         user,
+	}, record.ID, nil
+}
+
+// IsTokenRevoked is installed into the auth middleware to reject access
+// tokens that were revoked before they expired.
+func IsTokenRevoked(jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	var count int64
+	database.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	return count > 0
+}
+
+func revokeAccessToken(tx *gorm.DB, jti string, userID uint, userType string, reason string) error {
+	if jti == "" {
+		return nil
+	}
+
+	var count int64
+	tx.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	return tx.Create(&models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		UserType:  userType,
+		Reason:    reason,
+		ExpiresAt: time.Now().Add(middleware.AccessTokenTTL),
+	}).Error
+}
+
+// revokeAllUserTokens ends every session of the user, revoking each
+// outstanding refresh token together with the access token issued alongside.
+func revokeAllUserTokens(tx *gorm.DB, userID uint, userType string, reason string) error {
+	now := time.Now()
+	if err := tx.Model(&models.Session{}).
+		Where("user_id = ? AND user_type = ? AND revoked_at IS NULL", userID, userType).
+		Updates(map[string]interface{}{"revoked_at": now, "revoked_reason": reason}).Error; err != nil {
+		return err
+	}
+
+	var tokens []models.RefreshToken
+	if err := tx.Where("user_id = ? AND user_type = ? AND expires_at > ?", userID, userType, now).
+		Find(&tokens).Error; err != nil {
+		return err
+	}
+
+	return revokeRefreshTokens(tx, tokens, reason)
+}
+
+// revokeRefreshTokens revokes the given refresh tokens and the access token
+// issued with each of them.
+func revokeRefreshTokens(tx *gorm.DB, tokens []models.RefreshToken, reason string) error {
+	now := time.Now()
+	for _, token := range tokens {
+		if err := revokeAccessToken(tx, token.AccessJTI, token.UserID, token.UserType, reason); err != nil {
+			return err
+		}
+		if token.RevokedAt == nil {
+			if err := tx.Model(&token).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func RefreshAccessToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", hashToken(req.RefreshToken)).First(&stored).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// A rotated token being presented again means it was stolen; kill the
+	// whole family so neither party keeps access.
+	if stored.RevokedAt != nil {
+		if stored.ReplacedBy != nil {
+			database.DB.Transaction(func(tx *gorm.DB) error {
+				return revokeAllUserTokens(tx, stored.UserID, stored.UserType, "reuse_detected")
+			})
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+
+	if !stored.IsActive() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired"})
+		return
+	}
+
+	var user interface{}
+	switch stored.UserType {
+	case "student":
+		var student models.Student
+		if err := database.DB.Where("id = ? AND is_active = ?", stored.UserID, true).First(&student).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is no longer active"})
+			return
+		}
+		user = student
+	case "admin":
+		var admin models.Admin
+		if err := database.DB.Where("id = ? AND is_active = ?", stored.UserID, true).First(&admin).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is no longer active"})
+			return
+		}
+		user = admin
+	case "parent":
+		var parent models.Parent
+		if err := database.DB.Where("id = ? AND is_active = ?", stored.UserID, true).First(&parent).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is no longer active"})
+			return
+		}
+		user = parent
+	default:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	// Tokens issued before sessions existed get one on their first refresh
+	var session models.Session
+	if stored.SessionID == 0 || database.DB.First(&session, stored.SessionID).Error != nil {
+		session = models.Session{
+			UserID:     stored.UserID,
+			UserType:   stored.UserType,
+			UserAgent:  stored.UserAgent,
+			LastSeenAt: time.Now(),
+		}
+		if err := database.DB.Create(&session).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+	}
+	if session.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	var response *AuthResponse
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Revoke the old token before issuing its replacement so that only
+		// one of several concurrent refreshes with it can succeed
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		issued, replacementID, err := issueSessionTokens(tx, c, &session, user)
+		if err != nil {
+			return err
+		}
+		response = issued
+		return tx.Model(&models.RefreshToken{}).Where("id = ?", stored.ID).Update("replaced_by", replacementID).Error
+	})
+	if err == errRefreshTokenReused {
+		database.DB.Transaction(func(tx *gorm.DB) error {
+			return revokeAllUserTokens(tx, stored.UserID, stored.UserType, "reuse_detected")
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func Logout(c *gin.Context) {
+	var req LogoutRequest
+	// The body is optional; a bare logout only revokes the access token.
+	_ = c.ShouldBindJSON(&req)
+
+	userID := c.MustGet("user_id").(uint)
+	userType := c.MustGet("user_type").(string)
+	jti := c.GetString("token_id")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := revokeAccessToken(tx, jti, userID, userType, "logout"); err != nil {
+			return err
+		}
+		if sessionID := c.GetUint("session_id"); sessionID != 0 {
+			if err := tx.Model(&models.Session{}).
+				Where("id = ? AND user_id = ? AND user_type = ? AND revoked_at IS NULL", sessionID, userID, userType).
+				Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": "logout"}).Error; err != nil {
+				return err
+			}
+		}
+
+		query := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND user_type = ? AND revoked_at IS NULL", userID, userType)
+		if req.RefreshToken != "" {
+			query = query.Where("token_hash = ?", hashToken(req.RefreshToken))
+		} else {
+			query = query.Where("access_jti = ?", jti)
+		}
+		return query.Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// RevokeUserTokens lets an admin immediately sign a student, admin or parent
+// out of every session.
+func RevokeUserTokens(c *gin.Context) {
+	userType := c.Param("user_type")
+	if userType != "student" && userType != "admin" && userType != "parent" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user type"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeAllUserTokens(tx, uint(id), userType, "admin_revoke")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	recordAudit(c, AuditRevoke, "user_tokens", userType+":"+c.Param("id"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "All tokens revoked successfully"})
+}
+
+// PurgeExpiredTokens removes revocation, refresh token, session and
+// idempotency key rows that can no longer be used.
+func PurgeExpiredTokens() {
+	now := time.Now()
+	database.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	database.DB.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
+	database.DB.Where("expires_at < ?", now).Delete(&models.Session{})
+	database.DB.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{})
+}
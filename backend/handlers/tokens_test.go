@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"net/http"
+	"school-attendance/database"
+	"school-attendance/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	testModels = append(testModels, &models.RefreshToken{}, &models.RevokedToken{})
+}
+
+func tokenRouter() *gin.Engine {
+	r := gin.New()
+	r.POST("/login", StudentLogin)
+	r.POST("/refresh", RefreshAccessToken)
+	return r
+}
+
+func loginStudent(t *testing.T, r *gin.Engine, email, password string) AuthResponse {
+	t.Helper()
+	w := doJSON(t, r, http.MethodPost, "/login", LoginRequest{Email: email, Password: password})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+	var resp AuthResponse
+	decodeJSON(t, w, &resp)
+	return resp
+}
+
+func refresh(t *testing.T, r *gin.Engine, token string) (int, AuthResponse) {
+	t.Helper()
+	w := doJSON(t, r, http.MethodPost, "/refresh", RefreshRequest{RefreshToken: token})
+	var resp AuthResponse
+	if w.Code == http.StatusOK {
+		decodeJSON(t, w, &resp)
+	}
+	return w.Code, resp
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	setupTestDB(t)
+	createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := tokenRouter()
+
+	login := loginStudent(t, r, "s1@school.id", "Password1")
+	code, rotated := refresh(t, r, login.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: %d", code)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatal("refresh did not issue a new refresh token")
+	}
+
+	var old, replacement models.RefreshToken
+	database.DB.Where("token_hash = ?", hashToken(login.RefreshToken)).First(&old)
+	database.DB.Where("token_hash = ?", hashToken(rotated.RefreshToken)).First(&replacement)
+	if old.RevokedAt == nil {
+		t.Error("rotated token was not revoked")
+	}
+	if old.ReplacedBy == nil || *old.ReplacedBy != replacement.ID {
+		t.Errorf("replaced_by = %v, want %d", old.ReplacedBy, replacement.ID)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	setupTestDB(t)
+	createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := tokenRouter()
+
+	login := loginStudent(t, r, "s1@school.id", "Password1")
+	_, rotated := refresh(t, r, login.RefreshToken)
+
+	// The stolen original is presented again
+	if code, _ := refresh(t, r, login.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("reused token: %d, want 401", code)
+	}
+	if code, _ := refresh(t, r, rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("token issued before reuse: %d, want 401", code)
+	}
+
+	var active int64
+	database.DB.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	if active != 0 {
+		t.Errorf("%d refresh tokens still active after reuse", active)
+	}
+
+	var current models.RefreshToken
+	database.DB.Where("token_hash = ?", hashToken(rotated.RefreshToken)).First(&current)
+	if !IsTokenRevoked(current.AccessJTI) {
+		t.Error("access token issued with the rotated refresh token was not revoked")
+	}
+}
+
+func TestConcurrentRefreshSucceedsOnce(t *testing.T) {
+	setupTestDB(t)
+	createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := tokenRouter()
+	login := loginStudent(t, r, "s1@school.id", "Password1")
+
+	const attempts = 8
+	codes := make(chan int, attempts)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := doJSON(t, r, http.MethodPost, "/refresh", RefreshRequest{RefreshToken: login.RefreshToken})
+			codes <- w.Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	succeeded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of %d concurrent refreshes succeeded, want 1", succeeded, attempts)
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	setupTestDB(t)
+	student := createTestStudent(t, "S1", "s1@school.id", "Password1")
+	r := tokenRouter()
+
+	expired := models.RefreshToken{
+		UserID:    student.ID,
+		UserType:  "student",
+		TokenHash: hashToken("expired"),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	database.DB.Create(&expired)
+
+	login := loginStudent(t, r, "s1@school.id", "Password1")
+	database.DB.Model(&student).Update("is_active", false)
+
+	for name, token := range map[string]string{
+		"unknown":          "not-a-token",
+		"expired":          "expired",
+		"inactive account": login.RefreshToken,
+	} {
+		if code, _ := refresh(t, r, token); code != http.StatusUnauthorized {
+			t.Errorf("%s: %d, want 401", name, code)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"school-attendance/database"
+	"school-attendance/models"
+	"school-attendance/totp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// MFAChallengeTTL is how long an admin has to enter their code after
+	// the password step.
+	MFAChallengeTTL = 5 * time.Minute
+
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type VerifyTwoFactorRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// twoFactorRequired reports whether every admin must enroll in 2FA before
+// using the API. Enrollment is optional unless ADMIN_2FA_REQUIRED=true.
+func twoFactorRequired() bool {
+	return os.Getenv("ADMIN_2FA_REQUIRED") == "true"
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Sistem Presensi"
+}
+
+// PendingAccountAction is installed into middleware.BlockPendingActions and
+// returns the setup step the account still has to complete.
+func PendingAccountAction(userID uint, userType string) (string, error) {
+	if userType != "admin" {
+		return "", nil
+	}
+
+	var admin models.Admin
+	if err := database.DB.First(&admin, userID).Error; err != nil {
+		return "", err
+	}
+
+	if admin.MustChangePassword {
+		return "change_password", nil
+	}
+	if twoFactorRequired() && !admin.TOTPEnabled {
+		return "enroll_2fa", nil
+	}
+	return "", nil
+}
+
+// startMFAChallenge records a pending second login step and returns the
+// token the client sends back with the code.
+func startMFAChallenge(adminID uint) (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.MFAChallenge{
+		AdminID:   adminID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(MFAChallengeTTL),
+	}
+	if err := database.DB.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// verifyTOTP checks code against the given secret and rejects codes from a
+// step that was already used. The step is claimed with a conditional update
+// so two requests with the same code cannot both pass.
+func verifyTOTP(admin *models.Admin, secret, code string) bool {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || step <= admin.TOTPLastStep {
+		return false
+	}
+
+	result := database.DB.Model(&models.Admin{}).
+		Where("id = ? AND totp_last_step < ?", admin.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		log.Printf("Error recording TOTP step for admin %d: %v", admin.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected != 1 {
+		return false
+	}
+
+	admin.TOTPLastStep = step
+	return true
+}
+
+func useRecoveryCode(adminID uint, code string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("admin_id = ? AND code_hash = ? AND used_at IS NULL", adminID, hashToken(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// generateRecoveryCodes replaces the admin's recovery codes and returns the
+// new plaintext codes. They are only shown once.
+func generateRecoveryCodes(tx *gorm.DB, adminID uint) ([]string, error) {
+	if err := tx.Where("admin_id = ?", adminID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		bytes := make([]byte, 5)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(bytes)
+		code := raw[:5] + "-" + raw[5:]
+
+		if err := tx.Create(&models.RecoveryCode{AdminID: adminID, CodeHash: hashToken(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func currentAdmin(c *gin.Context) (*models.Admin, bool) {
+	if c.GetString("user_type") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admin accounts can use this endpoint"})
+		return nil, false
+	}
+
+	var admin models.Admin
+	if err := database.DB.First(&admin, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+		return nil, false
+	}
+	return &admin, true
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var remaining int64
+	database.DB.Model(&models.RecoveryCode{}).Where("admin_id = ? AND used_at IS NULL", admin.ID).Count(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  admin.TOTPEnabled,
+		"required":                 twoFactorRequired(),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor starts enrollment by generating a secret and the QR code
+// to scan with an authenticator app. 2FA is only turned on once
+// EnableTwoFactor verifies a code.
+func SetupTwoFactor(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	if admin.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := database.DB.Model(admin).Update("totp_pending_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	uri := totp.ProvisioningURI(totpIssuer(), admin.Email, secret)
+	qrCode, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": uri,
+		"qr_code":     qrCode,
+	})
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	if admin.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if admin.TOTPPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	if !verifyTOTP(admin, admin.TOTPPendingSecret, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(admin).Updates(map[string]interface{}{
+			"totp_enabled":        true,
+			"totp_secret":         admin.TOTPPendingSecret,
+			"totp_pending_secret": "",
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = generateRecoveryCodes(tx, admin.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if twoFactorRequired() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for admins"})
+		return
+	}
+
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	if !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if !verifyTOTP(admin, admin.TOTPSecret, req.Code) && !useRecoveryCode(admin.ID, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(admin).Updates(map[string]interface{}{
+			"totp_enabled":        false,
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("admin_id = ?", admin.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	if !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !verifyTOTP(admin, admin.TOTPSecret, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = generateRecoveryCodes(tx, admin.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyTwoFactorLogin completes an admin login started by AdminLogin and
+// issues the tokens once a TOTP or recovery code checks out.
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req VerifyTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code or recovery code is required"})
+		return
+	}
+
+	var challenge models.MFAChallenge
+	if err := database.DB.Where("token_hash = ?", hashToken(req.MFAToken)).First(&challenge).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+
+	var admin models.Admin
+	if err := database.DB.Where("id = ? AND is_active = ?", challenge.AdminID, true).First(&admin).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if !checkLoginThrottle(c, "admin", admin.Email) {
+		return
+	}
+
+	// Take the attempt before checking the code so that parallel requests
+	// cannot get more guesses than allowed
+	claim := database.DB.Model(&models.MFAChallenge{}).
+		Where("id = ? AND attempts < ? AND used_at IS NULL", challenge.ID, maxMFAAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if claim.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if claim.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+
+	verified := false
+	if req.Code != "" {
+		verified = verifyTOTP(&admin, admin.TOTPSecret, req.Code)
+	} else {
+		verified = useRecoveryCode(admin.ID, req.RecoveryCode)
+	}
+
+	if !verified {
+		recordLoginFailure(c, "admin", admin.Email, &admin.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	result := database.DB.Model(&challenge).Where("used_at IS NULL").Update("used_at", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	recordLoginSuccess("admin", admin.Email)
+
+	response, err := issueTokens(c, admin.ID, "admin", admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"school-attendance/database"
+	"school-attendance/models"
+	"school-attendance/totp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifyTOTPAcceptsCodeOnce(t *testing.T) {
+	setupTestDB(t)
+	admin := createTestAdmin(t, "guru", "guru@school.id", "Password1")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every request loads its own copy of the admin before checking the code
+	const attempts = 8
+	var accepted atomic.Int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		var loaded models.Admin
+		database.DB.First(&loaded, admin.ID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if verifyTOTP(&loaded, secret, code) {
+				accepted.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("code accepted %d times, want once", n)
+	}
+
+	var stored models.Admin
+	database.DB.First(&stored, admin.ID)
+	if stored.TOTPLastStep == 0 {
+		t.Error("accepted step not recorded")
+	}
+	if verifyTOTP(&stored, secret, code) {
+		t.Error("code accepted again after its step was recorded")
+	}
+}
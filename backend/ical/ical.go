@@ -0,0 +1,259 @@
+// Package ical reads the events of an RFC 5545 iCalendar file, enough to
+// import school holidays published by ministries, Google Calendar and
+// Outlook. Recurrence rules are not expanded.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is one VEVENT. End is exclusive, as in the file; for all-day events
+// it is midnight after the last day.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Recurring   bool // the event has an RRULE that was not expanded
+}
+
+// LastDay returns the last calendar day the event covers.
+func (e *Event) LastDay() time.Time {
+	last := e.End
+	if e.AllDay || (last.Hour() == 0 && last.Minute() == 0 && last.Second() == 0 && last.After(e.Start)) {
+		last = last.AddDate(0, 0, -1)
+	}
+	if last.Before(e.Start) {
+		last = e.Start
+	}
+	return time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// FirstDay returns the first calendar day the event covers.
+func (e *Event) FirstDay() time.Time {
+	return time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// property is one unfolded content line, NAME;PARAM=VALUE:value.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse returns the events in the calendar. Events that cannot be read are
+// reported in the returned errors, one per event, while the rest are kept.
+func Parse(r io.Reader) ([]Event, []error, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, nil, errors.New("not an iCalendar file")
+	}
+
+	var events []Event
+	var problems []error
+	var current []property
+	inEvent := false
+	for n, line := range lines {
+		p, err := parseLine(line)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("line %d: %v", n+1, err))
+			continue
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			inEvent = true
+			current = nil
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			inEvent = false
+			event, err := buildEvent(current)
+			if err != nil {
+				problems = append(problems, err)
+				continue
+			}
+			events = append(events, event)
+		case inEvent:
+			current = append(current, p)
+		}
+	}
+	return events, problems, nil
+}
+
+// unfold joins continuation lines, which start with a space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimPrefix(line, "\ufeff"))
+	}
+	return lines, scanner.Err()
+}
+
+func parseLine(line string) (property, error) {
+	// The value starts at the first colon outside a quoted parameter
+	colon := -1
+	quoted := false
+	for i, ch := range line {
+		if ch == '"' {
+			quoted = !quoted
+		} else if ch == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, errors.New("missing ':'")
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p := property{
+		name:   strings.ToUpper(parts[0]),
+		params: map[string]string{},
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p, nil
+}
+
+func buildEvent(props []property) (Event, error) {
+	var event Event
+	var hasEnd bool
+	var duration time.Duration
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			event.UID = p.value
+		case "SUMMARY":
+			event.Summary = unescape(p.value)
+		case "DESCRIPTION":
+			event.Description = unescape(p.value)
+		case "CATEGORIES":
+			for _, c := range strings.Split(p.value, ",") {
+				if c = strings.TrimSpace(unescape(c)); c != "" {
+					event.Categories = append(event.Categories, c)
+				}
+			}
+		case "RRULE":
+			event.Recurring = true
+		case "DTSTART":
+			t, allDay, err := parseTime(p)
+			if err != nil {
+				return event, fmt.Errorf("event %q: invalid DTSTART: %v", event.Summary, err)
+			}
+			event.Start, event.AllDay = t, allDay
+		case "DTEND":
+			t, _, err := parseTime(p)
+			if err != nil {
+				return event, fmt.Errorf("event %q: invalid DTEND: %v", event.Summary, err)
+			}
+			event.End, hasEnd = t, true
+		case "DURATION":
+			d, err := parseDuration(p.value)
+			if err != nil {
+				return event, fmt.Errorf("event %q: invalid DURATION: %v", event.Summary, err)
+			}
+			duration = d
+		}
+	}
+
+	if event.Start.IsZero() {
+		return event, fmt.Errorf("event %q: missing DTSTART", event.Summary)
+	}
+	if !hasEnd {
+		switch {
+		case duration > 0:
+			event.End = event.Start.Add(duration)
+		case event.AllDay:
+			event.End = event.Start.AddDate(0, 0, 1)
+		default:
+			event.End = event.Start
+		}
+	}
+	if event.End.Before(event.Start) {
+		return event, fmt.Errorf("event %q: ends before it starts", event.Summary)
+	}
+	return event, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value. Times with a TZID are taken as
+// local school time; UTC times are converted to it.
+func parseTime(p property) (time.Time, bool, error) {
+	value := p.value
+	if p.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t.In(time.Local), false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, time.Local)
+	return t, false, err
+}
+
+// parseDuration reads an RFC 5545 duration such as P1W, P2D or PT2H30M.
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(value, "+")
+	if !strings.HasPrefix(value, "P") {
+		return 0, errors.New("must start with P")
+	}
+
+	var d time.Duration
+	var n int
+	inTime := false
+	for _, ch := range value[1:] {
+		switch {
+		case ch >= '0' && ch <= '9':
+			n = n*10 + int(ch-'0')
+		case ch == 'T':
+			inTime = true
+		case ch == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+			n = 0
+		case ch == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+			n = 0
+		case ch == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+			n = 0
+		case ch == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+			n = 0
+		case ch == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+			n = 0
+		default:
+			return 0, fmt.Errorf("unexpected %q", ch)
+		}
+	}
+	return d, nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
@@ -0,0 +1,283 @@
+package ical
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wib is the school time zone used as time.Local in these tests.
+var wib = time.FixedZone("WIB", 7*60*60)
+
+func useLocal(t *testing.T) {
+	t.Helper()
+	previous := time.Local
+	time.Local = wib
+	t.Cleanup(func() { time.Local = previous })
+}
+
+// calendar wraps content lines in a VCALENDAR with CRLF line endings.
+func calendar(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...)
+	all = append(all, "END:VCALENDAR")
+	return strings.Join(all, "\r\n") + "\r\n"
+}
+
+func at(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, wib)
+}
+
+func TestParse(t *testing.T) {
+	useLocal(t)
+
+	tests := []struct {
+		name     string
+		ics      string
+		want     Event
+		firstDay string
+		lastDay  string
+	}{
+		{
+			name: "folded lines",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"UID:fold-1",
+				"DTSTART;VALUE=DATE:20261225",
+				"SUMMARY:Libur Hari",
+				"  Natal",
+				"DESCRIPTION:Sekolah lib",
+				"\tur",
+				"END:VEVENT",
+			),
+			want: Event{
+				UID:         "fold-1",
+				Summary:     "Libur Hari Natal",
+				Description: "Sekolah libur",
+				Start:       at(2026, 12, 25, 0, 0),
+				End:         at(2026, 12, 26, 0, 0),
+				AllDay:      true,
+			},
+			firstDay: "2026-12-25",
+			lastDay:  "2026-12-25",
+		},
+		{
+			name: "all-day without DTEND lasts one day",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART:20261017",
+				"SUMMARY:Libur",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Libur", Start: at(2026, 10, 17, 0, 0), End: at(2026, 10, 18, 0, 0), AllDay: true},
+			firstDay: "2026-10-17",
+			lastDay:  "2026-10-17",
+		},
+		{
+			name: "all-day DTEND is exclusive",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART;VALUE=DATE:20261224",
+				"DTEND;VALUE=DATE:20261227",
+				"SUMMARY:Libur Natal",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Libur Natal", Start: at(2026, 12, 24, 0, 0), End: at(2026, 12, 27, 0, 0), AllDay: true},
+			firstDay: "2026-12-24",
+			lastDay:  "2026-12-26",
+		},
+		{
+			name: "all-day DURATION",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART;VALUE=DATE:20260316",
+				"DURATION:P1W",
+				"SUMMARY:Ujian",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Ujian", Start: at(2026, 3, 16, 0, 0), End: at(2026, 3, 23, 0, 0), AllDay: true},
+			firstDay: "2026-03-16",
+			lastDay:  "2026-03-22",
+		},
+		{
+			name: "TZID date-time",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART;TZID=Asia/Jakarta:20261017T080000",
+				"DTEND;TZID=Asia/Jakarta:20261017T120000",
+				"SUMMARY:Rapat",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Rapat", Start: at(2026, 10, 17, 8, 0), End: at(2026, 10, 17, 12, 0)},
+			firstDay: "2026-10-17",
+			lastDay:  "2026-10-17",
+		},
+		{
+			name: "quoted TZID containing a colon",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				`DTSTART;TZID="GMT+07:00":20261017T080000`,
+				"DURATION:PT2H30M",
+				"SUMMARY:Rapat",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Rapat", Start: at(2026, 10, 17, 8, 0), End: at(2026, 10, 17, 10, 30)},
+			firstDay: "2026-10-17",
+			lastDay:  "2026-10-17",
+		},
+		{
+			name: "UTC converted to local time",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART:20261016T200000Z",
+				"DTEND:20261016T230000Z",
+				"SUMMARY:Webinar",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Webinar", Start: at(2026, 10, 17, 3, 0), End: at(2026, 10, 17, 6, 0)},
+			firstDay: "2026-10-17",
+			lastDay:  "2026-10-17",
+		},
+		{
+			name: "date-time ending at midnight",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART:20261017T080000",
+				"DTEND:20261019T000000",
+				"SUMMARY:Kemah",
+				"END:VEVENT",
+			),
+			want:     Event{Summary: "Kemah", Start: at(2026, 10, 17, 8, 0), End: at(2026, 10, 19, 0, 0)},
+			firstDay: "2026-10-17",
+			lastDay:  "2026-10-18",
+		},
+		{
+			name: "escapes, categories and RRULE",
+			ics: calendar(
+				"BEGIN:VEVENT",
+				"DTSTART;VALUE=DATE:20260817",
+				`SUMMARY:Upacara\, HUT RI\; wajib`,
+				`DESCRIPTION:Baris 1\nBaris 2`,
+				"CATEGORIES:Libur, Nasional",
+				"RRULE:FREQ=YEARLY",
+				"END:VEVENT",
+			),
+			want: Event{
+				Summary:     "Upacara, HUT RI; wajib",
+				Description: "Baris 1\nBaris 2",
+				Categories:  []string{"Libur", "Nasional"},
+				Start:       at(2026, 8, 17, 0, 0),
+				End:         at(2026, 8, 18, 0, 0),
+				AllDay:      true,
+				Recurring:   true,
+			},
+			firstDay: "2026-08-17",
+			lastDay:  "2026-08-17",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, problems, err := Parse(strings.NewReader(tt.ics))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != 0 {
+				t.Fatalf("problems: %v", problems)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+
+			got := events[0]
+			if !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) {
+				t.Errorf("time = %v - %v, want %v - %v", got.Start, got.End, tt.want.Start, tt.want.End)
+			}
+			got.Start, got.End = tt.want.Start, tt.want.End
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("event = %+v, want %+v", got, tt.want)
+			}
+			if first := got.FirstDay().Format("2006-01-02"); first != tt.firstDay {
+				t.Errorf("FirstDay() = %s, want %s", first, tt.firstDay)
+			}
+			if last := got.LastDay().Format("2006-01-02"); last != tt.lastDay {
+				t.Errorf("LastDay() = %s, want %s", last, tt.lastDay)
+			}
+		})
+	}
+}
+
+func TestParseKeepsValidEvents(t *testing.T) {
+	useLocal(t)
+
+	ics := calendar(
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261017",
+		"SUMMARY:Satu",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Tanpa tanggal",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261020",
+		"DTEND;VALUE=DATE:20261019",
+		"SUMMARY:Mundur",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:2026-10-21",
+		"SUMMARY:Format salah",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261022",
+		"DURATION:1D",
+		"SUMMARY:Durasi salah",
+		"END:VEVENT",
+		"BAD LINE",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261023",
+		"SUMMARY:Dua",
+		"END:VEVENT",
+	)
+
+	events, problems, err := Parse(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summaries []string
+	for _, e := range events {
+		summaries = append(summaries, e.Summary)
+	}
+	if !reflect.DeepEqual(summaries, []string{"Satu", "Dua"}) {
+		t.Errorf("events = %v, want [Satu Dua]", summaries)
+	}
+
+	wantProblems := []string{"missing DTSTART", "ends before it starts", "invalid DTSTART", "invalid DURATION", "missing ':'"}
+	if len(problems) != len(wantProblems) {
+		t.Fatalf("problems = %v, want %d", problems, len(wantProblems))
+	}
+	for i, want := range wantProblems {
+		if !strings.Contains(problems[i].Error(), want) {
+			t.Errorf("problem %d = %v, want %q", i, problems[i], want)
+		}
+	}
+}
+
+func TestParseRejectsNonCalendar(t *testing.T) {
+	for _, input := range []string{"", "BEGIN:VCARD\r\nEND:VCARD\r\n", "tanggal,nama\r\n"} {
+		if _, _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) accepted a non-calendar file", input)
+		}
+	}
+}
+
+func TestParseByteOrderMarkAndLF(t *testing.T) {
+	useLocal(t)
+
+	ics := "\ufeffBEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20261017\nSUMMARY:Libur\nEND:VEVENT\nEND:VCALENDAR\n"
+	events, problems, err := Parse(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || len(problems) != 0 {
+		t.Fatalf("events = %v, problems = %v", events, problems)
+	}
+}
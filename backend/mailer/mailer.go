@@ -0,0 +1,128 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email. InitMailer picks the implementation from
+// the MAIL_DRIVER environment variable.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var current Mailer = &LogMailer{}
+
+// InitMailer configures the package-level mailer from the environment:
+//
+//	MAIL_DRIVER   smtp or log (default log)
+//	MAIL_FROM     sender address
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+//	MAIL_LOG_PATH file the log driver appends to (default stdout)
+func InitMailer() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@school.local"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		current = &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		log.Println("Mailer: using SMTP driver")
+	default:
+		current = &LogMailer{Path: os.Getenv("MAIL_LOG_PATH"), From: from}
+		log.Println("Mailer: using log driver")
+	}
+}
+
+// SetMailer replaces the package-level mailer.
+func SetMailer(m Mailer) {
+	current = m
+}
+
+// Send delivers msg through the configured mailer.
+func Send(to, subject, body string) error {
+	return current.Send(Message{To: to, Subject: subject, Body: body})
+}
+
+// SMTPMailer sends mail through an SMTP relay using PLAIN auth. STARTTLS is
+// negotiated automatically when the server offers it.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, buildMessage(m.From, msg))
+}
+
+// LogMailer writes messages to a file, or to the standard logger when no
+// path is set. It is meant for local development and testing.
+type LogMailer struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	raw := buildMessage(m.From, msg)
+	if m.Path == "" {
+		log.Printf("Mailer: outgoing email\n%s", raw)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\n\n", raw)
+	return err
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"log"
+	"os"
 	"school-attendance/database"
+	"school-attendance/directory"
 	"school-attendance/handlers"
+	"school-attendance/mailer"
 	"school-attendance/middleware"
+	"school-attendance/models"
+	"school-attendance/oidc"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,6 +18,26 @@ import (
 func main() {
 	// Initialize database
 	database.InitDatabase()
+	directory.Init()
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
+	if err := handlers.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	handlers.WatchSigningKeys()
+	mailer.InitMailer()
+	oidc.InitProviders()
+	handlers.ScheduleDirectorySync()
+	handlers.ScheduleAutoAbsence()
+	handlers.PurgeExpiredTokens()
+	middleware.SetRevocationChecker(handlers.IsTokenRevoked)
+	middleware.SetPermissionResolver(handlers.ResolvePermissions)
+	middleware.SetPendingActionResolver(handlers.PendingAccountAction)
+	middleware.SetAPIKeyResolver(handlers.ResolveAPIKey)
+	middleware.SetIdempotencyStore(handlers.IdempotencyStore)
 
 	// Create Gin router
 	r := gin.Default()
@@ -21,11 +46,14 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", middleware.IdempotencyKeyHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.IdempotentReplayedHeader},
 		AllowCredentials: true,
 	}))
 
+	// Public JWT verification keys
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// WebSocket endpoint for real-time notifications
 	r.GET("/ws", handlers.HandleWebSocket)
 
@@ -38,6 +66,16 @@ func main() {
 			auth.POST("/student/login", handlers.StudentLogin)
 			auth.POST("/student/register", handlers.StudentRegister)
 			auth.POST("/admin/login", handlers.AdminLogin)
+			auth.POST("/admin/verify-2fa", handlers.VerifyTwoFactorLogin)
+			auth.POST("/parent/login", handlers.ParentLogin)
+			auth.GET("/oidc/providers", handlers.GetOIDCProviders)
+			auth.GET("/oidc/:provider/authorize", handlers.StartOIDCLogin)
+			auth.POST("/oidc/:provider/callback", handlers.OIDCCallback)
+			auth.POST("/parent/register", handlers.ParentRegister)
+			auth.POST("/forgot-password", handlers.ForgotPassword)
+			auth.POST("/reset-password", handlers.ResetPassword)
+			auth.POST("/refresh", handlers.RefreshAccessToken)
+			auth.POST("/logout", middleware.AuthMiddleware(""), handlers.Logout)
 		}
 
 		// Protected routes - Student
@@ -45,45 +83,190 @@ func main() {
 		student.Use(middleware.AuthMiddleware("student"))
 		{
 			student.GET("/profile", handlers.GetProfile)
-			student.POST("/checkin", handlers.CheckIn)
+			student.POST("/checkin", middleware.Idempotent(), handlers.CheckIn)
 			student.POST("/checkout", handlers.CheckOut)
 			student.GET("/attendance", handlers.GetMyAttendance)
+			student.GET("/notifications", handlers.GetMyNotifications)
+			student.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
+			
+			// Leave requests
+			student.POST("/leave-requests", handlers.SubmitMyLeaveRequest)
+			student.GET("/leave-requests", handlers.GetMyLeaveRequests)
+			student.GET("/leave-requests/:id/attachment", handlers.GetLeaveAttachment)
+			student.PUT("/leave-requests/:id/cancel", handlers.CancelLeaveRequest)
 			
 			// QR Code scanning
-			student.POST("/qr/scan", handlers.ScanQRCode)
+			student.POST("/qr/scan", middleware.Idempotent(), handlers.ScanQRCode)
 		}
 
 		// Protected routes - Admin
 		admin := api.Group("/admin")
 		admin.Use(middleware.AuthMiddleware("admin"))
+		admin.Use(middleware.BlockPendingActions(
+			"/api/admin/profile",
+			"/api/admin/change-password",
+			"/api/admin/2fa",
+			"/api/admin/2fa/setup",
+			"/api/admin/2fa/enable",
+		))
 		{
 			admin.GET("/profile", handlers.GetProfile)
+			admin.GET("/my-classes", handlers.GetMyClasses)
+			admin.POST("/change-password", handlers.ChangePassword)
+			admin.GET("/notifications", handlers.GetMyNotifications)
+			admin.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
+
+			// Two-factor authentication
+			admin.GET("/2fa", handlers.GetTwoFactorStatus)
+			admin.POST("/2fa/setup", handlers.SetupTwoFactor)
+			admin.POST("/2fa/enable", handlers.EnableTwoFactor)
+			admin.POST("/2fa/disable", handlers.DisableTwoFactor)
+			admin.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
 			
 			// Student management
-			admin.GET("/students", handlers.GetAllStudents)
-			admin.GET("/students/:id", handlers.GetStudent)
-			admin.POST("/students", handlers.CreateStudent)
-			admin.PUT("/students/:id", handlers.UpdateStudent)
-			admin.DELETE("/students/:id", handlers.DeleteStudent)
-			admin.GET("/students/class/:class", handlers.GetStudentsByClass)
-			admin.GET("/students/grade/:grade", handlers.GetStudentsByGrade)
+			admin.GET("/students", middleware.RequirePermission(models.PermStudentsRead), handlers.GetAllStudents)
+			admin.GET("/students/:id", middleware.RequirePermission(models.PermStudentsRead), handlers.GetStudent)
+			admin.POST("/students", middleware.RequirePermission(models.PermStudentsCreate), handlers.CreateStudent)
+			admin.PUT("/students/:id", middleware.RequirePermission(models.PermStudentsUpdate), handlers.UpdateStudent)
+			admin.DELETE("/students/:id", middleware.RequirePermission(models.PermStudentsDelete), handlers.DeleteStudent)
+			admin.GET("/students/class/:class", middleware.RequirePermission(models.PermStudentsRead), handlers.GetStudentsByClass)
+			admin.GET("/students/grade/:grade", middleware.RequirePermission(models.PermStudentsRead), handlers.GetStudentsByGrade)
 			
 			// Attendance management
-			admin.GET("/attendance", handlers.GetAllAttendance)
-			admin.POST("/attendance", handlers.CreateAttendance)
-			admin.PUT("/attendance/:id", handlers.UpdateAttendance)
-			admin.GET("/attendance/stats", handlers.GetAttendanceStats)
+			admin.GET("/attendance", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetAllAttendance)
+			admin.POST("/attendance", middleware.RequirePermission(models.PermAttendanceCreate), handlers.CreateAttendance)
+			admin.POST("/attendance/checkin", middleware.RequirePermission(models.PermAttendanceCheckinOnBehalf), middleware.Idempotent(), handlers.CheckInOnBehalf)
+			admin.GET("/attendance/daily", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetDailyAttendance)
+			admin.GET("/attendance/roll-call", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetRollCallRoster)
+			admin.POST("/attendance/roll-call", middleware.RequirePermission(models.PermAttendanceCreate), handlers.SubmitRollCall)
+			admin.POST("/attendance/mark-absences", middleware.RequirePermission(models.PermAttendanceCreate, models.PermClassesAll), handlers.MarkAbsences)
+			admin.GET("/attendance/mark-absences/runs", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetAutoAbsenceRuns)
+			admin.PUT("/attendance/:id", middleware.RequirePermission(models.PermAttendanceUpdate), handlers.UpdateAttendance)
+			admin.GET("/attendance/:id/history", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetAttendanceHistory)
+			admin.POST("/attendance/:id/revert", middleware.RequirePermission(models.PermAttendanceUpdate), handlers.RevertAttendance)
+			admin.GET("/attendance/stats", middleware.RequirePermission(models.PermReportsView), handlers.GetAttendanceStats)
+
+			// Attendance locks and corrections
+			admin.GET("/attendance/locks", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetAttendanceLocks)
+			admin.POST("/attendance/locks", middleware.RequirePermission(models.PermAttendanceLock), handlers.CreateAttendanceLock)
+			admin.DELETE("/attendance/locks/:id", middleware.RequirePermission(models.PermAttendanceLock), handlers.DeleteAttendanceLock)
+			admin.GET("/attendance/corrections", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetAttendanceCorrections)
+			admin.GET("/attendance/corrections/:id", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetAttendanceCorrection)
+			admin.POST("/attendance/corrections/:id/approve", middleware.RequirePermission(models.PermAttendanceApprove), handlers.ApproveAttendanceCorrection)
+			admin.POST("/attendance/corrections/:id/reject", middleware.RequirePermission(models.PermAttendanceApprove), handlers.RejectAttendanceCorrection)
+			admin.PUT("/attendance/corrections/:id/cancel", middleware.RequirePermission(models.PermAttendanceUpdate), handlers.CancelAttendanceCorrection)
+			
+			// Bell schedule
+			admin.GET("/bell-schedules", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetBellSchedules)
+			admin.GET("/bell-schedules/effective", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetEffectiveBellSchedule)
+			admin.POST("/bell-schedules", middleware.RequirePermission(models.PermScheduleManage), handlers.CreateBellSchedule)
+			admin.PUT("/bell-schedules/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.UpdateBellSchedule)
+			admin.DELETE("/bell-schedules/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.DeleteBellSchedule)
+			admin.GET("/lesson-periods", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetLessonPeriods)
+			admin.POST("/lesson-periods", middleware.RequirePermission(models.PermScheduleManage), handlers.CreateLessonPeriod)
+			admin.PUT("/lesson-periods/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.UpdateLessonPeriod)
+			admin.DELETE("/lesson-periods/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.DeleteLessonPeriod)
+			
+			// Academic calendar
+			admin.GET("/calendar/school-years", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetSchoolYears)
+			admin.POST("/calendar/school-years", middleware.RequirePermission(models.PermScheduleManage), handlers.CreateSchoolYear)
+			admin.PUT("/calendar/school-years/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.UpdateSchoolYear)
+			admin.DELETE("/calendar/school-years/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.DeleteSchoolYear)
+			admin.POST("/calendar/school-years/:id/semesters", middleware.RequirePermission(models.PermScheduleManage), handlers.CreateSemester)
+			admin.PUT("/calendar/semesters/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.UpdateSemester)
+			admin.DELETE("/calendar/semesters/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.DeleteSemester)
+			admin.GET("/calendar/events", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetCalendarEvents)
+			admin.POST("/calendar/events", middleware.RequirePermission(models.PermScheduleManage), handlers.CreateCalendarEvent)
+			admin.PUT("/calendar/events/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.UpdateCalendarEvent)
+			admin.DELETE("/calendar/events/:id", middleware.RequirePermission(models.PermScheduleManage), handlers.DeleteCalendarEvent)
+			admin.POST("/calendar/import", middleware.RequirePermission(models.PermScheduleManage), handlers.ImportCalendar)
+			admin.GET("/calendar/school-days", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetSchoolDays)
+			
+			// Leave requests
+			admin.GET("/leave-requests", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetLeaveRequests)
+			admin.GET("/leave-requests/:id", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetLeaveRequest)
+			admin.GET("/leave-requests/:id/attachment", middleware.RequirePermission(models.PermAttendanceRead), handlers.GetLeaveAttachment)
+			admin.POST("/leave-requests/:id/approve", middleware.RequirePermission(models.PermLeaveApprove), handlers.ApproveLeaveRequest)
+			admin.POST("/leave-requests/:id/reject", middleware.RequirePermission(models.PermLeaveApprove), handlers.RejectLeaveRequest)
 			
 			// QR Code attendance system
-			admin.POST("/qr/generate", handlers.GenerateQRCode)
-			admin.GET("/qr/sessions", handlers.GetQRSessions)
-			admin.PUT("/qr/sessions/:session_code/deactivate", handlers.DeactivateQRSession)
-			admin.GET("/qr/attendance/:session_code", handlers.GetQRAttendanceReport)
+			admin.POST("/qr/generate", middleware.RequirePermission(models.PermQRGenerate), handlers.GenerateQRCode)
+			admin.GET("/qr/sessions", middleware.RequirePermission(models.PermQRManage), handlers.GetQRSessions)
+			admin.PUT("/qr/sessions/:session_code/deactivate", middleware.RequirePermission(models.PermQRManage), handlers.DeactivateQRSession)
+			admin.GET("/qr/attendance/:session_code", middleware.RequirePermission(models.PermQRManage), handlers.GetQRAttendanceReport)
 			
 			// Report exports
-			admin.GET("/reports/export/pdf", handlers.ExportAttendanceToPDF)
-			admin.GET("/reports/export/excel", handlers.ExportAttendanceToExcel)
-			admin.GET("/reports/stats", handlers.GetAttendanceStats)
+			admin.GET("/reports/export/pdf", middleware.RequirePermission(models.PermReportsExport), handlers.ExportAttendanceToPDF)
+			admin.GET("/reports/export/excel", middleware.RequirePermission(models.PermReportsExport), handlers.ExportAttendanceToExcel)
+			admin.GET("/reports/stats", middleware.RequirePermission(models.PermReportsView), handlers.GetReportStats)
+
+			// Parent accounts
+			admin.GET("/parents", middleware.RequirePermission(models.PermParentsManage), handlers.GetAllParents)
+			admin.GET("/parents/:id", middleware.RequirePermission(models.PermParentsManage), handlers.GetParent)
+			admin.POST("/parents", middleware.RequirePermission(models.PermParentsManage), handlers.CreateParent)
+			admin.PUT("/parents/:id", middleware.RequirePermission(models.PermParentsManage), handlers.UpdateParent)
+			admin.PUT("/parents/:id/deactivate", middleware.RequirePermission(models.PermParentsManage), handlers.DeactivateParent)
+			admin.POST("/parents/:id/students", middleware.RequirePermission(models.PermParentsManage), handlers.LinkParentStudent)
+			admin.DELETE("/parents/:id/students/:student_id", middleware.RequirePermission(models.PermParentsManage), handlers.UnlinkParentStudent)
+			admin.POST("/parents/import", middleware.RequirePermission(models.PermParentsManage), handlers.ImportParentLinks)
+			admin.POST("/parents/invite", middleware.RequirePermission(models.PermParentsManage), handlers.InviteParent)
+
+			// Admin accounts
+			admin.GET("/admins", middleware.RequirePermission(models.PermAdminsManage), handlers.GetAllAdmins)
+			admin.GET("/admins/:id", middleware.RequirePermission(models.PermAdminsManage), handlers.GetAdmin)
+			admin.POST("/admins", middleware.RequirePermission(models.PermAdminsManage), handlers.CreateAdmin)
+			admin.PUT("/admins/:id", middleware.RequirePermission(models.PermAdminsManage), handlers.UpdateAdmin)
+			admin.PUT("/admins/:id/deactivate", middleware.RequirePermission(models.PermAdminsManage), handlers.DeactivateAdmin)
+			admin.DELETE("/admins/:id", middleware.RequirePermission(models.PermAdminsManage), handlers.DeleteAdmin)
+			admin.POST("/admins/:id/reset-password", middleware.RequirePermission(models.PermAdminsManage), handlers.ResetAdminPassword)
+			admin.GET("/admins/:id/assignments", middleware.RequirePermission(models.PermAdminsManage), handlers.GetTeachingAssignments)
+			admin.PUT("/admins/:id/assignments", middleware.RequirePermission(models.PermAdminsManage), handlers.SetTeachingAssignments)
+
+			// Token revocation
+			admin.POST("/users/:user_type/:id/revoke-tokens", middleware.RequirePermission(models.PermUsersManage), handlers.RevokeUserTokens)
+			admin.GET("/users/:user_type/:id/sessions", middleware.RequirePermission(models.PermUsersManage), handlers.GetUserSessions)
+			admin.DELETE("/users/:user_type/:id/sessions", middleware.RequirePermission(models.PermUsersManage), handlers.RevokeUserTokens)
+
+			// Audit trail
+			admin.GET("/audit", middleware.RequirePermission(models.PermAuditRead), handlers.GetAuditLogs)
+			admin.GET("/audit/export", middleware.RequirePermission(models.PermAuditRead), handlers.ExportAuditLogs)
+
+			// Directory sync
+			admin.POST("/directory/sync", middleware.RequirePermission(models.PermUsersManage), handlers.SyncDirectory)
+			admin.GET("/directory/sync-runs", middleware.RequirePermission(models.PermUsersManage), handlers.GetDirectorySyncRuns)
+			admin.GET("/directory/sync-runs/:id", middleware.RequirePermission(models.PermUsersManage), handlers.GetDirectorySyncRun)
+
+			// Login security
+			admin.GET("/security/failed-logins", middleware.RequirePermission(models.PermUsersManage), handlers.GetFailedLogins)
+			admin.GET("/security/lockouts", middleware.RequirePermission(models.PermUsersManage), handlers.GetLockouts)
+			admin.POST("/security/unlock", middleware.RequirePermission(models.PermUsersManage), handlers.UnlockLogin)
+
+			// Roles and permissions
+			admin.GET("/permissions", middleware.RequirePermission(models.PermRolesManage), handlers.GetPermissions)
+			admin.GET("/roles", middleware.RequirePermission(models.PermRolesManage), handlers.GetRoles)
+			admin.POST("/roles", middleware.RequirePermission(models.PermRolesManage), handlers.CreateRole)
+			admin.PUT("/roles/:id", middleware.RequirePermission(models.PermRolesManage), handlers.UpdateRole)
+			admin.DELETE("/roles/:id", middleware.RequirePermission(models.PermRolesManage), handlers.DeleteRole)
+
+			// API keys for kiosks and scripts
+			admin.GET("/api-keys", middleware.RequirePermission(models.PermAPIKeysManage), handlers.GetAPIKeys)
+			admin.POST("/api-keys", middleware.RequirePermission(models.PermAPIKeysManage), handlers.CreateAPIKey)
+			admin.DELETE("/api-keys/:id", middleware.RequirePermission(models.PermAPIKeysManage), handlers.RevokeAPIKey)
+		}
+
+		// Protected routes - Parent
+		parent := api.Group("/parent")
+		parent.Use(middleware.AuthMiddleware("parent"))
+		{
+			parent.GET("/profile", handlers.GetProfile)
+			parent.GET("/children", handlers.GetMyChildren)
+			parent.GET("/children/:id/attendance", handlers.GetChildAttendance)
+			parent.POST("/children/:id/leave-requests", handlers.SubmitChildLeaveRequest)
+			parent.GET("/leave-requests", handlers.GetChildrenLeaveRequests)
+			parent.GET("/leave-requests/:id/attachment", handlers.GetLeaveAttachment)
+			parent.PUT("/leave-requests/:id/cancel", handlers.CancelLeaveRequest)
+			parent.GET("/notifications", handlers.GetMyNotifications)
+			parent.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
 		}
 
 		// Protected routes - Both student and admin
@@ -91,6 +274,10 @@ func main() {
 		protected.Use(middleware.AuthMiddleware(""))
 		{
 			protected.GET("/profile", handlers.GetProfile)
+			protected.POST("/change-password", handlers.ChangePassword)
+			protected.GET("/profile/sessions", handlers.GetMySessions)
+			protected.DELETE("/profile/sessions", handlers.RevokeOtherSessions)
+			protected.DELETE("/profile/sessions/:id", handlers.RevokeMySession)
 		}
 	}
 
@@ -1,25 +1,91 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"net/http"
+	"school-attendance/models"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
 )
 
-var jwtSecret = []byte(getJWTSecret())
+// AccessTokenTTL is the lifetime of an access token. Clients keep a session
+// alive by exchanging their refresh token at /api/auth/refresh.
+const AccessTokenTTL = 15 * time.Minute
+
+// RevocationChecker reports whether the token with the given jti has been
+// revoked. It is installed by main so the middleware does not depend on the
+// database package.
+type RevocationChecker func(jti string) bool
+
+var isRevoked RevocationChecker = func(string) bool { return false }
+
+func SetRevocationChecker(checker RevocationChecker) {
+	isRevoked = checker
+}
+
+// APIKeyResolver looks up a raw API key and returns the key id and the
+// permissions it was scoped to. It is installed by main so the middleware
+// does not depend on the database package.
+type APIKeyResolver func(key, clientIP string) (uint, []string, error)
+
+var resolveAPIKey APIKeyResolver = func(string, string) (uint, []string, error) {
+	return 0, nil, errors.New("api keys are not enabled")
+}
+
+func SetAPIKeyResolver(resolver APIKeyResolver) {
+	resolveAPIKey = resolver
+}
+
+// apiKeyFromRequest returns the key sent in X-API-Key or as
+// "Authorization: ApiKey <key>", or "" when none was sent.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "ApiKey ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "ApiKey "))
+	}
+	return ""
+}
 
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	UserType string `json:"user_type"` // "student" or "admin"
+	UserID    uint   `json:"user_id"`
+	UserType  string `json:"user_type"` // "student", "admin" or "parent"
+	SessionID uint   `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 func AuthMiddleware(userType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API keys stand in for admins only; their scopes are checked by
+		// RequirePermission like any other permission set.
+		if key := apiKeyFromRequest(c); key != "" {
+			if userType != "admin" {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this endpoint"})
+				c.Abort()
+				return
+			}
+
+			keyID, scopes, err := resolveAPIKey(key, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", keyID)
+			c.Set("user_type", "api_key")
+			c.Set("api_key_id", keyID)
+			c.Set("permissions", scopes)
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -30,9 +96,7 @@ func AuthMiddleware(userType string) gin.HandlerFunc {
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 		
 		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -40,6 +104,12 @@ func AuthMiddleware(userType string) gin.HandlerFunc {
 			return
 		}
 
+		if isRevoked(claims.ID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Check if user type matches required type (if specified)
 		if userType != "" && claims.UserType != userType {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
@@ -50,22 +120,46 @@ func AuthMiddleware(userType string) gin.HandlerFunc {
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_type", claims.UserType)
+		c.Set("token_id", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
 
-func GenerateToken(userID uint, userType string) (string, error) {
+// GenerateToken issues a short-lived access token for the login session and
+// returns it together with its jti so callers can bind it to a refresh token.
+func GenerateToken(userID uint, userType string, sessionID uint) (string, string, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
 	claims := Claims{
-		UserID:   userID,
-		UserType: userType,
+		UserID:    userID,
+		UserType:  userType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	signed, err := signClaims(claims)
+	if err != nil {
+		return "", "", err
+	}
+	return signed, jti, nil
+}
+
+func generateTokenID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
 }
 
 func OptionalAuth() gin.HandlerFunc {
@@ -75,15 +169,109 @@ func OptionalAuth() gin.HandlerFunc {
 			tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 			
 			claims := &Claims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				return jwtSecret, nil
-			})
+			token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
 
-			if err == nil && token.Valid {
+			if err == nil && token.Valid && !isRevoked(claims.ID) {
 				c.Set("user_id", claims.UserID)
 				c.Set("user_type", claims.UserType)
 			}
 		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// ParseToken validates a raw access token outside of the gin middleware
+// chain, e.g. for WebSocket upgrades where headers cannot be set.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || isRevoked(claims.ID) {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// PermissionResolver returns the permissions granted to a user. It is
+// installed by main so the middleware does not depend on the database package.
+type PermissionResolver func(userID uint, userType string) ([]string, error)
+
+var resolvePermissions PermissionResolver = func(uint, string) ([]string, error) { return nil, nil }
+
+func SetPermissionResolver(resolver PermissionResolver) {
+	resolvePermissions = resolver
+}
+
+// RequirePermission must run after AuthMiddleware and aborts with 403 unless
+// the authenticated user holds every listed permission.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, ok := c.Get("permissions")
+		if !ok {
+			userID := c.GetUint("user_id")
+			userType := c.GetString("user_type")
+
+			resolved, err := resolvePermissions(userID, userType)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+				c.Abort()
+				return
+			}
+			c.Set("permissions", resolved)
+			granted = resolved
+		}
+
+		for _, perm := range permissions {
+			if !models.HasPermission(granted.([]string), perm) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "required": perm})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// PendingActionResolver returns the setup step an account must complete
+// before it may use the API, or "" when there is none. It is installed by
+// main so the middleware does not depend on the database package.
+type PendingActionResolver func(userID uint, userType string) (string, error)
+
+var resolvePendingAction PendingActionResolver = func(uint, string) (string, error) { return "", nil }
+
+func SetPendingActionResolver(resolver PendingActionResolver) {
+	resolvePendingAction = resolver
+}
+
+// BlockPendingActions must run after AuthMiddleware. While the account has a
+// pending setup step only the allowed route patterns stay reachable.
+func BlockPendingActions(allowedRoutes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, route := range allowedRoutes {
+			if c.FullPath() == route {
+				c.Next()
+				return
+			}
+		}
+
+		action, err := resolvePendingAction(c.GetUint("user_id"), c.GetString("user_type"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account state"})
+			c.Abort()
+			return
+		}
+		if action != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "Account setup must be completed first",
+				"pending_action": action,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
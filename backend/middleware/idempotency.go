@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader carries a client-chosen key, unique per logical
+	// request, e.g. a UUID generated when the student taps check-in.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from an earlier
+	// request with the same key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// IdempotencyKeyTTL is how long a response is replayed for its key.
+	IdempotencyKeyTTL = 24 * time.Hour
+
+	maxIdempotencyKeyLength = 255
+)
+
+// StoredResponse is the response kept for an idempotency key. StatusCode is
+// 0 while the request that claimed the key is still running.
+type StoredResponse struct {
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore keeps responses by user and key. It is installed by main
+// so the middleware does not depend on the database package.
+type IdempotencyStore interface {
+	// Claim reserves the key for a new request and returns nil, or returns
+	// what is stored when the key was used before.
+	Claim(userID uint, userType, key, requestHash string) (*StoredResponse, error)
+	Save(userID uint, userType, key string, response StoredResponse) error
+	// Release frees a claimed key so the request can be retried with it.
+	Release(userID uint, userType, key string) error
+}
+
+var idempotencyStore IdempotencyStore
+
+func SetIdempotencyStore(store IdempotencyStore) {
+	idempotencyStore = store
+}
+
+// responseRecorder copies the response body while it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent must run after AuthMiddleware. Requests sent with an
+// Idempotency-Key header are handled once per user and key; retries get the
+// original response back. Reusing a key for a different request is
+// rejected with 422, and a retry arriving while the first request is still
+// running with 409. Server errors are not stored so they can be retried.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || idempotencyStore == nil {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		io.WriteString(hash, c.Request.Method+" "+c.FullPath()+"\n")
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		userID := c.GetUint("user_id")
+		userType := c.GetString("user_type")
+
+		stored, err := idempotencyStore.Claim(userID, userType, key, requestHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			c.Abort()
+			return
+		}
+		if stored != nil {
+			switch {
+			case stored.RequestHash != requestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case stored.StatusCode == 0:
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(stored.StatusCode, stored.ContentType, stored.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			err = idempotencyStore.Release(userID, userType, key)
+		} else {
+			err = idempotencyStore.Save(userID, userType, key, StoredResponse{
+				RequestHash: requestHash,
+				StatusCode:  recorder.Status(),
+				ContentType: recorder.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			log.Printf("Error storing response for Idempotency-Key: %v", err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one entry of the JWT keyset. A key signs new tokens once
+// ActiveFrom has passed and it is the newest such key; it verifies tokens
+// until VerifyUntil, so tokens signed before a rotation stay valid for the
+// grace period.
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	ActiveFrom  time.Time
+	VerifyUntil *time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+var keyset struct {
+	sync.RWMutex
+	keys []SigningKey // newest ActiveFrom first
+}
+
+// legacySecret verifies tokens issued before the keyset existed, which carry
+// no kid header. It is only used when JWT_SECRET is set.
+var legacySecret = []byte(os.Getenv("JWT_SECRET"))
+
+// SetSigningKeys replaces the keyset. It is called at startup and whenever
+// the stored keys are reloaded.
+func SetSigningKeys(keys []SigningKey) {
+	sorted := append([]SigningKey(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ActiveFrom.After(sorted[j].ActiveFrom)
+	})
+
+	keyset.Lock()
+	keyset.keys = sorted
+	keyset.Unlock()
+}
+
+func (k *SigningKey) verifiesAt(now time.Time) bool {
+	return k.VerifyUntil == nil || now.Before(*k.VerifyUntil)
+}
+
+// currentSigningKey returns the key new tokens are signed with.
+func currentSigningKey() (*SigningKey, error) {
+	keyset.RLock()
+	defer keyset.RUnlock()
+
+	now := time.Now()
+	for i := range keyset.keys {
+		key := &keyset.keys[i]
+		if !key.ActiveFrom.After(now) && key.verifiesAt(now) {
+			return key, nil
+		}
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// keyFunc picks the verification key from the token's kid header and refuses
+// tokens whose alg does not match the key, so an RSA public key can never be
+// used as an HMAC secret.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if len(legacySecret) == 0 || token.Method.Alg() != AlgHS256 {
+			return nil, errors.New("token has no key id")
+		}
+		return legacySecret, nil
+	}
+
+	keyset.RLock()
+	defer keyset.RUnlock()
+
+	now := time.Now()
+	for _, key := range keyset.keys {
+		if key.ID != kid {
+			continue
+		}
+		if !key.verifiesAt(now) {
+			return nil, errors.New("signing key has been retired")
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verifyKey, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func signClaims(claims jwt.Claims) (string, error) {
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// GenerateKeyMaterial creates new private key material for alg and returns
+// it PEM encoded (PKCS#8) for RS256/EdDSA or base64 encoded for HS256.
+func GenerateKeyMaterial(alg string) (string, error) {
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(secret), nil
+	case AlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return "", err
+		}
+		return encodePrivateKey(private)
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		return encodePrivateKey(private)
+	}
+	return "", fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+func encodePrivateKey(key crypto.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// NewSigningKey parses key material produced by GenerateKeyMaterial.
+func NewSigningKey(id, alg, material string, activeFrom time.Time, verifyUntil *time.Time) (SigningKey, error) {
+	key := SigningKey{ID: id, Algorithm: alg, ActiveFrom: activeFrom, VerifyUntil: verifyUntil}
+
+	switch alg {
+	case AlgHS256:
+		secret, err := base64.StdEncoding.DecodeString(material)
+		if err != nil {
+			return key, err
+		}
+		key.signKey, key.verifyKey = secret, secret
+	case AlgRS256:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(material))
+		if err != nil {
+			return key, err
+		}
+		key.signKey, key.verifyKey = private, &private.PublicKey
+	case AlgEdDSA:
+		private, err := jwt.ParseEdPrivateKeyFromPEM([]byte(material))
+		if err != nil {
+			return key, err
+		}
+		key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+	default:
+		return key, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return key, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// PublicJWKS lists the public half of every asymmetric key that can still
+// verify tokens, including keys published ahead of their activation. HS256
+// keys are secret and never published.
+func PublicJWKS() []JWK {
+	keyset.RLock()
+	defer keyset.RUnlock()
+
+	now := time.Now()
+	jwks := []JWK{}
+	for _, key := range keyset.keys {
+		if !key.verifiesAt(now) {
+			continue
+		}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return jwks
+}
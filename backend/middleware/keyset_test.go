@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKey(t *testing.T, id, alg string, activeFrom time.Time, verifyUntil *time.Time) SigningKey {
+	t.Helper()
+	material, err := GenerateKeyMaterial(alg)
+	if err != nil {
+		t.Fatalf("GenerateKeyMaterial(%s): %v", alg, err)
+	}
+	key, err := NewSigningKey(id, alg, material, activeFrom, verifyUntil)
+	if err != nil {
+		t.Fatalf("NewSigningKey(%s): %v", alg, err)
+	}
+	return key
+}
+
+// useKeys installs keys and secret for the duration of the test.
+func useKeys(t *testing.T, secret string, keys ...SigningKey) {
+	t.Helper()
+	previousSecret := legacySecret
+	SetSigningKeys(keys)
+	legacySecret = []byte(secret)
+	t.Cleanup(func() {
+		SetSigningKeys(nil)
+		legacySecret = previousSecret
+	})
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, signKey interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{Subject: "1"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(signKey)
+	if err != nil {
+		t.Fatalf("signing test token: %v", err)
+	}
+	return signed
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestKeyFunc(t *testing.T) {
+	now := time.Now()
+	hs := newTestKey(t, "hs", AlgHS256, now.Add(-time.Hour), nil)
+	rs := newTestKey(t, "rs", AlgRS256, now.Add(-time.Hour), nil)
+	ed := newTestKey(t, "ed", AlgEdDSA, now.Add(-time.Hour), nil)
+	retired := newTestKey(t, "retired", AlgHS256, now.Add(-2*time.Hour), timePtr(now.Add(-time.Minute)))
+	grace := newTestKey(t, "grace", AlgHS256, now.Add(-2*time.Hour), timePtr(now.Add(time.Hour)))
+	useKeys(t, "legacy-secret", hs, rs, ed, retired, grace)
+
+	// An attacker who knows the RSA public key signs an HS256 token with its
+	// PEM encoding as the HMAC secret.
+	publicDER, err := x509.MarshalPKIXPublicKey(rs.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"HS256 key", signTestToken(t, jwt.SigningMethodHS256, "hs", hs.signKey), ""},
+		{"RS256 key", signTestToken(t, jwt.SigningMethodRS256, "rs", rs.signKey), ""},
+		{"EdDSA key", signTestToken(t, jwt.SigningMethodEdDSA, "ed", ed.signKey), ""},
+		{"key in grace period", signTestToken(t, jwt.SigningMethodHS256, "grace", grace.signKey), ""},
+		{"retired key", signTestToken(t, jwt.SigningMethodHS256, "retired", retired.signKey), "retired"},
+		{"unknown kid", signTestToken(t, jwt.SigningMethodHS256, "missing", hs.signKey), "unknown key id"},
+		{"RS256 public key as HS256 secret", signTestToken(t, jwt.SigningMethodHS256, "rs", publicPEM), "unexpected signing method"},
+		{"EdDSA kid with RS256 token", signTestToken(t, jwt.SigningMethodRS256, "ed", rs.signKey), "unexpected signing method"},
+		{"wrong HS256 secret", signTestToken(t, jwt.SigningMethodHS256, "hs", []byte("guess")), "signature is invalid"},
+		{"legacy token without kid", signTestToken(t, jwt.SigningMethodHS256, "", []byte("legacy-secret")), ""},
+		{"legacy token with wrong secret", signTestToken(t, jwt.SigningMethodHS256, "", []byte("guess")), "signature is invalid"},
+		{"RS256 token without kid", signTestToken(t, jwt.SigningMethodRS256, "", rs.signKey), "no key id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, keyFunc)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyFuncLegacyDisabled(t *testing.T) {
+	useKeys(t, "")
+
+	token := signTestToken(t, jwt.SigningMethodHS256, "", []byte(""))
+	if _, err := jwt.Parse(token, keyFunc); err == nil || !strings.Contains(err.Error(), "no key id") {
+		t.Fatalf("error = %v, want no key id", err)
+	}
+}
+
+func TestCurrentSigningKey(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		keys   []SigningKey
+		wantID string
+	}{
+		{
+			name: "newest active key",
+			keys: []SigningKey{
+				newTestKey(t, "old", AlgHS256, now.Add(-2*time.Hour), timePtr(now.Add(time.Hour))),
+				newTestKey(t, "new", AlgHS256, now.Add(-time.Hour), nil),
+			},
+			wantID: "new",
+		},
+		{
+			name: "input order does not matter",
+			keys: []SigningKey{
+				newTestKey(t, "new", AlgHS256, now.Add(-time.Hour), nil),
+				newTestKey(t, "old", AlgHS256, now.Add(-2*time.Hour), nil),
+			},
+			wantID: "new",
+		},
+		{
+			name: "published key not yet active",
+			keys: []SigningKey{
+				newTestKey(t, "current", AlgHS256, now.Add(-time.Hour), nil),
+				newTestKey(t, "next", AlgHS256, now.Add(time.Hour), nil),
+			},
+			wantID: "current",
+		},
+		{
+			name: "retired key is skipped",
+			keys: []SigningKey{
+				newTestKey(t, "older", AlgHS256, now.Add(-3*time.Hour), nil),
+				newTestKey(t, "retired", AlgHS256, now.Add(-time.Hour), timePtr(now.Add(-time.Minute))),
+			},
+			wantID: "older",
+		},
+		{
+			name: "no active key",
+			keys: []SigningKey{
+				newTestKey(t, "next", AlgHS256, now.Add(time.Hour), nil),
+			},
+		},
+		{
+			name: "empty keyset",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeys(t, "", tt.keys...)
+
+			key, err := currentSigningKey()
+			if tt.wantID == "" {
+				if err == nil {
+					t.Fatalf("got key %q, want error", key.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.ID != tt.wantID {
+				t.Errorf("key = %q, want %q", key.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestSignClaimsUsesCurrentKey(t *testing.T) {
+	now := time.Now()
+	useKeys(t, "",
+		newTestKey(t, "old", AlgHS256, now.Add(-2*time.Hour), timePtr(now.Add(time.Hour))),
+		newTestKey(t, "rs", AlgRS256, now.Add(-time.Hour), nil),
+	)
+
+	signed, err := signClaims(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Parse(signed, keyFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "rs" || token.Method.Alg() != AlgRS256 {
+		t.Errorf("signed with kid %v alg %s, want rs RS256", token.Header["kid"], token.Method.Alg())
+	}
+}
+
+func TestNewSigningKeyRejectsBadInput(t *testing.T) {
+	if _, err := NewSigningKey("x", "none", "", time.Now(), nil); err == nil {
+		t.Error("accepted an unsupported algorithm")
+	}
+	if _, err := NewSigningKey("x", AlgRS256, "not pem", time.Now(), nil); err == nil {
+		t.Error("accepted invalid RSA material")
+	}
+	if _, err := GenerateKeyMaterial("none"); err == nil {
+		t.Error("generated material for an unsupported algorithm")
+	}
+}
+
+func TestPublicJWKS(t *testing.T) {
+	now := time.Now()
+	rs := newTestKey(t, "rs", AlgRS256, now.Add(-time.Hour), nil)
+	ed := newTestKey(t, "ed-next", AlgEdDSA, now.Add(time.Hour), nil)
+	useKeys(t, "",
+		rs,
+		ed,
+		newTestKey(t, "hs", AlgHS256, now.Add(-time.Hour), nil),
+		newTestKey(t, "rs-retired", AlgRS256, now.Add(-2*time.Hour), timePtr(now.Add(-time.Minute))),
+	)
+
+	jwks := PublicJWKS()
+	byID := map[string]JWK{}
+	for _, jwk := range jwks {
+		byID[jwk.KeyID] = jwk
+	}
+	if len(jwks) != 2 || len(byID) != 2 {
+		t.Fatalf("got %d keys %v, want rs and ed-next", len(jwks), jwks)
+	}
+
+	rsJWK, ok := byID["rs"]
+	if !ok {
+		t.Fatal("rs missing from JWKS")
+	}
+	if rsJWK.KeyType != "RSA" || rsJWK.Algorithm != AlgRS256 || rsJWK.Use != "sig" || rsJWK.E != "AQAB" {
+		t.Errorf("unexpected RSA JWK %+v", rsJWK)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(rsJWK.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new(big.Int).SetBytes(n).Cmp(rs.verifyKey.(*rsa.PublicKey).N) != 0 {
+		t.Error("RSA modulus does not match the key")
+	}
+
+	edJWK, ok := byID["ed-next"]
+	if !ok {
+		t.Fatal("key published ahead of activation missing from JWKS")
+	}
+	if edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" || edJWK.Algorithm != AlgEdDSA {
+		t.Errorf("unexpected EdDSA JWK %+v", edJWK)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(edJWK.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.PublicKey(x).Equal(ed.verifyKey) {
+		t.Error("Ed25519 public key does not match the key")
+	}
+}
+
+func TestPublicJWKSEmpty(t *testing.T) {
+	useKeys(t, "")
+
+	if jwks := PublicJWKS(); jwks == nil || len(jwks) != 0 {
+		t.Errorf("PublicJWKS() = %#v, want empty list", jwks)
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// AutoAbsenceRun records one pass of the end-of-day job that marks students
+// without any attendance record as absent.
+type AutoAbsenceRun struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Date          time.Time  `json:"date" gorm:"index"`
+	Trigger       string     `json:"trigger"` // schedule, manual, cli
+	DryRun        bool       `json:"dry_run"`
+	Marked        int        `json:"marked"`
+	SkippedReason string     `json:"skipped_reason,omitempty"` // set when the date is not a school day
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey authenticates kiosks and scripts without a user session. Only the
+// SHA-256 hash of the key is stored; Prefix is kept so admins can tell keys
+// apart.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"index;not null"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"scopes"` // comma separated permissions
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedBy  uint       `json:"created_by"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// APIKeyScopes are the permissions a key may carry: what kiosks, gate
+// readers and reporting scripts need. Managing accounts, roles and keys and
+// approving corrections always require a person.
+var APIKeyScopes = []string{
+	PermStudentsRead,
+	PermClassesAll,
+	PermAttendanceRead, PermAttendanceCreate,
+	PermAttendanceCheckinOnBehalf,
+	PermQRGenerate, PermQRManage,
+	PermReportsView, PermReportsExport,
+}
+
+// IsAPIKeyScope reports whether perm may be granted to an API key.
+func IsAPIKeyScope(perm string) bool {
+	for _, scope := range APIKeyScopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// IsUsable reports whether the key is neither revoked nor expired.
+func (k *APIKey) IsUsable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
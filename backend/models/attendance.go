@@ -7,13 +7,15 @@ import (
 
 type Attendance struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
-	StudentID   uint      `json:"student_id" gorm:"not null"`
-	Date        time.Time `json:"date" gorm:"not null"`
+	StudentID   uint      `json:"student_id" gorm:"not null;uniqueIndex:idx_attendance_slot,where:deleted_at IS NULL"`
+	Date        time.Time `json:"date" gorm:"not null;uniqueIndex:idx_attendance_slot"`
 	CheckInTime *time.Time `json:"check_in_time"`
 	CheckOutTime *time.Time `json:"check_out_time"`
 	Status      string    `json:"status" gorm:"not null;default:absent"` // present, absent, late, excused
+	LateMinutes int       `json:"late_minutes" gorm:"default:0"` // minutes after the bell, set when late
 	Notes       string    `json:"notes"`
 	Subject     string    `json:"subject"`
+	Period      int       `json:"period" gorm:"default:0;uniqueIndex:idx_attendance_slot"` // lesson period number, 0 for the daily check-in; one record per student, date and period
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -29,6 +31,7 @@ type AttendanceStats struct {
 	PresentDays    int64   `json:"present_days"`
 	AbsentDays     int64   `json:"absent_days"`
 	LateDays       int64   `json:"late_days"`
+	ExcusedDays    int64   `json:"excused_days"`
 	AttendanceRate float64 `json:"attendance_rate"`
 }
 
@@ -38,4 +41,73 @@ const (
 	StatusAbsent  = "absent"
 	StatusLate    = "late"
 	StatusExcused = "excused"
-)
\ No newline at end of file
+)
+
+func IsValidStatus(status string) bool {
+	return status == StatusPresent || status == StatusAbsent || status == StatusLate || status == StatusExcused
+}
+
+// DailyAttendance is a student's day rolled up from their attendance
+// records. When lessons were taken the day is computed from the periods,
+// otherwise it is the daily check-in.
+type DailyAttendance struct {
+	StudentID       uint      `json:"student_id"`
+	StudentName     string    `json:"student_name"`
+	Date            time.Time `json:"date"`
+	Status          string    `json:"status"`
+	TotalPeriods    int       `json:"total_periods"`
+	AttendedPeriods int       `json:"attended_periods"`
+	LatePeriods     int       `json:"late_periods"`
+	AbsentPeriods   int       `json:"absent_periods"`
+	ExcusedPeriods  int       `json:"excused_periods"`
+	LateMinutes     int       `json:"late_minutes"`
+}
+
+// RollupDay combines one student's records for one day. The day is absent
+// when no lesson was attended (excused if every lesson was excused), late
+// when any attended lesson was late, and present otherwise.
+func RollupDay(records []Attendance) DailyAttendance {
+	day := DailyAttendance{}
+	if len(records) == 0 {
+		return day
+	}
+	day.StudentID = records[0].StudentID
+	day.Date = records[0].Date
+
+	var daily *Attendance
+	for i := range records {
+		r := &records[i]
+		if r.Period == 0 {
+			daily = r
+			continue
+		}
+		day.TotalPeriods++
+		switch r.Status {
+		case StatusPresent:
+			day.AttendedPeriods++
+		case StatusLate:
+			day.AttendedPeriods++
+			day.LatePeriods++
+			day.LateMinutes += r.LateMinutes
+		case StatusExcused:
+			day.ExcusedPeriods++
+		default:
+			day.AbsentPeriods++
+		}
+	}
+
+	switch {
+	case day.TotalPeriods == 0:
+		day.Status = daily.Status
+		day.LateMinutes = daily.LateMinutes
+	case day.AttendedPeriods == 0 && day.ExcusedPeriods == day.TotalPeriods:
+		day.Status = StatusExcused
+	case day.AttendedPeriods == 0:
+		day.Status = StatusAbsent
+	case day.LatePeriods > 0:
+		day.Status = StatusLate
+	default:
+		day.Status = StatusPresent
+	}
+	return day
+}
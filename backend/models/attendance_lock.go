@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// AttendanceLock freezes a class's attendance from StartDate through
+// EndDate, both inclusive, e.g. once the monthly report has been handed to
+// the principal. Locked records only change through an approved
+// AttendanceCorrection.
+type AttendanceLock struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Class     string    `json:"class" gorm:"not null;index"`
+	StartDate time.Time `json:"start_date" gorm:"not null"`
+	EndDate   time.Time `json:"end_date" gorm:"not null"`
+	Reason    string    `json:"reason"`
+	LockedBy  uint      `json:"locked_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Covers reports whether day falls within the lock.
+func (l *AttendanceLock) Covers(day time.Time) bool {
+	return !day.Before(l.StartDate) && !day.After(l.EndDate)
+}
+
+const (
+	CorrectionPending   = "pending"
+	CorrectionApproved  = "approved"
+	CorrectionRejected  = "rejected"
+	CorrectionCancelled = "cancelled"
+)
+
+// AttendanceCorrection is a requested change to locked attendance. It is
+// applied only once a second user approves it; the row is kept as the
+// approval trail. AttendanceID is nil when the correction adds a record.
+type AttendanceCorrection struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	LockID       uint      `json:"lock_id" gorm:"index"`
+	AttendanceID *uint     `json:"attendance_id" gorm:"index"`
+	StudentID    uint      `json:"student_id" gorm:"not null;index"`
+	Date         time.Time `json:"date" gorm:"not null"`
+	Period       int       `json:"period"`
+
+	// Values before the change, empty when adding a record
+	OldStatus  string `json:"old_status"`
+	OldNotes   string `json:"old_notes"`
+	OldSubject string `json:"old_subject"`
+
+	NewStatus  string `json:"new_status" gorm:"not null"`
+	NewNotes   string `json:"new_notes"`
+	NewSubject string `json:"new_subject"`
+
+	Reason          string     `json:"reason" gorm:"not null"`
+	Status          string     `json:"status" gorm:"not null;default:pending;index"`
+	RequestedBy     uint       `json:"requested_by"`
+	RequestedByType string     `json:"requested_by_type"`
+	ReviewedBy      *uint      `json:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	ReviewNote      string     `json:"review_note"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
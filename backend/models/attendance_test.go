@@ -0,0 +1,90 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupDay(t *testing.T) {
+	date := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	period := func(n int, status string, lateMinutes int) Attendance {
+		return Attendance{StudentID: 7, Date: date, Period: n, Status: status, LateMinutes: lateMinutes}
+	}
+
+	tests := []struct {
+		name    string
+		records []Attendance
+		want    DailyAttendance
+	}{
+		{
+			name:    "all present",
+			records: []Attendance{period(1, StatusPresent, 0), period(2, StatusPresent, 0)},
+			want:    DailyAttendance{Status: StatusPresent, TotalPeriods: 2, AttendedPeriods: 2},
+		},
+		{
+			name:    "late in one lesson",
+			records: []Attendance{period(1, StatusLate, 10), period(2, StatusPresent, 0), period(3, StatusLate, 5)},
+			want:    DailyAttendance{Status: StatusLate, TotalPeriods: 3, AttendedPeriods: 3, LatePeriods: 2, LateMinutes: 15},
+		},
+		{
+			name:    "present and absent",
+			records: []Attendance{period(1, StatusPresent, 0), period(2, StatusAbsent, 0)},
+			want:    DailyAttendance{Status: StatusPresent, TotalPeriods: 2, AttendedPeriods: 1, AbsentPeriods: 1},
+		},
+		{
+			name:    "late and excused",
+			records: []Attendance{period(1, StatusExcused, 0), period(2, StatusLate, 20)},
+			want:    DailyAttendance{Status: StatusLate, TotalPeriods: 2, AttendedPeriods: 1, LatePeriods: 1, ExcusedPeriods: 1, LateMinutes: 20},
+		},
+		{
+			name:    "all absent",
+			records: []Attendance{period(1, StatusAbsent, 0), period(2, StatusAbsent, 0)},
+			want:    DailyAttendance{Status: StatusAbsent, TotalPeriods: 2, AbsentPeriods: 2},
+		},
+		{
+			name:    "all excused",
+			records: []Attendance{period(1, StatusExcused, 0), period(2, StatusExcused, 0)},
+			want:    DailyAttendance{Status: StatusExcused, TotalPeriods: 2, ExcusedPeriods: 2},
+		},
+		{
+			name:    "excused and absent",
+			records: []Attendance{period(1, StatusExcused, 0), period(2, StatusAbsent, 0)},
+			want:    DailyAttendance{Status: StatusAbsent, TotalPeriods: 2, AbsentPeriods: 1, ExcusedPeriods: 1},
+		},
+		{
+			name:    "unknown status counts as absent",
+			records: []Attendance{period(1, "", 0), period(2, StatusPresent, 0)},
+			want:    DailyAttendance{Status: StatusPresent, TotalPeriods: 2, AttendedPeriods: 1, AbsentPeriods: 1},
+		},
+		{
+			name:    "periods override the daily check-in",
+			records: []Attendance{period(0, StatusLate, 30), period(1, StatusPresent, 0), period(2, StatusPresent, 0)},
+			want:    DailyAttendance{Status: StatusPresent, TotalPeriods: 2, AttendedPeriods: 2},
+		},
+		{
+			name:    "absent from lessons after checking in",
+			records: []Attendance{period(0, StatusPresent, 0), period(1, StatusAbsent, 0)},
+			want:    DailyAttendance{Status: StatusAbsent, TotalPeriods: 1, AbsentPeriods: 1},
+		},
+		{
+			name:    "daily check-in only",
+			records: []Attendance{period(0, StatusLate, 12)},
+			want:    DailyAttendance{Status: StatusLate, LateMinutes: 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.StudentID = 7
+			tt.want.Date = date
+			if got := RollupDay(tt.records); got != tt.want {
+				t.Errorf("RollupDay() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollupDayEmpty(t *testing.T) {
+	if got := RollupDay(nil); got != (DailyAttendance{}) {
+		t.Errorf("RollupDay(nil) = %+v, want zero value", got)
+	}
+}
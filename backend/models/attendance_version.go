@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AttendanceVersion is an immutable snapshot of an Attendance row written
+// after every create, update, revert and delete.
+type AttendanceVersion struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	AttendanceID uint       `json:"attendance_id" gorm:"not null;uniqueIndex:idx_attendance_version"`
+	Version      int        `json:"version" gorm:"not null;uniqueIndex:idx_attendance_version"`
+	Operation    string     `json:"operation"` // create, update, revert, delete
+	StudentID    uint       `json:"student_id"`
+	Date         time.Time  `json:"date"`
+	Status       string     `json:"status"`
+	LateMinutes  int        `json:"late_minutes"`
+	Notes        string     `json:"notes"`
+	Subject      string     `json:"subject"`
+	Period       int        `json:"period"`
+	CheckInTime  *time.Time `json:"check_in_time"`
+	CheckOutTime *time.Time `json:"check_out_time"`
+	EditedByID   uint       `json:"edited_by_id"`
+	EditedByType string     `json:"edited_by_type"` // student, admin, system
+	Reason       string     `json:"reason"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Statement settings read by the Attendance hooks.
+const (
+	settingEditorID   = "attendance:editor_id"
+	settingEditorType = "attendance:editor_type"
+	settingReason     = "attendance:reason"
+	settingOperation  = "attendance:operation"
+)
+
+// WithEditor tags attendance writes made through db with who made them and
+// why, so the version hooks can record it.
+func WithEditor(db *gorm.DB, userID uint, userType, reason string) *gorm.DB {
+	return db.Set(settingEditorID, userID).
+		Set(settingEditorType, userType).
+		Set(settingReason, reason)
+}
+
+// AsRevert marks the next attendance write as a revert to an older version.
+func AsRevert(db *gorm.DB) *gorm.DB {
+	return db.Set(settingOperation, "revert")
+}
+
+func (a *Attendance) AfterCreate(tx *gorm.DB) error {
+	return a.recordVersion(tx, "create")
+}
+
+func (a *Attendance) AfterUpdate(tx *gorm.DB) error {
+	return a.recordVersion(tx, "update")
+}
+
+func (a *Attendance) AfterDelete(tx *gorm.DB) error {
+	return a.recordVersion(tx, "delete")
+}
+
+func (a *Attendance) recordVersion(tx *gorm.DB, operation string) error {
+	// Batch updates without a loaded row have nothing to snapshot
+	if a.ID == 0 {
+		return nil
+	}
+
+	if op, ok := tx.Get(settingOperation); ok && operation == "update" {
+		operation = op.(string)
+	}
+
+	version := AttendanceVersion{
+		AttendanceID: a.ID,
+		Operation:    operation,
+		StudentID:    a.StudentID,
+		Date:         a.Date,
+		Status:       a.Status,
+		LateMinutes:  a.LateMinutes,
+		Notes:        a.Notes,
+		Subject:      a.Subject,
+		Period:       a.Period,
+		CheckInTime:  a.CheckInTime,
+		CheckOutTime: a.CheckOutTime,
+		EditedByType: "system",
+	}
+	if id, ok := tx.Get(settingEditorID); ok {
+		version.EditedByID = id.(uint)
+	}
+	if userType, ok := tx.Get(settingEditorType); ok {
+		version.EditedByType = userType.(string)
+	}
+	if reason, ok := tx.Get(settingReason); ok {
+		version.Reason = reason.(string)
+	}
+
+	var latest int
+	tx.Session(&gorm.Session{NewDB: true}).Model(&AttendanceVersion{}).
+		Where("attendance_id = ?", a.ID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest)
+	version.Version = latest + 1
+
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&version).Error
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog records one write performed through the admin API.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ActorID    uint      `json:"actor_id" gorm:"index:idx_audit_actor"`
+	ActorType  string    `json:"actor_type" gorm:"index:idx_audit_actor"` // admin, student, parent, api_key
+	Action     string    `json:"action" gorm:"index"`                     // create, update, delete, ...
+	EntityType string    `json:"entity_type" gorm:"index:idx_audit_entity"`
+	EntityID   string    `json:"entity_id" gorm:"index:idx_audit_entity"`
+	Before     string    `json:"before,omitempty"` // JSON snapshot, empty for creates
+	After      string    `json:"after,omitempty"`  // JSON snapshot, empty for deletes
+	Changes    string    `json:"changes"`          // JSON object of field -> {from, to}
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
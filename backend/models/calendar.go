@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// SchoolYear bounds the days attendance is expected. When school years are
+// configured, days outside all of them are not school days.
+type SchoolYear struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name" gorm:"uniqueIndex;not null"` // e.g. 2024/2025
+	StartDate time.Time  `json:"start_date" gorm:"not null"`
+	EndDate   time.Time  `json:"end_date" gorm:"not null"`
+	Semesters []Semester `json:"semesters,omitempty" gorm:"foreignKey:SchoolYearID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type Semester struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	SchoolYearID uint      `json:"school_year_id" gorm:"not null;index"`
+	Name         string    `json:"name" gorm:"not null"` // e.g. Ganjil, Genap
+	StartDate    time.Time `json:"start_date" gorm:"not null"`
+	EndDate      time.Time `json:"end_date" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Calendar event types. Holidays and exams close the school for regular
+// attendance, school_day opens a day that is normally off (e.g. a make-up
+// Saturday) and event is informational only.
+const (
+	EventHoliday   = "holiday"
+	EventExam      = "exam"
+	EventSchoolDay = "school_day"
+	EventOther     = "event"
+)
+
+// CalendarEvent covers StartDate through EndDate, both inclusive.
+type CalendarEvent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null"`
+	Type        string    `json:"type" gorm:"not null;default:holiday"`
+	StartDate   time.Time `json:"start_date" gorm:"not null;index"`
+	EndDate     time.Time `json:"end_date" gorm:"not null;index"`
+	Description string    `json:"description"`
+	UID         string    `json:"uid,omitempty" gorm:"index"`   // iCalendar UID, used to update re-imported events
+	Source      string    `json:"source" gorm:"default:manual"` // manual, ics
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func IsValidEventType(t string) bool {
+	switch t {
+	case EventHoliday, EventExam, EventSchoolDay, EventOther:
+		return true
+	}
+	return false
+}
+
+// Covers reports whether the event includes day.
+func (e *CalendarEvent) Covers(day time.Time) bool {
+	return !day.Before(e.StartDate) && !day.After(e.EndDate)
+}
+
+// Closes reports whether the event cancels regular attendance.
+func (e *CalendarEvent) Closes() bool {
+	return e.Type == EventHoliday || e.Type == EventExam
+}
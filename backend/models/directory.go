@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// DirectorySyncRun records one LDAP sync, including dry runs, with the full
+// report of what was (or would have been) changed.
+type DirectorySyncRun struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Trigger     string     `json:"trigger"` // schedule, manual, cli
+	DryRun      bool       `json:"dry_run"`
+	Created     int        `json:"created"`
+	Updated     int        `json:"updated"`
+	Deactivated int        `json:"deactivated"`
+	Errors      int        `json:"errors"`
+	Report      string     `json:"-"` // JSON encoded report
+	StartedAt   time.Time  `json:"started_at" gorm:"index"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey stores the response to a request sent with an
+// Idempotency-Key header so that retries of it get the same answer instead
+// of being processed again. StatusCode is 0 while the first request is
+// still being handled.
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	UserType    string    `json:"user_type" gorm:"not null;uniqueIndex:idx_idempotency_user_key"` // student, admin, parent, api_key
+	Key         string    `json:"key" gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	RequestHash string    `json:"-" gorm:"not null"` // method, route and body of the first request
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"-"`
+	Body        []byte    `json:"-"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
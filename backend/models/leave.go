@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Leave types: sakit (sick), izin keluarga (family) and dispensasi for
+// school business such as competitions.
+const (
+	LeaveSick         = "sick"
+	LeaveFamily       = "family"
+	LeaveDispensation = "dispensation"
+)
+
+const (
+	LeavePending   = "pending"
+	LeaveApproved  = "approved"
+	LeaveRejected  = "rejected"
+	LeaveCancelled = "cancelled"
+)
+
+// LeaveRequest asks for a student to be excused from StartDate through
+// EndDate, both inclusive. It is submitted by the student or a parent and
+// reviewed by the class's homeroom teacher; approval marks the school days
+// in the range as excused.
+type LeaveRequest struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	StudentID       uint       `json:"student_id" gorm:"not null;index"`
+	Type            string     `json:"type" gorm:"not null"`
+	StartDate       time.Time  `json:"start_date" gorm:"not null"`
+	EndDate         time.Time  `json:"end_date" gorm:"not null"`
+	Reason          string     `json:"reason" gorm:"not null"`
+	AttachmentName  string     `json:"attachment_name,omitempty"` // file name as uploaded
+	AttachmentType  string     `json:"attachment_type,omitempty"`
+	AttachmentPath  string     `json:"-"` // location on disk, under LEAVE_ATTACHMENT_DIR
+	Status          string     `json:"status" gorm:"not null;default:pending;index"`
+	SubmittedByID   uint       `json:"submitted_by_id"`
+	SubmittedByType string     `json:"submitted_by_type"` // student, parent
+	ReviewedBy      *uint      `json:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	ReviewNote      string     `json:"review_note"`
+	ExcusedDays     int        `json:"excused_days"` // school days marked excused on approval
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Student *Student `json:"student,omitempty" gorm:"-"` // loaded by the handlers
+}
+
+func IsValidLeaveType(t string) bool {
+	return t == LeaveSick || t == LeaveFamily || t == LeaveDispensation
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// OIDCLoginState holds the PKCE verifier and nonce of a pending single
+// sign-on attempt until the browser returns from the provider. Only the
+// hash of the state value is stored.
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	StateHash    string    `json:"-" gorm:"uniqueIndex;not null"`
+	Provider     string    `json:"provider" gorm:"not null"`
+	UserType     string    `json:"user_type" gorm:"not null"` // student, admin
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
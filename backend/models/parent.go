@@ -9,6 +9,7 @@ type Parent struct {
 	ID          uint   `json:"id" gorm:"primaryKey"`
 	Name        string `json:"name" gorm:"not null"`
 	Email       string `json:"email" gorm:"unique;not null"`
+	Password    string `json:"-"` // empty until the parent accepts an invitation or registers
 	PhoneNumber string `json:"phone_number"`
 	Address     string `json:"address"`
 	Relationship string `json:"relationship"` // father, mother, guardian
@@ -23,13 +24,28 @@ type Parent struct {
 
 type StudentParent struct {
 	ID        uint   `json:"id" gorm:"primaryKey"`
-	StudentID string `json:"student_id" gorm:"not null"`
-	ParentID  uint   `json:"parent_id" gorm:"not null"`
+	StudentID string `json:"student_id" gorm:"not null;uniqueIndex:idx_student_parent"`
+	ParentID  uint   `json:"parent_id" gorm:"not null;uniqueIndex:idx_student_parent"`
 	CreatedAt time.Time `json:"created_at"`
 	
 	// Foreign key relationships
 	Student Student `json:"student" gorm:"foreignKey:StudentID;references:StudentID"`
-	Parent  Parent  `json:"parent" gorm:"foreignKey:ParentID"`
+	Parent  *Parent `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
+}
+
+// ParentInvitation lets a parent create an account that is already linked
+// to their children. Only the SHA-256 hash of the invitation token is stored.
+type ParentInvitation struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Email        string     `json:"email" gorm:"not null;index"`
+	Name         string     `json:"name"`
+	Relationship string     `json:"relationship"`
+	StudentIDs   string     `json:"student_ids"` // comma-separated student numbers
+	TokenHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	InvitedBy    uint       `json:"invited_by"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	AcceptedAt   *time.Time `json:"accepted_at"`
+	CreatedAt    time.Time  `json:"created_at"`
 }
 
 type Notification struct {
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// QRSession is a QR code opened by a teacher for students to scan.
+type QRSession struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	SessionCode string    `json:"session_code" gorm:"unique;not null"`
+	Subject     string    `json:"subject"`
+	Teacher     string    `json:"teacher"`
+	TeacherID   *uint     `json:"teacher_id" gorm:"index"` // admin who opened the session
+	Class       string    `json:"class"`                   // when set, only this class may scan
+	Period      int       `json:"period"`                  // lesson period, lateness is measured from its start
+	Location    string    `json:"location"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// QRAttendance is a student's scan of a QR session.
+type QRAttendance struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	SessionCode string    `json:"session_code" gorm:"not null;uniqueIndex:idx_qr_attendance_scan"`
+	StudentID   string    `json:"student_id" gorm:"not null;uniqueIndex:idx_qr_attendance_scan"` // one scan per student and session
+	ScanTime    time.Time `json:"scan_time"`
+	Status      string    `json:"status"` // present or late, from the bell schedule
+	LateMinutes int       `json:"late_minutes"`
+	Location    string    `json:"location"`
+	CreatedAt   time.Time `json:"created_at"`
+}
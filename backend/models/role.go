@@ -0,0 +1,162 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Permission constants checked by middleware.RequirePermission.
+const (
+	PermAll = "*"
+
+	PermStudentsRead   = "students:read"
+	PermStudentsCreate = "students:create"
+	PermStudentsUpdate = "students:update"
+	PermStudentsDelete = "students:delete"
+
+	// PermClassesAll lifts the teaching-assignment scope on students,
+	// attendance, QR sessions and reports.
+	PermClassesAll = "classes:all"
+
+	PermAttendanceRead   = "attendance:read"
+	PermAttendanceCreate = "attendance:create"
+	PermAttendanceUpdate = "attendance:update"
+
+	PermAttendanceCheckinOnBehalf = "attendance:checkin-on-behalf"
+
+	// PermAttendanceLock locks and unlocks a class's attendance for a date
+	// range; PermAttendanceApprove approves corrections to locked records.
+	PermAttendanceLock    = "attendance:lock"
+	PermAttendanceApprove = "attendance:approve"
+
+	PermQRGenerate = "qr:generate"
+	PermQRManage   = "qr:manage"
+
+	PermReportsView   = "reports:view"
+	PermReportsExport = "reports:export"
+
+	PermParentsManage = "parents:manage"
+
+	PermAuditRead = "audit:read"
+
+	PermUsersManage  = "users:manage"
+	PermRolesManage  = "roles:manage"
+	PermAdminsManage = "admins:manage"
+
+	PermAPIKeysManage = "api_keys:manage"
+
+	PermScheduleManage = "schedule:manage"
+
+	// PermLeaveApprove reviews leave requests for the classes the admin is
+	// homeroom teacher of, or for every class with classes:all.
+	PermLeaveApprove = "leave:approve"
+)
+
+// AllPermissions lists every permission that can be granted to a role.
+var AllPermissions = []string{
+	PermStudentsRead, PermStudentsCreate, PermStudentsUpdate, PermStudentsDelete,
+	PermClassesAll,
+	PermAttendanceRead, PermAttendanceCreate, PermAttendanceUpdate,
+	PermAttendanceCheckinOnBehalf,
+	PermAttendanceLock, PermAttendanceApprove,
+	PermQRGenerate, PermQRManage,
+	PermReportsView, PermReportsExport,
+	PermParentsManage,
+	PermAuditRead,
+	PermUsersManage, PermRolesManage, PermAdminsManage,
+	PermAPIKeysManage,
+	PermScheduleManage,
+	PermLeaveApprove,
+}
+
+// Role names seeded at startup. RoleSuperAdmin keeps the historical "admin"
+// value so existing admin rows retain full access.
+const (
+	RoleSuperAdmin      = "admin"
+	RolePrincipal       = "principal"
+	RoleHomeroomTeacher = "homeroom_teacher"
+	RoleSubjectTeacher  = "subject_teacher"
+	RoleStaffOperator   = "staff_operator"
+)
+
+type Role struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	Name        string           `json:"name" gorm:"unique;not null"`
+	DisplayName string           `json:"display_name"`
+	Description string           `json:"description"`
+	IsSystem    bool             `json:"is_system" gorm:"default:false"` // seeded roles cannot be deleted
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Permissions []RolePermission `json:"permissions" gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE"`
+}
+
+type RolePermission struct {
+	ID         uint   `json:"-" gorm:"primaryKey"`
+	RoleID     uint   `json:"-" gorm:"not null;uniqueIndex:idx_role_permission"`
+	Permission string `json:"permission" gorm:"not null;uniqueIndex:idx_role_permission"`
+}
+
+// DefaultRoles describes the roles created on first start.
+var DefaultRoles = []struct {
+	Name        string
+	DisplayName string
+	Permissions []string
+}{
+	{RoleSuperAdmin, "Super Admin", []string{PermAll}},
+	{RolePrincipal, "Kepala Sekolah", []string{
+		PermStudentsRead, PermClassesAll, PermAttendanceRead, PermQRManage,
+		PermReportsView, PermReportsExport, PermAuditRead, PermLeaveApprove,
+		PermAttendanceLock, PermAttendanceApprove,
+	}},
+	{RoleHomeroomTeacher, "Wali Kelas", []string{
+		PermStudentsRead, PermStudentsUpdate,
+		PermAttendanceRead, PermAttendanceCreate, PermAttendanceUpdate,
+		PermQRGenerate, PermQRManage, PermReportsView, PermReportsExport,
+		PermParentsManage, PermLeaveApprove, PermAttendanceApprove,
+	}},
+	{RoleSubjectTeacher, "Guru Mata Pelajaran", []string{
+		PermStudentsRead, PermAttendanceRead, PermAttendanceCreate,
+		PermQRGenerate, PermQRManage, PermReportsView,
+	}},
+	{RoleStaffOperator, "Operator", []string{
+		PermStudentsRead, PermStudentsCreate, PermStudentsUpdate, PermClassesAll,
+		PermAttendanceRead, PermReportsView, PermParentsManage,
+	}},
+}
+
+func (r *Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		names = append(names, p.Permission)
+	}
+	return names
+}
+
+// HasPermission reports whether perm is covered by granted, honouring the
+// "*" and "resource:*" wildcards.
+func HasPermission(granted []string, perm string) bool {
+	resource := perm
+	if i := strings.Index(perm, ":"); i >= 0 {
+		resource = perm[:i]
+	}
+
+	for _, g := range granted {
+		if g == PermAll || g == perm || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidPermission reports whether perm is a known permission or wildcard.
+func IsValidPermission(perm string) bool {
+	if perm == PermAll {
+		return true
+	}
+	for _, p := range AllPermissions {
+		if p == perm || strings.SplitN(p, ":", 2)[0]+":*" == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+)
+
+// BellSchedule sets when the school day starts. A row without Weekday and
+// Grade is the default; rows for a weekday, a grade, or both override it,
+// the most specific match winning.
+type BellSchedule struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Weekday      *int      `json:"weekday"`                        // 0 = Sunday ... 6 = Saturday, null for every day
+	Grade        string    `json:"grade"`                          // empty for every grade
+	StartTime    string    `json:"start_time" gorm:"not null"`     // HH:MM, school local time
+	GraceMinutes int       `json:"grace_minutes" gorm:"default:0"` // arrivals within the grace period are still present
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Specificity ranks overrides: weekday and grade beat grade alone, which
+// beats weekday alone, which beats the default.
+func (s *BellSchedule) Specificity() int {
+	rank := 0
+	if s.Grade != "" {
+		rank += 2
+	}
+	if s.Weekday != nil {
+		rank++
+	}
+	return rank
+}
+
+// Matches reports whether the schedule applies to the grade on the weekday.
+func (s *BellSchedule) Matches(grade string, weekday time.Weekday) bool {
+	if s.Grade != "" && s.Grade != grade {
+		return false
+	}
+	return s.Weekday == nil || *s.Weekday == int(weekday)
+}
+
+// StartOn returns the start time on the given day.
+func (s *BellSchedule) StartOn(day time.Time) (time.Time, error) {
+	return clockOn(day, s.StartTime)
+}
+
+// LessonPeriod is one numbered lesson of the school day. Attendance taken
+// for a lesson carries its number; the daily check-in uses period 0.
+type LessonPeriod struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Number       int       `json:"number" gorm:"uniqueIndex;not null"` // 1, 2, 3 ... in teaching order
+	Name         string    `json:"name"`
+	StartTime    string    `json:"start_time" gorm:"not null"` // HH:MM, school local time
+	EndTime      string    `json:"end_time" gorm:"not null"`
+	GraceMinutes int       `json:"grace_minutes" gorm:"default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// StartOn returns the start of the lesson on the given day.
+func (p *LessonPeriod) StartOn(day time.Time) (time.Time, error) {
+	return clockOn(day, p.StartTime)
+}
+
+// InProgress reports whether the lesson is running at t.
+func (p *LessonPeriod) InProgress(t time.Time) bool {
+	start, err := clockOn(t, p.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := clockOn(t, p.EndTime)
+	if err != nil {
+		return false
+	}
+	return !t.Before(start) && t.Before(end)
+}
+
+// clockOn places an HH:MM time of day on the given day.
+func clockOn(day time.Time, hhmm string) (time.Time, error) {
+	clock, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location()), nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginThrottle tracks consecutive failed logins for one account or one
+// client IP. Key is "account:<user_type>:<email>" or "ip:<address>".
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Key           string     `json:"key" gorm:"column:throttle_key;uniqueIndex;not null"`
+	Failures      int        `json:"failures" gorm:"default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// FailedLogin is the audit trail of rejected login attempts.
+type FailedLogin struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserType  string    `json:"user_type" gorm:"index"`
+	Email     string    `json:"email" gorm:"index"`
+	UserID    *uint     `json:"user_id"` // nil when no account matched the email
+	IPAddress string    `json:"ip_address" gorm:"index"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"` // invalid_credentials, throttled, sso_no_account
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is a stored JWT signing key. The newest key whose ActiveFrom
+// has passed signs new tokens; older keys keep verifying until VerifyUntil.
+type SigningKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	KID         string     `json:"kid" gorm:"column:kid;uniqueIndex;not null"`
+	Algorithm   string     `json:"algorithm" gorm:"not null"` // HS256, RS256, EdDSA
+	PrivateKey  string     `json:"-" gorm:"not null"`         // PEM for RS256/EdDSA, base64 for HS256
+	ActiveFrom  time.Time  `json:"active_from" gorm:"not null"`
+	VerifyUntil *time.Time `json:"verify_until"` // nil while the key is current
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -16,12 +16,14 @@ type Student struct {
 	PhoneNumber string `json:"phone_number"`
 	Address     string `json:"address"`
 	IsActive    bool   `json:"is_active" gorm:"default:true"`
+	DirectoryDN string `json:"directory_dn,omitempty" gorm:"index"` // set when managed by the LDAP sync
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 	
 	// Relationships
 	Attendances []Attendance `json:"attendances,omitempty" gorm:"foreignKey:StudentID"`
+	Guardians   []Parent     `json:"guardians,omitempty" gorm:"-"` // loaded from student_parents on demand
 }
 
 type Admin struct {
@@ -32,6 +34,20 @@ type Admin struct {
 	Name      string `json:"name" gorm:"not null"`
 	Role      string `json:"role" gorm:"default:admin"`
 	IsActive  bool   `json:"is_active" gorm:"default:true"`
+
+	// MustChangePassword blocks every admin route except change-password
+	// until the password is rotated, e.g. for the bootstrap account.
+	MustChangePassword bool `json:"must_change_password" gorm:"default:false"`
+
+	// Two-factor authentication
+	TOTPEnabled       bool   `json:"totp_enabled" gorm:"default:false"`
+	TOTPSecret        string `json:"-"`
+	TOTPPendingSecret string `json:"-"` // set during enrollment until the first code is verified
+	TOTPLastStep      int64  `json:"-"` // last accepted time step, rejects replayed codes
+
+	// DirectoryDN is set when the account is managed by the LDAP sync
+	DirectoryDN string `json:"directory_dn,omitempty" gorm:"index"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
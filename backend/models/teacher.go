@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// TeachingAssignment links an admin account to a class it teaches. An empty
+// Subject makes the admin the class's homeroom teacher, covering every
+// subject. Admins without the classes:all permission only see the classes
+// they are assigned to.
+type TeachingAssignment struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	AdminID   uint      `json:"admin_id" gorm:"not null;uniqueIndex:idx_teaching_assignment"`
+	Class     string    `json:"class" gorm:"not null;uniqueIndex:idx_teaching_assignment"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_teaching_assignment"`
+	CreatedAt time.Time `json:"created_at"`
+}
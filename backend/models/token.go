@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a rotating, single-use token that can be exchanged for a
+// new access token. Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index:idx_refresh_user"`
+	UserType   string     `json:"user_type" gorm:"not null;index:idx_refresh_user"` // student, admin
+	SessionID  uint       `json:"session_id" gorm:"index"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	AccessJTI  string     `json:"-" gorm:"index"` // jti of the access token issued alongside
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uint      `json:"replaced_by"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// RevokedToken blacklists an access token by jti until it would have
+// expired anyway.
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	JTI       string    `json:"jti" gorm:"uniqueIndex;not null"`
+	UserID    uint      `json:"user_id"`
+	UserType  string    `json:"user_type"`
+	Reason    string    `json:"reason"` // logout, admin_revoke, reuse_detected, password_reset, password_change, directory_sync
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *RefreshToken) IsActive() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// Session groups the refresh tokens issued from one login on one device.
+// It lives as long as its refresh token chain and is what users see and
+// revoke under "active sessions".
+type Session struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"not null;index:idx_session_user"`
+	UserType      string     `json:"user_type" gorm:"not null;index:idx_session_user"` // student, admin, parent
+	UserAgent     string     `json:"user_agent"`
+	IPAddress     string     `json:"ip_address"` // address of the most recent login or refresh
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason string     `json:"revoked_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Current       bool       `json:"current" gorm:"-"`
+}
+
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// PasswordResetToken is a single-use, expiring token mailed to a user who
+// forgot their password. Only the SHA-256 hash is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_reset_user"`
+	UserType  string     `json:"user_type" gorm:"not null;index:idx_reset_user"` // student, admin, parent
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	RequestIP string     `json:"request_ip"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a single-use backup code for an admin who lost access to
+// their authenticator app. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	AdminID   uint       `json:"admin_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFAChallenge is issued after a correct password for an admin with 2FA
+// enabled and must be completed with a TOTP or recovery code.
+type MFAChallenge struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	AdminID   uint       `json:"admin_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
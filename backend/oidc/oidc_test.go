@@ -0,0 +1,302 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer is an identity provider serving discovery and a JWKS with one
+// RSA and one P-256 key.
+type testIssuer struct {
+	*httptest.Server
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	jwksHits atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksHits.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa-1",
+					"use": "sig",
+					"n":   b64(rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": "ec-1",
+					"crv": "P-256",
+					"x":   b64(ecKey.X.FillBytes(make([]byte, 32))),
+					"y":   b64(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+				{
+					"kty": "RSA",
+					"kid": "enc-1",
+					"use": "enc",
+					"n":   b64(rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+			},
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (s *testIssuer) provider() *Provider {
+	return &Provider{
+		Name:       "test",
+		Issuer:     s.URL,
+		ClientID:   "client-id",
+		EmailClaim: "email",
+	}
+}
+
+// claims returns valid ID token claims for nonce.
+func (s *testIssuer) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            s.URL,
+		"sub":            "user-1",
+		"aud":            "client-id",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "Siswa@School.ID",
+		"email_verified": true,
+	}
+}
+
+func (s *testIssuer) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	var key interface{} = s.rsaKey
+	if method == jwt.SigningMethodES256 {
+		key = s.ecKey
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims("n-1"))
+	forged.Header["kid"] = "rsa-1"
+	forgedToken, err := forged.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims("n-1")).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := issuer.claims("n-1")
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"RS256", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.claims("n-1")), ""},
+		{"ES256", issuer.sign(t, jwt.SigningMethodES256, "ec-1", issuer.claims("n-1")), ""},
+		{"audience list", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", with("aud", []string{"other", "client-id"})), ""},
+		{"nonce mismatch", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.claims("n-2")), "nonce mismatch"},
+		{"missing nonce", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", with("nonce", nil)), "nonce mismatch"},
+		{"wrong audience", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", with("aud", "other-client")), "aud"},
+		{"wrong issuer", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", with("iss", "https://evil.example")), "iss"},
+		{"expired", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", with("exp", time.Now().Add(-time.Hour).Unix())), "expired"},
+		{"no expiry", issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", with("exp", nil)), "no expiry"},
+		{"unknown kid", issuer.sign(t, jwt.SigningMethodRS256, "rsa-2", issuer.claims("n-1")), "unknown signing key"},
+		{"encryption key", issuer.sign(t, jwt.SigningMethodRS256, "enc-1", issuer.claims("n-1")), "unknown signing key"},
+		{"signed by another key", forgedToken, "signature is invalid"},
+		{"HS256", hmacToken, "signing method HS256 is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := issuer.provider().VerifyIDToken(context.Background(), tt.token, "n-1")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims["sub"] != "user-1" {
+					t.Errorf("sub = %v, want user-1", claims["sub"])
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenUnknownKidRefetchLimited(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := issuer.provider()
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.claims("n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		token := issuer.sign(t, jwt.SigningMethodRS256, "rotated", issuer.claims("n"))
+		if _, err := p.VerifyIDToken(ctx, token, "n"); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+			t.Fatalf("error = %v, want unknown signing key", err)
+		}
+	}
+	if hits := issuer.jwksHits.Load(); hits != 1 {
+		t.Errorf("JWKS fetched %d times, want 1 within the refresh interval", hits)
+	}
+
+	// Once the interval has passed an unknown kid triggers a refetch.
+	p.keysFetchedAt = time.Now().Add(-2 * keyRefreshInterval)
+	p.VerifyIDToken(ctx, issuer.sign(t, jwt.SigningMethodRS256, "rotated", issuer.claims("n")), "n")
+	if hits := issuer.jwksHits.Load(); hits != 2 {
+		t.Errorf("JWKS fetched %d times, want 2 after the refresh interval", hits)
+	}
+}
+
+func TestVerifyIDTokenIssuerMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.Config.Handler.(*http.ServeMux).HandleFunc("/tenant/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	})
+	p := issuer.provider()
+	p.Issuer = issuer.URL + "/tenant"
+
+	_, err := p.VerifyIDToken(context.Background(), issuer.sign(t, jwt.SigningMethodRS256, "rsa-1", issuer.claims("n")), "n")
+	if err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("error = %v, want issuer mismatch", err)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	p := &Provider{EmailClaim: "email"}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		want    string
+		wantErr string
+	}{
+		{"verified", jwt.MapClaims{"email": "Siswa@School.ID", "email_verified": true}, "siswa@school.id", ""},
+		{"verified as string", jwt.MapClaims{"email": "a@b.id", "email_verified": "true"}, "a@b.id", ""},
+		{"verification not reported", jwt.MapClaims{"email": "a@b.id"}, "a@b.id", ""},
+		{"not verified", jwt.MapClaims{"email": "a@b.id", "email_verified": false}, "", "not verified"},
+		{"not verified as string", jwt.MapClaims{"email": "a@b.id", "email_verified": "false"}, "", "not verified"},
+		{"missing email", jwt.MapClaims{"email_verified": true}, "", "no email claim"},
+		{"empty email", jwt.MapClaims{"email": ""}, "", "no email claim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Email(tt.claims)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Email() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailCustomClaim(t *testing.T) {
+	p := &Provider{EmailClaim: "upn"}
+
+	got, err := p.Email(jwt.MapClaims{"upn": "Guru@School.ID", "email": "other@x.id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "guru@school.id" {
+		t.Errorf("Email() = %q, want guru@school.id", got)
+	}
+}
+
+func TestAllowsEmail(t *testing.T) {
+	p := &Provider{AllowedDomains: []string{"school.id"}}
+
+	for email, want := range map[string]bool{
+		"a@school.id":      true,
+		"a@SCHOOL.ID":      true,
+		"a@evil.school.id": false,
+		"a@school.id.evil": false,
+		"no-at-sign":       false,
+	} {
+		if got := p.AllowsEmail(email); got != want {
+			t.Errorf("AllowsEmail(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
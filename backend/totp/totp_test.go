@@ -0,0 +1,175 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B SHA-1 vectors, truncated to the last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", v.unix, err)
+		}
+		if got != v.code {
+			t.Errorf("Code(%d) = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecret(t *testing.T) {
+	got, err := Code(" "+strings.ToLower(rfcSecret)+" ", Step(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "287082" {
+		t.Errorf("got %s, want 287082", got)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := Validate(rfcSecret, v.code, now)
+		if !ok {
+			t.Errorf("Validate(%d, %s) rejected", v.unix, v.code)
+			continue
+		}
+		if step != Step(now) {
+			t.Errorf("Validate(%d) step = %d, want %d", v.unix, step, Step(now))
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{"two steps behind", -2, false},
+		{"one step behind", -1, true},
+		{"current step", 0, true},
+		{"one step ahead", 1, true},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := Validate(rfcSecret, code, now)
+			if ok != tt.want {
+				t.Fatalf("ok = %v, want %v", ok, tt.want)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateStepBoundary(t *testing.T) {
+	// 59 is the last second of step 1, so step 3's code is two steps away
+	// until the clock reaches 60.
+	code, err := Code(rfcSecret, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(rfcSecret, code, time.Unix(59, 0)); ok {
+		t.Error("step 3 accepted at t=59")
+	}
+	if _, ok := Validate(rfcSecret, code, time.Unix(60, 0)); !ok {
+		t.Error("step 3 rejected at t=60")
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"padded with spaces", " 287 082 ", true},
+		{"empty", "", false},
+		{"too short", "28708", false},
+		{"too long", "2870820", false},
+		{"eight digit RFC code", "94287082", false},
+		{"letters", "28708a", false},
+		{"wrong code", "287083", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(rfcSecret, tt.code, now); ok != tt.want {
+				t.Errorf("Validate(%q) = %v, want %v", tt.code, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSecret(t *testing.T) {
+	if _, ok := Validate("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("key length = %d, want 20", len(key))
+	}
+	if strings.Contains(secret, "=") {
+		t.Errorf("secret %q is padded", secret)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Sekolah", "admin@school.id", rfcSecret)
+	for _, want := range []string{
+		"otpauth://totp/Sekolah:admin@school.id?",
+		"secret=" + rfcSecret,
+		"issuer=Sekolah",
+		"digits=6",
+		"period=30",
+	} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("%s does not contain %s", uri, want)
+		}
+	}
+}
@@ -3,14 +3,12 @@ import { View, Text, StyleSheet, Alert, TouchableOpacity } from 'react-native';
 import { BarCodeScanner } from 'expo-barcode-scanner';
 import { Camera } from 'expo-camera';
 import { Ionicons } from '@expo/vector-icons';
-import { useAuth } from '../context/AuthContext';
 import { apiClient } from '../services/api';
 
 export default function QRScannerScreen() {
   const [hasPermission, setHasPermission] = useState<boolean | null>(null);
   const [scanned, setScanned] = useState(false);
   const [scanning, setScanning] = useState(false);
-  const { user } = useAuth();
 
   useEffect(() => {
     const getBarCodeScannerPermissions = async () => {
@@ -49,7 +47,6 @@ export default function QRScannerScreen() {
       // Submit attendance
       const response = await apiClient.post('/student/qr/scan', {
         qr_data: data,
-        student_id: user?.student_id,
         location: 'Mobile App'
       });
 